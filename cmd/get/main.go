@@ -2,67 +2,196 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/runZeroInc/conniver"
 )
 
+var (
+	// Command line flags.
+	outputFormat   string
+	outputFile     string
+	sampleInterval time.Duration
+	sampleCount    int64
+	recordOpen     bool
+	httpMethod     string
+	httpHeaders    headers
+)
+
+func init() {
+	flag.StringVar(&outputFormat, "format", "text", "output format: json, csv, or text")
+	flag.StringVar(&outputFile, "output", "", "write connection records to this file instead of stdout")
+	flag.DurationVar(&sampleInterval, "interval", 0, "record a tcpinfo sample at this interval while connections are open (0 disables)")
+	flag.Int64Var(&sampleCount, "count", 0, "stop recording samples after this many (0 means unlimited)")
+	flag.BoolVar(&recordOpen, "open", false, "also record each connection as it opens, with handshake-time tcpinfo")
+	flag.StringVar(&httpMethod, "X", "GET", "HTTP method to use")
+	flag.Var(&httpHeaders, "H", "set HTTP header; repeatable: -H 'Accept: ...' -H 'Range: ...'")
+
+	flag.Usage = usage
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] [URL...]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "OPTIONS:")
+	flag.PrintDefaults()
+}
+
 func main() {
+	flag.Parse()
+
+	targets := flag.Args()
+	if len(targets) == 0 {
+		targets = []string{"https://www.golang.org/"}
+	}
+	for _, h := range httpHeaders {
+		if _, _, err := headerKeyValue(h); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			log.Fatalf("output: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	rec, err := newRecorder(out, outputFormat)
+	if err != nil {
+		log.Fatalf("format: %v", err)
+	}
+
+	var samples atomic.Int64
+	sum := newSummary()
+	report := func(target string, c *conniver.Conn, state int) {
+		switch state {
+		case conniver.Sampled:
+			if sampleCount > 0 && samples.Add(1) > sampleCount {
+				return
+			}
+		case conniver.Closed:
+			sum.add(target, c)
+		}
+		if err := rec.record(c, state); err != nil {
+			log.Printf("record: %v", err)
+		}
+	}
+
 	timeout := 15 * time.Second
 	d := net.Dialer{Timeout: timeout}
+	dial := func(ctx context.Context, network string, addr string) (*conniver.Conn, error) {
+		return conniver.DialAndWrap(ctx, network, addr, func(c *conniver.Conn, state int) {
+			report(addr, c, state)
+		}, conniver.WithDialer(&d), conniver.WithEmitOpenCallback(recordOpen), conniver.WithSampleInterval(sampleInterval))
+	}
 	cl := &http.Client{Transport: &http.Transport{
-		TLSHandshakeTimeout: timeout,
 		// Set DisableKeepAlives to true to force connection close after each request.
 		// Alternatively, we can call client.CloseIdleConnections() manually.
 		// DisableKeepAlives:     true,
 		DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
-			conn, err := d.DialContext(ctx, network, addr)
+			return dial(ctx, network, addr)
+		},
+		// Run the TLS handshake through the wrapper so it can time it separately
+		// from the TCP connect.
+		DialTLSContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			hsCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			tlsConn, err := conn.HandshakeTLS(hsCtx, &tls.Config{ServerName: host})
 			if err != nil {
+				_ = conn.Close()
 				return nil, err
 			}
-			return conniver.WrapConn(conn, func(c *conniver.Conn, state int) {
-				// The Opened-state callback is opt-in; pass
-				// conniver.WithEmitOpenCallback(true) as a third argument to
-				// WrapConn if you want a notification at connect time as well.
-				if state != conniver.Closed {
-					return
-				}
-				raw, _ := json.Marshal(c)
-				oRTT, oRTTVar := "n/a", "n/a"
-				cRTT, cRTTVar := "n/a", "n/a"
-				if c.OpenedInfo != nil {
-					oRTT = c.OpenedInfo.RTT.String()
-					oRTTVar = c.OpenedInfo.RTTVar.String()
-				}
-				if c.ClosedInfo != nil {
-					cRTT = c.ClosedInfo.RTT.String()
-					cRTTVar = c.ClosedInfo.RTTVar.String()
-				}
-				fmt.Printf("Connection %s -> %s took %s, sent:%d/recv:%d bytes, starting RTT %s(%s) and ending RTT %s(%s)\nWarnings:%s\n%s\n\n",
-					c.LocalAddrString(), c.RemoteAddrString(),
-					time.Duration(c.ClosedAt-c.OpenedAt),
-					c.TxBytes, c.RxBytes,
-					oRTT, oRTTVar,
-					cRTT, cRTTVar,
-					strings.Join(c.Warnings(), ", "),
-					string(raw),
-				)
-			}), err
+			return tlsConn, nil
 		},
 	}}
-	resp, err := cl.Get("https://www.golang.org/")
-	if err != nil {
-		log.Fatalf("get: %v", err)
+	failed := false
+	for _, target := range targets {
+		if err := fetch(cl, target); err != nil {
+			log.Printf("%s: %v", target, err)
+			failed = true
+		}
 	}
-	_ = resp.Body.Close()
 
 	// Use client.CloseIdleConnections() to trigger the closed events for all wrapped connections.
 	// Alteratively use `DisableKeepAlives: true`` in the HTTP transport.
 	cl.CloseIdleConnections()
+
+	// Keep the summary off stdout when it carries json or csv records.
+	summaryOut := io.Writer(os.Stdout)
+	if outputFormat != "text" && outputFile == "" {
+		summaryOut = os.Stderr
+	}
+	fmt.Fprintln(summaryOut)
+	if err := sum.write(summaryOut); err != nil {
+		log.Printf("summary: %v", err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// fetch issues a single request and reads the body so the transfer runs to
+// completion while samples are taken.
+func fetch(cl *http.Client, target string) error {
+	req, err := http.NewRequest(httpMethod, target, nil)
+	if err != nil {
+		return err
+	}
+	for _, h := range httpHeaders {
+		k, v, _ := headerKeyValue(h)
+		if strings.EqualFold(k, "host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Add(k, v)
+	}
+
+	resp, err := cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	return nil
+}
+
+// headers collects repeated -H flags.
+type headers []string
+
+func (h headers) String() string {
+	return strings.Join(h, ", ")
+}
+
+func (h *headers) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+func headerKeyValue(h string) (string, string, error) {
+	k, v, ok := strings.Cut(h, ":")
+	if !ok {
+		return "", "", fmt.Errorf("header %q has invalid format, missing ':'", h)
+	}
+	return strings.TrimSpace(k), strings.TrimSpace(v), nil
 }
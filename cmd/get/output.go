@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runZeroInc/conniver"
+)
+
+var csvHeader = []string{
+	"event", "local_addr", "remote_addr", "elapsed_ms", "tx_bytes", "rx_bytes",
+	"opened_rtt_ms", "opened_rttvar_ms", "rtt_ms", "rttvar_ms",
+	"retransmits", "warnings", "tls_handshake_ms", "dial_ms",
+}
+
+// recorder writes one record per closed connection, and one per periodic
+// sample when sampling is enabled, in the selected format. Report callbacks
+// can fire concurrently, so writes are serialized.
+type recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	csv    *csv.Writer
+}
+
+func newRecorder(w io.Writer, format string) (*recorder, error) {
+	r := &recorder{w: w, format: format}
+	switch format {
+	case "text", "json":
+	case "csv":
+		r.csv = csv.NewWriter(w)
+		if err := r.csv.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		r.csv.Flush()
+		if err := r.csv.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q: want json, csv, or text", format)
+	}
+	return r, nil
+}
+
+func (r *recorder) record(c *conniver.Conn, state int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.format {
+	case "json":
+		raw, err := jsonRecord(c, state)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(r.w, "%s\n", raw)
+		return err
+	case "csv":
+		if err := r.csv.Write(csvRow(c, state)); err != nil {
+			return err
+		}
+		r.csv.Flush()
+		return r.csv.Error()
+	default:
+		if state == conniver.Opened {
+			_, err := fmt.Fprintf(r.w, "Open %s -> %s: %s\n", c.LocalAddrString(), c.RemoteAddrString(), c.OpenedInfo)
+			return err
+		}
+		if state == conniver.Sampled {
+			_, err := fmt.Fprintf(r.w, "Sample %s -> %s after %s, sent:%d/recv:%d bytes: %s\n",
+				c.LocalAddrString(), c.RemoteAddrString(),
+				elapsed(c, state).Round(time.Millisecond),
+				c.TxBytes, c.RxBytes,
+				c.SampledInfo,
+			)
+			return err
+		}
+		oRTT, oRTTVar := "n/a", "n/a"
+		cRTT, cRTTVar := "n/a", "n/a"
+		if c.OpenedInfo != nil {
+			oRTT = c.OpenedInfo.RTT.String()
+			oRTTVar = c.OpenedInfo.RTTVar.String()
+		}
+		if c.ClosedInfo != nil {
+			cRTT = c.ClosedInfo.RTT.String()
+			cRTTVar = c.ClosedInfo.RTTVar.String()
+		}
+		var notes []string
+		if c.DialDuration != 0 {
+			notes = append(notes, "dial "+c.DialDuration.Round(time.Microsecond).String())
+		}
+		if c.TLSHandshakeAt != 0 {
+			notes = append(notes, "TLS handshake "+tlsHandshakeTime(c).Round(time.Microsecond).String())
+		}
+		var setupNote string
+		if len(notes) > 0 {
+			setupNote = " (" + strings.Join(notes, ", ") + ")"
+		}
+		_, err := fmt.Fprintf(r.w, "Connection %s -> %s took %s%s, sent:%d/recv:%d bytes, starting RTT %s(%s) and ending RTT %s(%s)\nWarnings:%s\n\n",
+			c.LocalAddrString(), c.RemoteAddrString(),
+			time.Duration(c.ClosedAt-c.OpenedAt), setupNote,
+			c.TxBytes, c.RxBytes,
+			oRTT, oRTTVar,
+			cRTT, cRTTVar,
+			strings.Join(c.Warnings(), ", "),
+		)
+		return err
+	}
+}
+
+// jsonRecord encodes the connection stats as a JSON object with an added
+// "event" key naming the lifecycle event that produced them.
+func jsonRecord(c *conniver.Conn, state int) ([]byte, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	event, err := json.Marshal(conniver.StateMap[state])
+	if err != nil {
+		return nil, err
+	}
+
+	// raw is always a non-empty object, since txBytes and rxBytes are never omitted.
+	out := append([]byte(`{"event":`), event...)
+	out = append(out, ',')
+	return append(out, raw[1:]...), nil
+}
+
+// elapsed returns the connection lifetime for close records and the time since
+// open for open and sample records.
+func elapsed(c *conniver.Conn, state int) time.Duration {
+	if state == conniver.Closed {
+		return time.Duration(c.ClosedAt - c.OpenedAt)
+	}
+	return time.Since(time.Unix(0, c.OpenedAt))
+}
+
+func csvRow(c *conniver.Conn, state int) []string {
+	var oRTT, oRTTVar, rtt, rttVar, retransmits string
+	if c.OpenedInfo != nil {
+		oRTT = millis(c.OpenedInfo.RTT)
+		oRTTVar = millis(c.OpenedInfo.RTTVar)
+	}
+	info := c.ClosedInfo
+	switch state {
+	case conniver.Opened:
+		info = c.OpenedInfo
+	case conniver.Sampled:
+		info = c.SampledInfo
+	}
+	if info != nil {
+		rtt = millis(info.RTT)
+		rttVar = millis(info.RTTVar)
+		retransmits = strconv.FormatUint(info.Retransmits, 10)
+	}
+	var tlsHandshake, dial string
+	if c.TLSHandshakeAt != 0 {
+		tlsHandshake = millis(tlsHandshakeTime(c))
+	}
+	if c.DialDuration != 0 {
+		dial = millis(c.DialDuration)
+	}
+	return []string{
+		conniver.StateMap[state],
+		c.LocalAddrString(),
+		c.RemoteAddrString(),
+		millis(elapsed(c, state)),
+		strconv.FormatInt(c.TxBytes, 10),
+		strconv.FormatInt(c.RxBytes, 10),
+		oRTT, oRTTVar,
+		rtt, rttVar,
+		retransmits,
+		strings.Join(c.Warnings(), ";"),
+		tlsHandshake,
+		dial,
+	}
+}
+
+// tlsHandshakeTime returns how long the TLS handshake took after the TCP
+// connect completed.
+func tlsHandshakeTime(c *conniver.Conn) time.Duration {
+	return time.Duration(c.TLSHandshakeAt - c.TCPConnectedAt)
+}
+
+func millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
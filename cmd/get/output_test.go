@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver"
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestRecorderCSV(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := newRecorder(&buf, "csv")
+	if err != nil {
+		t.Fatalf("newRecorder: %v", err)
+	}
+
+	c := &conniver.Conn{
+		TCPConnectedAt: 0,
+		TLSHandshakeAt: int64(40 * time.Millisecond),
+		DialDuration:   25 * time.Millisecond,
+		ClosedInfo:     &tcpinfo.Info{RTT: 12 * time.Millisecond, Retransmits: 2},
+	}
+	c.OpenedAt, c.ClosedAt = 0, int64(1500*time.Millisecond)
+	c.TxBytes, c.RxBytes = 100, 2048
+	if err := rec.record(c, conniver.Closed); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want header plus one record", len(rows))
+	}
+	if len(rows[1]) != len(csvHeader) {
+		t.Fatalf("record has %d columns, header has %d", len(rows[1]), len(csvHeader))
+	}
+	want := map[string]string{
+		"event":            "close",
+		"elapsed_ms":       "1500.000",
+		"rx_bytes":         "2048",
+		"rtt_ms":           "12.000",
+		"opened_rtt_ms":    "",
+		"retransmits":      "2",
+		"tls_handshake_ms": "40.000",
+		"dial_ms":          "25.000",
+	}
+	for i, name := range csvHeader {
+		if w, ok := want[name]; ok && rows[1][i] != w {
+			t.Errorf("%s = %q, want %q", name, rows[1][i], w)
+		}
+	}
+}
+
+func TestRecorderRejectsUnknownFormat(t *testing.T) {
+	if _, err := newRecorder(&bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("newRecorder accepted an unknown format")
+	}
+}
+
+func TestRecorderCSVSample(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := newRecorder(&buf, "csv")
+	if err != nil {
+		t.Fatalf("newRecorder: %v", err)
+	}
+
+	c := &conniver.Conn{
+		ClosedInfo:  &tcpinfo.Info{RTT: time.Second},
+		SampledInfo: &tcpinfo.Info{RTT: 3 * time.Millisecond},
+	}
+	c.OpenedAt = time.Now().UnixNano()
+	if err := rec.record(c, conniver.Sampled); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if rows[1][0] != "sample" || rows[1][8] != "3.000" {
+		t.Fatalf("sample row = %q, want event=sample and rtt_ms from SampledInfo", rows[1])
+	}
+}
+
+// withBytes sets the byte counters of c, which a composite literal from outside
+// the package cannot set.
+func withBytes(c *conniver.Conn, tx, rx int64) *conniver.Conn {
+	c.TxBytes, c.RxBytes = tx, rx
+	return c
+}
+
+func TestSummaryAggregatesPerTarget(t *testing.T) {
+	sum := newSummary()
+	sum.add("a:443", withBytes(&conniver.Conn{ClosedInfo: &tcpinfo.Info{RTT: 2 * time.Millisecond}}, 10, 100))
+	sum.add("b:80", withBytes(&conniver.Conn{}, 1, 1))
+	sum.add("a:443", withBytes(&conniver.Conn{OpenedInfo: &tcpinfo.Info{RTT: 4 * time.Millisecond}}, 5, 50))
+
+	a := sum.byTarget["a:443"]
+	if a.conns != 2 || a.txBytes != 15 || a.rxBytes != 150 {
+		t.Fatalf("a:443 totals = %+v", a)
+	}
+	if a.minRTT != 2*time.Millisecond || a.maxRTT != 4*time.Millisecond || a.rttSum/time.Duration(a.rttCount) != 3*time.Millisecond {
+		t.Fatalf("a:443 RTT stats = %+v", a)
+	}
+	if len(sum.order) != 2 || sum.order[0] != "a:443" {
+		t.Fatalf("order = %v, want targets in first-seen order", sum.order)
+	}
+
+	var buf bytes.Buffer
+	if err := sum.write(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.Contains(buf.String(), "n/a") {
+		t.Fatalf("summary for a target without RTT should show n/a:\n%s", buf.String())
+	}
+}
+
+func TestHeaderKeyValue(t *testing.T) {
+	k, v, err := headerKeyValue("Accept:  text/plain ")
+	if err != nil || k != "Accept" || v != "text/plain" {
+		t.Fatalf("headerKeyValue = %q, %q, %v", k, v, err)
+	}
+	if _, _, err := headerKeyValue("missing-colon"); err == nil {
+		t.Fatal("headerKeyValue accepted a header without ':'")
+	}
+}
+
+func TestRecorderJSONIncludesEvent(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := newRecorder(&buf, "json")
+	if err != nil {
+		t.Fatalf("newRecorder: %v", err)
+	}
+	if err := rec.record(withBytes(&conniver.Conn{}, 0, 7), conniver.Closed); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal(%q): %v", buf.String(), err)
+	}
+	if got["event"] != "close" || got["rxBytes"] != 7.0 {
+		t.Fatalf("record = %s", buf.String())
+	}
+}
+
+func TestRecorderOpenUsesOpenedInfo(t *testing.T) {
+	c := &conniver.Conn{OpenedInfo: &tcpinfo.Info{State: "ESTABLISHED", RTT: 7 * time.Millisecond}}
+	c.OpenedAt = time.Now().UnixNano()
+
+	var buf bytes.Buffer
+	rec, err := newRecorder(&buf, "csv")
+	if err != nil {
+		t.Fatalf("newRecorder: %v", err)
+	}
+	if err := rec.record(c, conniver.Opened); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if rows[1][0] != "open" || rows[1][8] != "7.000" {
+		t.Fatalf("open row = %q, want event=open and rtt_ms from OpenedInfo", rows[1])
+	}
+
+	buf.Reset()
+	if rec, err = newRecorder(&buf, "text"); err != nil {
+		t.Fatalf("newRecorder: %v", err)
+	}
+	if err := rec.record(c, conniver.Opened); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "Open ") || !strings.Contains(buf.String(), "rtt:7.000/") {
+		t.Fatalf("text open record = %q", buf.String())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/runZeroInc/conniver"
+)
+
+// targetStats aggregates the closed connections made to a single target.
+type targetStats struct {
+	conns    int
+	txBytes  int64
+	rxBytes  int64
+	rttSum   time.Duration
+	rttCount int
+	minRTT   time.Duration
+	maxRTT   time.Duration
+}
+
+// summary collects per-target totals across all closed connections, in the
+// order targets were first seen.
+type summary struct {
+	mu       sync.Mutex
+	order    []string
+	byTarget map[string]*targetStats
+}
+
+func newSummary() *summary {
+	return &summary{byTarget: map[string]*targetStats{}}
+}
+
+func (s *summary) add(target string, c *conniver.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, ok := s.byTarget[target]
+	if !ok {
+		ts = &targetStats{}
+		s.byTarget[target] = ts
+		s.order = append(s.order, target)
+	}
+	ts.conns++
+	ts.txBytes += c.TxBytes
+	ts.rxBytes += c.RxBytes
+
+	info := c.ClosedInfo
+	if info == nil {
+		info = c.OpenedInfo
+	}
+	if info == nil || info.RTT <= 0 {
+		return
+	}
+	ts.rttSum += info.RTT
+	ts.rttCount++
+	if ts.minRTT == 0 || info.RTT < ts.minRTT {
+		ts.minRTT = info.RTT
+	}
+	if info.RTT > ts.maxRTT {
+		ts.maxRTT = info.RTT
+	}
+}
+
+func (s *summary) write(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "TARGET\tCONNS\tSENT\tRECV\tAVG RTT\tMIN RTT\tMAX RTT\t")
+	for _, target := range s.order {
+		ts := s.byTarget[target]
+		avg, lo, hi := "n/a", "n/a", "n/a"
+		if ts.rttCount > 0 {
+			avg = (ts.rttSum / time.Duration(ts.rttCount)).String()
+			lo = ts.minRTT.String()
+			hi = ts.maxRTT.String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t\n", target, ts.conns, ts.txBytes, ts.rxBytes, avg, lo, hi)
+	}
+	return tw.Flush()
+}
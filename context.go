@@ -0,0 +1,50 @@
+package conniver
+
+import (
+	"context"
+	"net"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// connContextKey is the context key for the *Conn stored by ContextWithConn.
+type connContextKey struct{}
+
+// ContextWithConn returns a copy of ctx that carries c, for handlers and
+// middleware further down the call chain to find with ConnFromContext.
+func ContextWithConn(ctx context.Context, c *Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// ConnFromContext returns the *Conn stored in ctx by ContextWithConn, or nil.
+// In an HTTP handler, pass r.Context() to reach the connection serving the
+// request; see WrapServerConns and ConnContext. The Conn is live, so read it
+// through LatestInfo, Snapshot, or Sample rather than its fields.
+func ConnFromContext(ctx context.Context) *Conn {
+	c, _ := ctx.Value(connContextKey{}).(*Conn)
+	return c
+}
+
+// ConnContext stores the *Conn beneath c, if any, in ctx. Its signature matches
+// http.Server.ConnContext, so a server whose listener already returns
+// connections from WrapConn can expose them to handlers with:
+//
+//	srv.ConnContext = conniver.ConnContext
+//
+// WrapServerConns sets up the same for servers that do not wrap their
+// listener.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if w, ok := unwrapConn[*Conn](c); ok {
+		return ContextWithConn(ctx, w)
+	}
+	return ctx
+}
+
+// Sample reads tcpinfo for the connection now and returns it, for a
+// point-in-time view, such as the RTT to log from inside a request handler.
+// Like Samples, the reading is not folded into SampledInfo or the sampled
+// stats. It returns nil, with a nil error, for connections without tcpinfo,
+// such as those wrapped with WithoutTCPInfo or that are not TCP.
+func (w *Conn) Sample() (*tcpinfo.Info, error) {
+	return w.readTCPInfo()
+}
@@ -0,0 +1,114 @@
+package conniver
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Counter keeps the byte counters and lifetime timestamps of a stream for any
+// io.ReadWriteCloser, such as a pipe, an in-memory TLS stream, or a test
+// connection, without the socket calls Conn makes for tcpinfo. Its fields,
+// OpenedAt, ClosedAt, FirstRxAt, FirstTxAt, LastRxAt, LastTxAt, TxBytes,
+// RxBytes, RxErr, and TxErr, are shared with Conn, so they mean the same on
+// both and appear the same in JSON. Read them through Snapshot while the
+// stream is in use.
+type Counter struct {
+	counters
+	rwc       io.ReadWriteCloser
+	closeOnce sync.Once
+	closeRes  error
+	sync.Mutex
+}
+
+// counters holds the fields Counter and Conn share, which each guards with its
+// own mutex.
+type counters struct {
+	OpenedAt  int64 `json:"openedAt,omitempty"`
+	ClosedAt  int64 `json:"closedAt,omitempty"`
+	FirstRxAt int64 `json:"firstRxAt,omitempty"`
+	FirstTxAt int64 `json:"firstTxAt,omitempty"`
+	LastRxAt  int64 `json:"lastRxAt,omitempty"`
+	LastTxAt  int64 `json:"lastTxAt,omitempty"`
+	TxBytes   int64 `json:"txBytes"`
+	RxBytes   int64 `json:"rxBytes"`
+	RxErr     error `json:"rxErr,omitempty"`
+	TxErr     error `json:"txErr,omitempty"`
+}
+
+// NewCounter wraps rwc, with OpenedAt set to now.
+func NewCounter(rwc io.ReadWriteCloser) *Counter {
+	c := &Counter{rwc: rwc}
+	c.OpenedAt = time.Now().UnixNano()
+	return c
+}
+
+// Read reads from the wrapped stream and counts the bytes received.
+func (c *Counter) Read(b []byte) (int, error) {
+	n, err := c.rwc.Read(b)
+	c.Lock()
+	c.recordRxLocked(n, err)
+	c.Unlock()
+	return n, err
+}
+
+// Write writes to the wrapped stream and counts the bytes sent.
+func (c *Counter) Write(b []byte) (int, error) {
+	n, err := c.rwc.Write(b)
+	c.Lock()
+	c.recordTxLocked(n, err)
+	c.Unlock()
+	return n, err
+}
+
+// Close closes the wrapped stream and sets ClosedAt. Like Conn.Close, only the
+// first call closes the stream; later and concurrent calls wait for it and
+// return its result.
+func (c *Counter) Close() error {
+	c.closeOnce.Do(func() {
+		c.Lock()
+		c.ClosedAt = time.Now().UnixNano()
+		c.Unlock()
+		c.closeRes = c.rwc.Close()
+	})
+	return c.closeRes
+}
+
+// Snapshot returns a detached copy of the counters, taken under the lock.
+func (c *Counter) Snapshot() *Counter {
+	c.Lock()
+	defer c.Unlock()
+	return &Counter{counters: c.counters}
+}
+
+// recordRxLocked folds one Read that returned n bytes and err into the
+// receive counters.
+func (c *counters) recordRxLocked(n int, err error) {
+	countTransfer(&c.FirstRxAt, &c.LastRxAt, &c.RxBytes, &c.RxErr, n, err)
+}
+
+// recordTxLocked folds one Write that returned n bytes and err into the send
+// counters.
+func (c *counters) recordTxLocked(n int, err error) {
+	countTransfer(&c.FirstTxAt, &c.LastTxAt, &c.TxBytes, &c.TxErr, n, err)
+}
+
+// countTransfer folds one Read or Write that moved n bytes and returned err
+// into the counters for its direction. A stream may return data together with
+// an error, such as io.EOF or a short write, so the bytes and timestamps are
+// recorded whenever n > 0. Only network errors that are not timeouts are kept,
+// since a deadline expiring leaves the stream usable.
+func countTransfer(firstAt, lastAt, total *int64, lastErr *error, n int, err error) {
+	if n > 0 {
+		ts := time.Now().UnixNano()
+		if *firstAt == 0 {
+			*firstAt = ts
+		}
+		*lastAt = ts
+	}
+	*total += int64(n)
+	if err, ok := err.(net.Error); ok && !err.Timeout() {
+		*lastErr = err
+	}
+}
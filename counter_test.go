@@ -0,0 +1,71 @@
+package conniver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestCounterCountsPipeTraffic(t *testing.T) {
+	local, remote := net.Pipe()
+	c := NewCounter(local)
+
+	go func() {
+		buf := make([]byte, 5)
+		_, _ = io.ReadFull(remote, buf)
+		_, _ = remote.Write([]byte("pong!!"))
+		_ = remote.Close()
+	}()
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, err := io.ReadAll(c); err != nil || string(got) != "pong!!" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close = %v, want the first call's nil result", err)
+	}
+
+	s := c.Snapshot()
+	if s.TxBytes != 5 || s.RxBytes != 6 {
+		t.Fatalf("TxBytes = %d, RxBytes = %d; want 5 and 6", s.TxBytes, s.RxBytes)
+	}
+	if s.FirstTxAt < s.OpenedAt || s.FirstRxAt < s.FirstTxAt || s.LastRxAt < s.FirstRxAt || s.ClosedAt < s.LastRxAt {
+		t.Fatalf("timestamps out of order: %+v", s)
+	}
+	if s.RxErr != nil || s.TxErr != nil {
+		t.Fatalf("RxErr = %v, TxErr = %v; want io.EOF not recorded", s.RxErr, s.TxErr)
+	}
+}
+
+// failingCloser is a stream whose Close fails and counts its calls.
+type failingCloser struct {
+	io.ReadWriter
+	closes int
+}
+
+func (f *failingCloser) Close() error {
+	f.closes++
+	return errors.New("close failed")
+}
+
+func TestCounterCloseReturnsFirstResult(t *testing.T) {
+	rwc := &failingCloser{}
+	c := NewCounter(rwc)
+
+	first := c.Close()
+	if first == nil {
+		t.Fatal("Close = nil, want the stream's error")
+	}
+	if err := c.Close(); err != first {
+		t.Fatalf("second Close = %v, want %v", err, first)
+	}
+	if rwc.closes != 1 {
+		t.Fatalf("stream closed %d times, want 1", rwc.closes)
+	}
+}
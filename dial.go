@@ -0,0 +1,129 @@
+package conniver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DialAndWrap dials addr on the named network and wraps the resulting
+// connection like WrapConn, recording how long the dial took, including name
+// resolution and the TCP handshake, in DialDuration. The dial uses a zero
+// net.Dialer unless WithDialer supplies one.
+//
+// ctx bounds only the dial. The wrapper itself is not tied to ctx, since
+// callers such as http.Transport cancel the dial context once the connection
+// is handed over; dial with net.Dialer and call WrapConnWithContext instead to
+// stop sampling when a context is done.
+func DialAndWrap(ctx context.Context, network, addr string, reportStatsFn ReportStatsFn, opts ...WrapOption) (*Conn, error) {
+	d := newWrapOptions(opts).dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+
+	start := time.Now()
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	dialDuration := time.Since(start)
+
+	opts = append(opts[:len(opts):len(opts)], func(o *wrapOptions) { o.dialDuration = dialDuration })
+	return WrapConn(conn, reportStatsFn, opts...).(*Conn), nil
+}
+
+// Dialer dials connections and returns them wrapped, with the same report
+// callback and options for every connection. Its DialContext method has the
+// signature http.Transport and most other clients with a pluggable dialer
+// expect. Create one with NewInstrumentedDialer.
+type Dialer struct {
+	base          *net.Dialer
+	reportStatsFn ReportStatsFn
+	opts          []WrapOption
+}
+
+// NewInstrumentedDialer returns a Dialer that dials with base, or a zero
+// net.Dialer if base is nil, and wraps each connection like DialAndWrap with
+// reportStatsFn and opts. A WithDialer option is overridden by base.
+func NewInstrumentedDialer(base *net.Dialer, reportStatsFn ReportStatsFn, opts ...WrapOption) *Dialer {
+	if base == nil {
+		base = &net.Dialer{}
+	}
+	return &Dialer{
+		base:          base,
+		reportStatsFn: reportStatsFn,
+		opts:          append(opts[:len(opts):len(opts)], WithDialer(base)),
+	}
+}
+
+// DialContext dials addr like DialAndWrap and returns the *Conn as a
+// net.Conn.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := DialAndWrap(ctx, network, addr, d.reportStatsFn, d.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Dial is DialContext with a background context.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// NewTransport returns a clone of http.DefaultTransport that dials through d.
+// HTTPS connections are dialed by d as well and their TLS handshake is run by
+// Conn.HandshakeTLS, using the transport's TLSClientConfig and
+// TLSHandshakeTimeout, so the reports split the TCP connect from the TLS
+// handshake. Like http.DefaultTransport, it negotiates HTTP/2 with servers that
+// support it: a TLSClientConfig without NextProtos offers "h2" and "http/1.1"
+// through ALPN, unless HTTP/2 has been disabled on the transport, for example
+// with a non-nil, empty TLSNextProto.
+//
+// A wrapped connection reports Closed only when it is closed, and a transport
+// that keeps connections alive holds them in its idle pool until they time out.
+// Pass disableKeepAlives to close each connection after its request, or keep
+// connections alive and call CloseIdleConnections on the transport or the
+// http.Client using it once the requests are done, which closes the idle
+// connections and fires their Closed reports.
+func NewTransport(d *Dialer, disableKeepAlives bool) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DisableKeepAlives = disableKeepAlives
+	t.DialContext = d.DialContext
+	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := DialAndWrap(ctx, network, addr, d.reportStatsFn, d.opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		config := t.TLSClientConfig.Clone()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		if len(config.NextProtos) == 0 {
+			// Offer HTTP/2 whenever the transport speaks it, even with a
+			// TLSClientConfig the transport did not get to add "h2" to.
+			config.NextProtos = []string{"http/1.1"}
+			if _, ok := t.TLSNextProto["h2"]; ok {
+				config.NextProtos = []string{"h2", "http/1.1"}
+			}
+		}
+		if t.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, t.TLSHandshakeTimeout)
+			defer cancel()
+		}
+		tlsConn, err := conn.HandshakeTLS(ctx, config)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return t
+}
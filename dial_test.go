@@ -0,0 +1,110 @@
+package conniver
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestNewTransportReportsClosedConns(t *testing.T) {
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(rw, "ok")
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	var mu sync.Mutex
+	var closed []*Conn
+	d := NewInstrumentedDialer(nil, func(c *Conn, state int) {
+		if state == Closed {
+			mu.Lock()
+			closed = append(closed, c)
+			mu.Unlock()
+		}
+	})
+	tr := NewTransport(d, false)
+	tr.TLSClientConfig = &tls.Config{RootCAs: secure.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	client := &http.Client{Transport: tr}
+
+	for _, url := range []string{plain.URL, plain.URL, secure.URL} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Fatalf("GET %s body = %q, want ok", url, body)
+		}
+	}
+
+	mu.Lock()
+	if len(closed) != 0 {
+		mu.Unlock()
+		t.Fatalf("got %d Closed reports while connections were idle, want 0", len(closed))
+	}
+	mu.Unlock()
+
+	// The idle connections only report Closed once the transport closes them.
+	client.CloseIdleConnections()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(closed) != 2 {
+		t.Fatalf("got %d Closed reports after CloseIdleConnections, want 2 (one per server)", len(closed))
+	}
+	var tlsConns int
+	for _, c := range closed {
+		if c.DialDuration <= 0 || c.RxBytes == 0 {
+			t.Fatalf("Closed report = %+v, want DialDuration and RxBytes set", c)
+		}
+		if c.TLSHandshakeAt != 0 {
+			tlsConns++
+		}
+	}
+	if tlsConns != 1 {
+		t.Fatalf("%d of the Closed reports carry TLSHandshakeAt, want 1 for the HTTPS connection", tlsConns)
+	}
+}
+
+func TestNewTransportNegotiatesHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	roots := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	tr := NewTransport(NewInstrumentedDialer(nil, nil), false)
+	client := &http.Client{Transport: tr}
+	for _, step := range []string{"first request", "config replaced after first use"} {
+		// The transport adds "h2" to its own TLSClientConfig when it sets up
+		// HTTP/2, but not to one set after that.
+		tr.TLSClientConfig = &tls.Config{RootCAs: roots}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("%s: GET: %v", step, err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != 2 {
+			t.Fatalf("%s: Proto = %s, want HTTP/2.0", step, resp.Proto)
+		}
+		client.CloseIdleConnections()
+	}
+
+	tr = NewTransport(NewInstrumentedDialer(nil, nil), false)
+	tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	tr.TLSClientConfig = &tls.Config{RootCAs: roots}
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET with HTTP/2 disabled: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("Proto with HTTP/2 disabled = %s, want HTTP/1.1", resp.Proto)
+	}
+	tr.CloseIdleConnections()
+}
@@ -0,0 +1,147 @@
+package conniver
+
+import (
+	"sync"
+	"time"
+)
+
+// GroupStats aggregates the connections reported to a Groups under one key.
+// The totals include connections that have since closed; Conns and AvgRTT
+// only cover the ones still open.
+type GroupStats struct {
+	Conns       int           `json:"conns"`       // Open connections in the group
+	Closed      int64         `json:"closed"`      // Connections that have closed
+	TxBytes     int64         `json:"txBytes"`     // Bytes written by all connections
+	RxBytes     int64         `json:"rxBytes"`     // Bytes read by all connections
+	AvgRTT      time.Duration `json:"avgRTT"`      // Mean of the latest RTT of the open connections that report one
+	Retransmits uint64        `json:"retransmits"` // Latest retransmit count of every connection, summed
+}
+
+// Groups is an Observer that aggregates connections by a caller-supplied key,
+// such as the logical upstream a pooled client's connections serve. Attach the
+// same Groups to every connection with WithObservers, and read the aggregates
+// with Stats or All.
+//
+// A connection joins its group on the first state reported for it and leaves
+// on Closed, when its final counts are folded into the group's totals. Only
+// Closed is reported by default, so open connections and AvgRTT are only
+// tracked with WithEmitOpenCallback, and kept current with WithSampleInterval.
+// Connections are told apart by OpenedAt and their addresses, and the key of a
+// connection should not change while it is open. A Groups is safe for
+// concurrent use.
+type Groups struct {
+	keyFn  func(*Conn) string
+	mu     sync.Mutex
+	groups map[string]*connGroup
+}
+
+// connGroup is the state of one key: the open members with their latest
+// report, and the totals of the members that have closed.
+type connGroup struct {
+	members map[groupMemberID]groupMember
+	closed  GroupStats
+}
+
+type groupMemberID struct {
+	openedAt   int64
+	localAddr  string
+	remoteAddr string
+}
+
+type groupMember struct {
+	txBytes     int64
+	rxBytes     int64
+	rtt         time.Duration
+	retransmits uint64
+}
+
+// NewGroups returns a Groups that files each connection under keyFn(c). keyFn
+// is called with the snapshot passed to observers; Conn.LogicalRemoteAddr, set
+// by WithLogicalRemote, is a natural key for clients that dial through a pool.
+func NewGroups(keyFn func(c *Conn) string) *Groups {
+	return &Groups{keyFn: keyFn, groups: make(map[string]*connGroup)}
+}
+
+// OnState records the latest counts of c in its group, removing c from the
+// open members once it is Closed.
+func (g *Groups) OnState(c *Conn, state int) {
+	key := g.keyFn(c)
+	id := groupMemberID{
+		openedAt:   c.OpenedAt,
+		localAddr:  addrString(c.localAddr, ""),
+		remoteAddr: addrString(c.remoteAddr, ""),
+	}
+	m := groupMember{txBytes: c.TxBytes, rxBytes: c.RxBytes}
+	if info := c.LatestInfo(); info != nil {
+		m.rtt = info.RTT
+		m.retransmits = info.Retransmits
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grp := g.groups[key]
+	if grp == nil {
+		grp = &connGroup{members: make(map[groupMemberID]groupMember)}
+		g.groups[key] = grp
+	}
+	if state != Closed {
+		grp.members[id] = m
+		return
+	}
+	delete(grp.members, id)
+	grp.closed.Closed++
+	grp.closed.TxBytes += m.txBytes
+	grp.closed.RxBytes += m.rxBytes
+	grp.closed.Retransmits += m.retransmits
+}
+
+// Stats returns the aggregate for key, or false if no connection has been
+// reported under it.
+func (g *Groups) Stats(key string) (GroupStats, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grp := g.groups[key]
+	if grp == nil {
+		return GroupStats{}, false
+	}
+	return grp.stats(), true
+}
+
+// All returns the aggregate of every group, by key.
+func (g *Groups) All() map[string]GroupStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	all := make(map[string]GroupStats, len(g.groups))
+	for key, grp := range g.groups {
+		all[key] = grp.stats()
+	}
+	return all
+}
+
+// Forget drops the group for key, along with the totals of its closed
+// connections. Open connections still reported under key start a new group.
+func (g *Groups) Forget(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.groups, key)
+}
+
+func (grp *connGroup) stats() GroupStats {
+	s := grp.closed
+	s.Conns = len(grp.members)
+	var rttSum time.Duration
+	var rttCount int
+	for _, m := range grp.members {
+		s.TxBytes += m.txBytes
+		s.RxBytes += m.rxBytes
+		s.Retransmits += m.retransmits
+		if m.rtt > 0 {
+			rttSum += m.rtt
+			rttCount++
+		}
+	}
+	if rttCount > 0 {
+		s.AvgRTT = rttSum / time.Duration(rttCount)
+	}
+	return s
+}
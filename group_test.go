@@ -0,0 +1,62 @@
+package conniver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestGroupsAggregateByKey(t *testing.T) {
+	groups := NewGroups(func(c *Conn) string { return c.LogicalRemoteAddr })
+	wrap := func(port, upstream string, rtt time.Duration, retrans uint64) net.Conn {
+		conn := newFakeConn()
+		conn.localAddr = testAddr("127.0.0.1:" + port)
+		return WrapConn(conn, nil,
+			withInfoSource(func() (*tcpinfo.Info, error) {
+				return &tcpinfo.Info{RTT: rtt, Retransmits: retrans}, nil
+			}),
+			WithLogicalRemote(upstream),
+			WithEmitOpenCallback(true),
+			WithObservers(groups),
+		)
+	}
+
+	a1 := wrap("1001", "a", 10*time.Millisecond, 1)
+	a2 := wrap("1002", "a", 30*time.Millisecond, 2)
+	b1 := wrap("1003", "b", 5*time.Millisecond, 0)
+	defer b1.Close()
+
+	for _, c := range []net.Conn{a1, a2} {
+		if _, err := c.Write([]byte("hello")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := a1.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, ok := groups.Stats("a")
+	want := GroupStats{Conns: 1, Closed: 1, TxBytes: 5, AvgRTT: 30 * time.Millisecond, Retransmits: 3}
+	if !ok || got != want {
+		t.Fatalf("Stats(a) = %+v, %v; want %+v", got, ok, want)
+	}
+	if err := a2.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	got, _ = groups.Stats("a")
+	want = GroupStats{Closed: 2, TxBytes: 10, Retransmits: 3}
+	if got != want {
+		t.Fatalf("Stats(a) after close = %+v, want %+v", got, want)
+	}
+
+	all := groups.All()
+	if len(all) != 2 || all["b"].Conns != 1 || all["b"].AvgRTT != 5*time.Millisecond {
+		t.Fatalf("All() = %+v, want groups a and b", all)
+	}
+	groups.Forget("a")
+	if _, ok := groups.Stats("a"); ok {
+		t.Fatal("Stats(a) found a forgotten group")
+	}
+}
@@ -0,0 +1,99 @@
+package conniver
+
+import "sync/atomic"
+
+// Observer receives the lifecycle notifications of a wrapped Conn: Closed by
+// default, plus Opened with WithEmitOpenCallback and Sampled with
+// WithSampleInterval. Attach observers with WithObservers. Every observer of a
+// connection is called in turn, on the goroutine that triggered the state
+// change, with the same detached snapshot, which must be treated as read-only.
+type Observer interface {
+	OnState(c *Conn, state int)
+}
+
+// OnState calls f, so a ReportStatsFn can be used as an Observer.
+func (f ReportStatsFn) OnState(c *Conn, state int) {
+	f(c, state)
+}
+
+// fanOut combines the report callback passed to WrapConn with the observers
+// from WithObservers into the single callback the Conn invokes. It returns nil
+// when there is nothing to notify so the wrapper can skip taking snapshots.
+func fanOut(fn ReportStatsFn, observers []Observer) func(*Conn, int) {
+	var all []Observer
+	if fn != nil {
+		all = append(all, fn)
+	}
+	for _, o := range observers {
+		if f, ok := o.(ReportStatsFn); o == nil || ok && f == nil {
+			continue
+		}
+		all = append(all, o)
+	}
+
+	switch len(all) {
+	case 0:
+		return nil
+	case 1:
+		return all[0].OnState
+	}
+	return func(c *Conn, state int) {
+		for _, o := range all {
+			o.OnState(c, state)
+		}
+	}
+}
+
+// ReportStatsErrFn is a report callback that can fail, added with
+// WithReportStatsErrFn. The first non-nil error it returns is recorded in
+// Conn.ReportErr and stops the connection's sampler, so no further Sampled
+// states are delivered to any callback or observer. The failing callback
+// itself receives no further states, including Closed; the report callback
+// passed to WrapConn and the other observers still receive Closed.
+type ReportStatsErrFn func(c *Conn, state int) error
+
+// errReporter adapts a ReportStatsErrFn to an Observer bound to the live Conn,
+// which it tears down on failure.
+type errReporter struct {
+	w      *Conn
+	fn     ReportStatsErrFn
+	failed atomic.Bool
+}
+
+func (r *errReporter) OnState(c *Conn, state int) {
+	if r.failed.Load() {
+		return
+	}
+	if err := r.fn(c, state); err != nil {
+		r.failed.Store(true)
+		r.w.stopReporting(err)
+	}
+}
+
+// errReporters returns observers followed by an errReporter for each fn.
+func (w *Conn) errReporters(fns []ReportStatsErrFn, observers []Observer) []Observer {
+	if len(fns) == 0 {
+		return observers
+	}
+	all := append([]Observer(nil), observers...)
+	for _, fn := range fns {
+		all = append(all, &errReporter{w: w, fn: fn})
+	}
+	return all
+}
+
+// stopReporting records err as the report failure and stops the sampler. It
+// may run on the sampler goroutine, so it only signals the sampler to stop;
+// Close still waits for it to exit.
+func (w *Conn) stopReporting(err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.ReportErr == nil {
+		w.ReportErr = err
+	}
+	w.stopSamplerLocked()
+	if w.logger != nil {
+		w.logger.Warn("conniver: report callback failed, sampling stopped", "remoteAddr", addrString(w.remoteAddrLocked(), "unknown"), "error", err)
+	}
+}
@@ -0,0 +1,135 @@
+package conniver
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingObserver struct {
+	name   string
+	events *[]string
+}
+
+func (r recordingObserver) OnState(c *Conn, state int) {
+	*r.events = append(*r.events, r.name+":"+StateMap[state])
+}
+
+func TestWithObserversFanOut(t *testing.T) {
+	var events []string
+	report := func(c *Conn, state int) { events = append(events, "report:"+StateMap[state]) }
+
+	conn := WrapConn(newFakeConn(), report,
+		WithEmitOpenCallback(true),
+		WithObservers(recordingObserver{"a", &events}, nil),
+		WithObservers(ReportStatsFn(nil), recordingObserver{"b", &events}),
+	)
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := []string{"report:open", "a:open", "b:open", "report:close", "a:close", "b:close"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+}
+
+func TestWithObserversWithoutReportCallback(t *testing.T) {
+	sampledCh := make(chan struct{}, 16)
+	wrapped := WrapConn(newFakeConn(), nil,
+		WithObservers(ReportStatsFn(func(_ *Conn, state int) {
+			if state == Sampled {
+				select {
+				case sampledCh <- struct{}{}:
+				default:
+				}
+			}
+		})),
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Millisecond),
+	)
+	defer wrapped.Close()
+
+	select {
+	case <-sampledCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("observer was not notified of a sample")
+	}
+}
+
+func TestFanOutNilWhenNothingToNotify(t *testing.T) {
+	if fanOut(nil, []Observer{nil, ReportStatsFn(nil)}) != nil {
+		t.Fatal("fanOut returned a callback with nothing to notify")
+	}
+}
+
+func TestReportStatsErrFnStopsSampling(t *testing.T) {
+	errSink := errors.New("sink closed")
+	var errFnStates, reportStates []int
+	var mu sync.Mutex
+
+	wrapped := WrapConn(newFakeConn(), func(_ *Conn, state int) {
+		mu.Lock()
+		reportStates = append(reportStates, state)
+		mu.Unlock()
+	},
+		WithReportStatsErrFn(func(_ *Conn, state int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			errFnStates = append(errFnStates, state)
+			if state == Sampled {
+				return errSink
+			}
+			return nil
+		}),
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Millisecond),
+	).(*Conn)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		wrapped.Lock()
+		failed := wrapped.ReportErr != nil
+		wrapped.Unlock()
+		if failed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ReportErr was not recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Give a still-running sampler time to deliver more samples.
+	time.Sleep(20 * time.Millisecond)
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(errFnStates, []int{Sampled}) {
+		t.Fatalf("ReportStatsErrFn states = %v, want a single Sampled and nothing after the error", errFnStates)
+	}
+	if len(reportStates) != 2 || reportStates[0] != Sampled || reportStates[1] != Closed {
+		t.Fatalf("report callback states = %v, want the failed sample then Closed", reportStates)
+	}
+	if !errors.Is(wrapped.ReportErr, errSink) {
+		t.Fatalf("ReportErr = %v, want %v", wrapped.ReportErr, errSink)
+	}
+}
+
+func TestReportStatsErrFnFailingOnOpenSkipsSampler(t *testing.T) {
+	wrapped := WrapConn(newFakeConn(), nil,
+		WithEmitOpenCallback(true),
+		WithReportStatsErrFn(func(*Conn, int) error { return errors.New("no sink") }),
+		WithSampleInterval(time.Millisecond),
+	).(*Conn)
+	defer wrapped.Close()
+
+	if wrapped.sampleDone != nil || wrapped.ReportErr == nil {
+		t.Fatalf("sampler started = %v, ReportErr = %v; want no sampler and a recorded error",
+			wrapped.sampleDone != nil, wrapped.ReportErr)
+	}
+}
@@ -0,0 +1,352 @@
+package conniver
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// WrapOption configures optional behavior on a wrapped Conn. Options are passed
+// as trailing arguments to WrapConn, WrapConnWithContext, and the other
+// constructors, and are applied in order, so later options override earlier
+// ones. Calls that pass no options keep the default behavior.
+//
+// The available options are:
+//
+// Reporting:
+//   - WithEmitOpenCallback fires the report callback at connect time as well as at close.
+//   - WithObservers notifies additional Observers of every state change.
+//   - WithReportStatsErrFn adds a callback whose error stops sampling.
+//   - WithLogicalRemote labels the connection with the target it reaches
+//     through a proxy.
+//   - WithoutTCPInfo skips every tcpinfo read, keeping only the byte counters
+//     and timestamps.
+//   - WithMappedAddrs keeps IPv4-mapped IPv6 addresses instead of storing
+//     them as IPv4.
+//
+// Sampling:
+//   - WithSampleInterval polls tcpinfo periodically while the connection is open
+//     and fires the report callback in the Sampled state.
+//   - WithByteInterval also samples each time another n bytes have been
+//     transferred, for sampling that scales with transfer size.
+//   - WithSampleScheduler runs the interval sampler on a SampleScheduler
+//     shared with other connections instead of its own goroutine.
+//   - WithRTTHistory keeps the most recent sampled RTTs; see Conn.RTTHistory.
+//   - WithLossCallback reports when a sample shows the kernel entering loss
+//     recovery (Linux only).
+//   - WithStallTimeout flags open connections that move no data for a while;
+//     see Conn.Stalled.
+//   - WithRTOStormBackoff sets how many consecutive retransmission timeouts
+//     count as an RTO storm; see Conn.InRTOStorm.
+//
+// Diagnostics:
+//   - WithLogger logs failures that are otherwise only recorded on the Conn.
+//
+// Dialing:
+//   - WithDialer sets the net.Dialer used by DialAndWrap.
+//
+// Socket tuning (applied once, right after wrapping; failures are recorded in
+// Conn.SockOptErr rather than preventing the wrap):
+//   - WithNoDelay sets TCP_NODELAY.
+//   - WithKeepAlive sets the keepalive idle time, probe interval, and probe count.
+//   - WithMaxPacingRate sets SO_MAX_PACING_RATE (Linux only).
+//   - WithNotSentLowat sets TCP_NOTSENT_LOWAT (Linux only).
+//   - WithTimestamping sets SO_TIMESTAMPING to record kernel packet timestamps (Linux only).
+type WrapOption func(*wrapOptions)
+
+// Option is an alias of WrapOption.
+type Option = WrapOption
+
+type wrapOptions struct {
+	emitOpenCallback bool
+	sockOpts         []sockOpt
+	sampleInterval   time.Duration
+	sampleScheduler  *SampleScheduler
+	byteInterval     int64
+	rttHistorySize   int
+	infoSource       func() (*tcpinfo.Info, error)
+	logger           *slog.Logger
+	observers        []Observer
+	reportErrFns     []ReportStatsErrFn
+	lossFn           LossFn
+	stallTimeout     time.Duration
+	rtoStormBackoff  int
+	logicalRemote    string
+	withoutTCPInfo   bool
+	mappedAddrs      bool
+	timestamping     bool
+	dialer           *net.Dialer
+	dialDuration     time.Duration
+	openedAt         time.Time
+}
+
+// newWrapOptions applies opts in order, skipping nil entries.
+func newWrapOptions(opts []WrapOption) wrapOptions {
+	cfg := wrapOptions{}
+	for _, o := range opts {
+		if o != nil {
+			o(&cfg)
+		}
+	}
+	return cfg
+}
+
+// sockOpt applies a socket-level setting to the wrapped TCP connection.
+type sockOpt func(*net.TCPConn) error
+
+// WithEmitOpenCallback enables firing the report callback in the Opened state
+// immediately after WrapConn collects open-time tcpinfo, so the Opened snapshot
+// already carries OpenedInfo (or InfoErr). The default is to
+// only fire the callback in the Closed state and expose the open-time stats
+// via OpenedInfo on the close snapshot; enable this option only if you need a
+// separate notification at connect time.
+func WithEmitOpenCallback(enabled bool) WrapOption {
+	return func(o *wrapOptions) { o.emitOpenCallback = enabled }
+}
+
+// WithObservers adds observers that are notified of every state change after
+// the report callback passed to WrapConn, in the order given. Nil observers are
+// ignored. Repeated WithObservers options accumulate.
+func WithObservers(observers ...Observer) WrapOption {
+	return func(o *wrapOptions) { o.observers = append(o.observers, observers...) }
+}
+
+// WithReportStatsErrFn adds a callback that is notified like an observer but
+// can report a permanent failure, such as a closed downstream sink. See
+// ReportStatsErrFn for what happens after it returns an error.
+func WithReportStatsErrFn(fn ReportStatsErrFn) WrapOption {
+	return func(o *wrapOptions) {
+		if fn != nil {
+			o.reportErrFns = append(o.reportErrFns, fn)
+		}
+	}
+}
+
+// WithLogicalRemote records addr, the target the connection ultimately
+// reaches, in Conn.LogicalRemoteAddr, for connections dialed through a SOCKS or
+// HTTP proxy. RemoteAddr and the tcpinfo snapshots still describe the socket,
+// so the TCP stats cover the local-to-proxy hop, not the path to addr. Reset
+// keeps the label, like the other options.
+func WithLogicalRemote(addr string) WrapOption {
+	return func(o *wrapOptions) { o.logicalRemote = addr }
+}
+
+// WithoutTCPInfo skips the getsockopt calls that read tcpinfo at open and
+// close, for high-churn servers that only account for throughput. Reports still
+// fire as usual, with the byte counters, timestamps, and addresses, but
+// OpenedInfo and ClosedInfo stay nil, as they do on platforms without tcpinfo,
+// and no sampler is started for the sampling options or Conn.Samples.
+func WithoutTCPInfo() WrapOption {
+	return func(o *wrapOptions) { o.withoutTCPInfo = true }
+}
+
+// WithMappedAddrs controls whether the local and remote addresses stored on
+// the Conn keep the IPv4-mapped IPv6 form, ::ffff:a.b.c.d, that dual-stack
+// sockets report for IPv4 peers. By default they are stored as plain IPv4, so
+// that AddrPort and the IP bytes match connections made over IPv4 sockets
+// when aggregating by address; pass true to keep the addresses as reported.
+func WithMappedAddrs(keep bool) WrapOption {
+	return func(o *wrapOptions) { o.mappedAddrs = keep }
+}
+
+// WithSampleInterval enables a background sampler that reads tcpinfo for the
+// connection every interval until it is closed or its context is done. Each
+// sample is stored in SampledInfo and delivered to the report callback with the
+// Sampled state. A zero or negative interval disables sampling, which is the
+// default. The Sampled report, observers, and WithLossCallback run on the
+// sampler, which Close waits for, so they must not call Close on the
+// connection; start it on another goroutine instead.
+func WithSampleInterval(interval time.Duration) WrapOption {
+	return func(o *wrapOptions) { o.sampleInterval = interval }
+}
+
+// WithSampleScheduler runs the WithSampleInterval sampler on s rather than on
+// a goroutine of its own, so many connections, each with its own interval, can
+// share one goroutine. Crossings of WithByteInterval make the connection due
+// on s right away. It has no effect without a positive WithSampleInterval, and
+// a nil s keeps the per-connection goroutine.
+func WithSampleScheduler(s *SampleScheduler) WrapOption {
+	return func(o *wrapOptions) { o.sampleScheduler = s }
+}
+
+// WithByteInterval samples tcpinfo each time the connection's combined
+// TxBytes+RxBytes crosses another multiple of n. Read and Write only compare a
+// counter and wake the background sampler, which does the getsockopt, so a
+// crossing that happens while a sample is still pending is folded into it.
+// Samples are delivered exactly like those from WithSampleInterval, and the two
+// options can be combined. A zero or negative n disables byte-based sampling,
+// which is the default.
+func WithByteInterval(n int64) WrapOption {
+	return func(o *wrapOptions) { o.byteInterval = n }
+}
+
+// WithRTTHistory keeps the last size RTT samples taken by the periodic sampler
+// in a ring buffer, available via Conn.RTTHistory. It has no effect unless
+// WithSampleInterval or WithByteInterval is also set.
+func WithRTTHistory(size int) WrapOption {
+	return func(o *wrapOptions) { o.rttHistorySize = size }
+}
+
+// LossFn is called by WithLossCallback with a snapshot of the connection and
+// the loss recovery state it entered, tcpinfo.TCP_CA_Recovery or
+// tcpinfo.TCP_CA_Loss.
+type LossFn func(c *Conn, caState tcpinfo.CAState)
+
+// WithLossCallback calls fn from the sampler whenever a sample shows the
+// connection's loss recovery state (tcpinfo.Info.CAState) moving into Recovery
+// or Loss from any other state, after the Sampled report callback. It needs
+// WithSampleInterval or WithByteInterval, and only fires on Linux, the one
+// platform that reports the state.
+func WithLossCallback(fn LossFn) WrapOption {
+	return func(o *wrapOptions) { o.lossFn = fn }
+}
+
+// WithStallTimeout makes the sampler flag the connection as stalled, see
+// Conn.Stalled, once no bytes have moved in either direction for d. It needs
+// WithSampleInterval or WithByteInterval; since activity is only checked at
+// samples, a stall is detected between d and d plus one sample interval after
+// the last transfer. A zero or negative d disables stall detection, which is
+// the default.
+func WithStallTimeout(d time.Duration) WrapOption {
+	return func(o *wrapOptions) { o.stallTimeout = d }
+}
+
+// WithRTOStormBackoff sets the RTO backoff, the count of consecutive
+// retransmission timeouts, at which Conn.InRTOStorm reports the connection as
+// stuck retransmitting. Zero keeps DefaultRTOStormBackoff, and a negative n
+// disables the check.
+func WithRTOStormBackoff(n int) WrapOption {
+	return func(o *wrapOptions) { o.rtoStormBackoff = n }
+}
+
+// WithLogger sets a structured logger for failures the wrapper cannot return to
+// the caller, such as socket options that could not be applied or periodic
+// samples that could not be read. Nothing is logged by default.
+func WithLogger(logger *slog.Logger) WrapOption {
+	return func(o *wrapOptions) { o.logger = logger }
+}
+
+// WithDialer sets the dialer DialAndWrap uses, for example to set a connect
+// timeout or local address. WrapConn and the other constructors that take an
+// existing connection ignore it.
+func WithDialer(d *net.Dialer) WrapOption {
+	return func(o *wrapOptions) { o.dialer = d }
+}
+
+// withOpenedAt sets OpenedAt for WrapExistingConn.
+func withOpenedAt(t time.Time) WrapOption {
+	return func(o *wrapOptions) { o.openedAt = t }
+}
+
+// withInfoSource replaces the tcpinfo collector; it exists for tests.
+func withInfoSource(fn func() (*tcpinfo.Info, error)) WrapOption {
+	return func(o *wrapOptions) { o.infoSource = fn }
+}
+
+// WithMaxPacingRate caps the rate (in bytes per second) at which the kernel sends
+// data on the wrapped connection by setting SO_MAX_PACING_RATE right after
+// wrapping. It is only supported on Linux; elsewhere, and for connections that
+// are not TCP, the failure is recorded in SockOptErr.
+func WithMaxPacingRate(bytesPerSec uint64) WrapOption {
+	return func(o *wrapOptions) {
+		o.sockOpts = append(o.sockOpts, func(tc *net.TCPConn) error {
+			return controlFD(tc, func(fd uintptr) error {
+				return tcpinfo.SetMaxPacingRate(fd, bytesPerSec)
+			})
+		})
+	}
+}
+
+// WithNotSentLowat limits how many unsent bytes may be queued on the wrapped
+// connection by setting TCP_NOTSENT_LOWAT right after wrapping, so Write waits
+// rather than filling the send buffer. The unsent amount is reported as
+// NotSentBytes in the Linux tcpinfo. It is only supported on Linux 3.12 and
+// later; elsewhere, for values above math.MaxInt32, and for connections that
+// are not TCP, the failure is recorded in SockOptErr.
+func WithNotSentLowat(bytes uint32) WrapOption {
+	return func(o *wrapOptions) {
+		o.sockOpts = append(o.sockOpts, func(tc *net.TCPConn) error {
+			return controlFD(tc, func(fd uintptr) error {
+				return tcpinfo.SetNotSentLowat(fd, bytes)
+			})
+		})
+	}
+}
+
+// WithNoDelay sets TCP_NODELAY on the wrapped connection. Passing false
+// re-enables Nagle's algorithm, which Go disables by default.
+func WithNoDelay(noDelay bool) WrapOption {
+	return func(o *wrapOptions) {
+		o.sockOpts = append(o.sockOpts, func(tc *net.TCPConn) error {
+			if err := tc.SetNoDelay(noDelay); err != nil {
+				return fmt.Errorf("set TCP_NODELAY: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
+// WithKeepAlive enables TCP keepalive on the wrapped connection with the given
+// idle time, probe interval, and probe count. Zero values fall back to the
+// defaults described by net.KeepAliveConfig; negative values leave the current
+// setting unchanged.
+func WithKeepAlive(idle, interval time.Duration, count int) WrapOption {
+	return func(o *wrapOptions) {
+		o.sockOpts = append(o.sockOpts, func(tc *net.TCPConn) error {
+			if err := tc.SetKeepAliveConfig(net.KeepAliveConfig{
+				Enable:   true,
+				Idle:     idle,
+				Interval: interval,
+				Count:    count,
+			}); err != nil {
+				return fmt.Errorf("set keepalive: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
+// WithTimestamping enables kernel packet timestamps (SO_TIMESTAMPING) on the
+// wrapped connection and records the latest ones in Conn.LastTxTimestamp and
+// Conn.LastRxTimestamp. Unlike the wall-clock LastTxAt and LastRxAt, these are
+// taken by the kernel as data leaves for the NIC and as it arrives, or by the
+// NIC itself when it has been configured for hardware timestamps, so they
+// exclude scheduling delay in the application.
+//
+// Receive timestamps need the wrapper to read the socket directly with recvmsg,
+// so they are only recorded when WrapConn is given the *net.TCPConn itself
+// rather than, say, a *tls.Conn over it, and data that arrives just after the
+// first socket on the host enables timestamping may not be stamped yet.
+// Transmit timestamps are queued by the kernel one per Write and collected
+// after each Write and at Close, at the cost of one extra non-blocking recvmsg
+// per Write. The kernel stamps a write when its data leaves for the NIC, which
+// is often after Write returns, so the timestamp of a write may only be
+// collected by a later Write or by Close. Each timestamp carries the byte
+// offset of its write, kept in Conn.LastTxTimestampEnd, so an older write's
+// timestamp never replaces a newer one, and on a plain TCP connection
+// LastTxTimestamp belongs to the latest write once LastTxTimestampEnd equals
+// TxBytes. Only Linux supports this; elsewhere, and for connections that are
+// not TCP, the failure is recorded in SockOptErr.
+func WithTimestamping(enabled bool) WrapOption {
+	return func(o *wrapOptions) { o.timestamping = enabled }
+}
+
+// controlFD runs fn against the file descriptor of the TCP connection without
+// duplicating it.
+func controlFD(tc *net.TCPConn, fn func(fd uintptr) error) error {
+	rawConn, err := tc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		fnErr = fn(fd)
+	}); err != nil {
+		return err
+	}
+	return fnErr
+}
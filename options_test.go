@@ -0,0 +1,169 @@
+package conniver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestWrapOptionsApplyInOrder(t *testing.T) {
+	cfg := newWrapOptions([]Option{
+		WithEmitOpenCallback(true),
+		nil,
+		WithNoDelay(true),
+		WithEmitOpenCallback(false),
+	})
+
+	if cfg.emitOpenCallback {
+		t.Fatal("emitOpenCallback = true, want the later WithEmitOpenCallback(false) to win")
+	}
+	if len(cfg.sockOpts) != 1 {
+		t.Fatalf("len(sockOpts) = %d, want 1", len(cfg.sockOpts))
+	}
+}
+
+func TestWithLoggerReportsSockOptFailure(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	WrapConn(newFakeConn(), nil, WithLogger(logger), WithNoDelay(true))
+	if !strings.Contains(buf.String(), "could not apply socket options") {
+		t.Fatalf("log output = %q, want a socket option warning", buf.String())
+	}
+}
+
+func TestWithLogicalRemoteKeepsSocketPeer(t *testing.T) {
+	var closed *Conn
+	wrapped := WrapConn(newFakeConn(), func(c *Conn, state int) {
+		if state == Closed {
+			closed = c
+		}
+	}, WithLogicalRemote("example.com:443"))
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if closed.LogicalRemoteAddr != "example.com:443" || closed.RemoteAddrString() != "127.0.0.1:443" {
+		t.Fatalf("LogicalRemoteAddr = %q, RemoteAddr = %q; want the target and the proxy peer",
+			closed.LogicalRemoteAddr, closed.RemoteAddrString())
+	}
+	if m := closed.ToMap(); m["logicalRemoteAddr"] != "example.com:443" || m["remoteAddr"] != "127.0.0.1:443" {
+		t.Fatalf("ToMap() logicalRemoteAddr = %v, remoteAddr = %v", m["logicalRemoteAddr"], m["remoteAddr"])
+	}
+}
+
+func TestWithoutTCPInfoSkipsReads(t *testing.T) {
+	var reads int
+	var closed *Conn
+	wrapped := WrapConn(newFakeConn(), func(c *Conn, state int) {
+		if state == Closed {
+			closed = c
+		}
+	}, withInfoSource(func() (*tcpinfo.Info, error) {
+		reads++
+		return &tcpinfo.Info{}, nil
+	}), WithoutTCPInfo())
+
+	if _, err := wrapped.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if reads != 0 {
+		t.Fatalf("tcpinfo was read %d times, want none", reads)
+	}
+	if closed == nil || closed.TxBytes != 5 || closed.FirstTxAt == 0 {
+		t.Fatalf("Closed report = %+v, want the byte counter and timestamps", closed)
+	}
+	if closed.OpenedInfo != nil || closed.ClosedInfo != nil || closed.InfoErr != nil {
+		t.Fatalf("OpenedInfo = %v, ClosedInfo = %v, InfoErr = %v; want none", closed.OpenedInfo, closed.ClosedInfo, closed.InfoErr)
+	}
+}
+
+func TestWithoutTCPInfoStartsNoSampler(t *testing.T) {
+	wrapped := WrapConn(newFakeConn(), nil,
+		WithoutTCPInfo(),
+		WithSampleInterval(time.Millisecond),
+		WithByteInterval(1),
+	).(*Conn)
+	defer wrapped.Close()
+
+	if wrapped.sampleDone != nil || wrapped.sampling {
+		t.Fatal("a sampler was started for a connection without tcpinfo")
+	}
+	if _, ok := <-wrapped.Samples(context.Background(), time.Millisecond); ok {
+		t.Fatal("Samples sent a reading for a connection without tcpinfo")
+	}
+}
+
+func TestPermissionDeniedStopsTCPInfoReads(t *testing.T) {
+	permissionLogged.Store(false)
+	t.Cleanup(func() { permissionLogged.Store(false) })
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	for range 2 {
+		var reads int
+		wrapped := WrapConn(newFakeConn(), nil, withInfoSource(func() (*tcpinfo.Info, error) {
+			reads++
+			return nil, fmt.Errorf("%w: %w", tcpinfo.ErrPermission, syscall.EPERM)
+		}), WithLogger(logger))
+		if _, err := wrapped.Write([]byte("hello")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if err := wrapped.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		c := wrapped.(*Conn)
+		if reads != 1 {
+			t.Fatalf("tcpinfo was read %d times, want only the denied open-time read", reads)
+		}
+		if !errors.Is(c.InfoErr, tcpinfo.ErrPermission) {
+			t.Fatalf("InfoErr = %v, want ErrPermission", c.InfoErr)
+		}
+		if c.TxBytes != 5 {
+			t.Fatalf("TxBytes = %d, want 5", c.TxBytes)
+		}
+	}
+	if n := strings.Count(buf.String(), "tcpinfo access denied"); n != 1 {
+		t.Fatalf("logged %d denial warnings, want 1:\n%s", n, buf.String())
+	}
+}
+
+func TestMappedAddrsAreUnmapped(t *testing.T) {
+	mapped := &net.TCPAddr{IP: net.ParseIP("::ffff:192.0.2.7"), Port: 443}
+	for _, tc := range []struct {
+		opts   []WrapOption
+		wantV4 bool
+	}{
+		{nil, true},
+		{[]WrapOption{WithMappedAddrs(true)}, false},
+	} {
+		conn := newFakeConn()
+		conn.remoteAddr = mapped
+		wrapped := WrapConn(conn, nil, tc.opts...)
+
+		got := wrapped.RemoteAddr().(*net.TCPAddr).AddrPort()
+		if got.Addr().Is4() != tc.wantV4 || got.Addr().Unmap().String() != "192.0.2.7" || got.Port() != 443 {
+			t.Fatalf("RemoteAddr() = %v with %d options, want IPv4 %v", got, len(tc.opts), tc.wantV4)
+		}
+		_ = wrapped.Close()
+	}
+
+	v6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+	if got := unmapAddr(v6); got != net.Addr(v6) {
+		t.Fatalf("unmapAddr(%v) = %v, want it unchanged", v6, got)
+	}
+}
@@ -0,0 +1,39 @@
+package kernel
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// hz caches the result of probing the tick rate; it cannot change while the system is up.
+var hz = sync.OnceValues(func() (int, error) {
+	var res unix.Timespec
+	if err := unix.ClockGetres(unix.CLOCK_MONOTONIC_COARSE, &res); err != nil {
+		return 0, fmt.Errorf("clock_getres(CLOCK_MONOTONIC_COARSE): %w", err)
+	}
+	tick := time.Duration(res.Nano())
+	if tick <= 0 {
+		return 0, fmt.Errorf("clock_getres(CLOCK_MONOTONIC_COARSE) returned a %v resolution", tick)
+	}
+	return int((time.Second + tick/2) / tick), nil
+})
+
+// HZ returns the kernel's tick rate, CONFIG_HZ (typically 100, 250, 300, or 1000), which sets the length of a
+// jiffy. It is read from the resolution of CLOCK_MONOTONIC_COARSE, which advances once per tick, rather than from
+// sysconf(_SC_CLK_TCK), which reports the fixed USER_HZ of 100 used by /proc. The result is probed once and cached.
+func HZ() (int, error) {
+	return hz()
+}
+
+// JiffyDuration returns the length of one kernel tick, 1s/HZ. Kernel timers kept in jiffies, such as the tcp_info
+// RTO and last_* fields, are quantized to this step even when reported in microseconds or milliseconds.
+func JiffyDuration() (time.Duration, error) {
+	n, err := HZ()
+	if err != nil {
+		return 0, err
+	}
+	return time.Second / time.Duration(n), nil
+}
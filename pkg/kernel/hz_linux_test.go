@@ -0,0 +1,21 @@
+package kernel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHZ(t *testing.T) {
+	n, err := HZ()
+	if err != nil {
+		t.Fatalf("HZ: %v", err)
+	}
+	// CONFIG_HZ is configurable, but every supported architecture keeps it between 24 and 1200.
+	if n < 24 || n > 1200 {
+		t.Fatalf("HZ() = %d, want a plausible CONFIG_HZ", n)
+	}
+	jiffy, err := JiffyDuration()
+	if err != nil || jiffy != time.Second/time.Duration(n) {
+		t.Fatalf("JiffyDuration() = %v, %v; want 1s/%d", jiffy, err, n)
+	}
+}
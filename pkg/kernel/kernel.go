@@ -22,7 +22,7 @@ func (k *VersionInfo) String() string {
 }
 
 // CompareKernelVersion compares two kernel.VersionInfo structs.
-// Returns -1 if a < b, 0 if a == b, 1 it a > b
+// Returns -1 if a < b, 0 if a == b, 1 if a > b
 func CompareKernelVersion(a, b VersionInfo) int {
 	if a.Kernel < b.Kernel {
 		return -1
@@ -29,6 +29,13 @@ func TestParseRelease(t *testing.T) {
 	assertParseRelease(t, "3.12.8tag", &VersionInfo{Kernel: 3, Major: 12, Minor: 8, Flavor: "tag"}, 0)
 	assertParseRelease(t, "3.12-1-amd64", &VersionInfo{Kernel: 3, Major: 12, Minor: 0, Flavor: "-1-amd64"}, 0)
 	assertParseRelease(t, "3.8.0", &VersionInfo{Kernel: 4, Major: 8, Minor: 0}, -1)
+	// Darwin and the BSDs
+	assertParseRelease(t, "23.4.0", &VersionInfo{Kernel: 23, Major: 4, Minor: 0}, 0)
+	assertParseRelease(t, "14.0-RELEASE-p3", &VersionInfo{Kernel: 14, Major: 0, Minor: 0, Flavor: "-RELEASE-p3"}, 0)
+	assertParseRelease(t, "13.2-STABLE", &VersionInfo{Kernel: 13, Major: 2, Minor: 0, Flavor: "-STABLE"}, 0)
+	assertParseRelease(t, "7.4", &VersionInfo{Kernel: 7, Major: 4, Minor: 0}, 0)
+	assertParseRelease(t, "10.0_RC1", &VersionInfo{Kernel: 10, Major: 0, Minor: 0, Flavor: "_RC1"}, 0)
+	assertParseRelease(t, "6.4-RELEASE", &VersionInfo{Kernel: 6, Major: 4, Minor: 0, Flavor: "-RELEASE"}, 0)
 	// Errors
 	invalids := []string{
 		"3",
@@ -5,7 +5,6 @@ package kernel
 import (
 	"fmt"
 
-	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 )
 
@@ -21,32 +20,66 @@ func (k *VersionInfo) String() string {
 	return fmt.Sprintf("%d.%d %d (%s)", k.major, k.minor, k.build, k.kvi)
 }
 
-// GetKernelVersion gets the current kernel version.
+// NewVersionInfo returns a VersionInfo for the given Windows major, minor, and
+// build numbers (e.g. 10, 0, 19045 for Windows 10 22H2), for use with
+// CompareKernelVersion.
+func NewVersionInfo(major, minor, build int) VersionInfo {
+	return VersionInfo{kvi: "Unknown", major: major, minor: minor, build: build}
+}
+
+// Major returns the major version number (e.g. 10 for Windows 10 and 11).
+func (k *VersionInfo) Major() int { return k.major }
+
+// Minor returns the minor version number.
+func (k *VersionInfo) Minor() int { return k.minor }
+
+// Build returns the build number (e.g. 22000 and later for Windows 11).
+func (k *VersionInfo) Build() int { return k.build }
+
+// GetKernelVersion gets the current kernel version. The version numbers come
+// from RtlGetVersion; the BuildLabEx string is read from the registry on a
+// best-effort basis and is "Unknown" if it cannot be read.
 func GetKernelVersion() (*VersionInfo, error) {
-	KVI := &VersionInfo{"Unknown", 0, 0, 0}
+	v := uname()
+	KVI := &VersionInfo{
+		kvi:   "Unknown",
+		major: int(v.MajorVersion),
+		minor: int(v.MinorVersion),
+		build: int(v.BuildNumber),
+	}
 
 	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE)
 	if err != nil {
-		return KVI, err
+		return KVI, nil
 	}
 	defer k.Close()
 
-	blex, _, err := k.GetStringValue("BuildLabEx")
-	if err != nil {
-		return KVI, err
+	if blex, _, err := k.GetStringValue("BuildLabEx"); err == nil {
+		KVI.kvi = blex
 	}
-	KVI.kvi = blex
+	return KVI, nil
+}
 
-	// Important - dockerd.exe MUST be manifested for this API to return
-	// the correct information.
-	dwVersion, err := windows.GetVersion()
-	if err != nil {
-		return KVI, err
+// CompareKernelVersion compares two kernel.VersionInfo structs by major, minor,
+// and build number.
+// Returns -1 if a < b, 0 if a == b, 1 if a > b
+func CompareKernelVersion(a, b VersionInfo) int {
+	for _, c := range [][2]int{{a.major, b.major}, {a.minor, b.minor}, {a.build, b.build}} {
+		if c[0] < c[1] {
+			return -1
+		} else if c[0] > c[1] {
+			return 1
+		}
 	}
+	return 0
+}
 
-	KVI.major = int(dwVersion & 0xFF)
-	KVI.minor = int((dwVersion & 0xFF00) >> 8)
-	KVI.build = int((dwVersion & 0xFFFF0000) >> 16)
-
-	return KVI, nil
+// CheckKernelVersion checks if the current Windows version is newer than (or
+// equal to) the given major, minor, and build numbers.
+func CheckKernelVersion(major, minor, build int) (bool, error) {
+	v, err := GetKernelVersion()
+	if err != nil {
+		return false, err
+	}
+	return CompareKernelVersion(*v, NewVersionInfo(major, minor, build)) >= 0, nil
 }
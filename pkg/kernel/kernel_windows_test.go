@@ -0,0 +1,37 @@
+//go:build windows
+
+package kernel
+
+import "testing"
+
+func TestGetKernelVersion(t *testing.T) {
+	v, err := GetKernelVersion()
+	if err != nil {
+		t.Fatalf("Error getting kernel version: %s", err)
+	}
+	if v.Major() < 6 {
+		t.Fatalf("Invalid kernel version returned: %v", v)
+	}
+
+	ok, err := CheckKernelVersion(v.Major(), v.Minor(), v.Build())
+	if err != nil || !ok {
+		t.Fatalf("CheckKernelVersion(%d, %d, %d) = %v, %v, want true for the running version", v.Major(), v.Minor(), v.Build(), ok, err)
+	}
+}
+
+func TestCompareKernelVersion(t *testing.T) {
+	tests := []struct {
+		a, b VersionInfo
+		want int
+	}{
+		{NewVersionInfo(10, 0, 19045), NewVersionInfo(10, 0, 19045), 0},
+		{NewVersionInfo(6, 3, 9600), NewVersionInfo(10, 0, 10240), -1},
+		{NewVersionInfo(10, 0, 22000), NewVersionInfo(10, 0, 19045), 1},
+		{NewVersionInfo(10, 1, 0), NewVersionInfo(10, 0, 99999), 1},
+	}
+	for _, tt := range tests {
+		if got := CompareKernelVersion(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareKernelVersion(%v, %v) = %d, want %d", &tt.a, &tt.b, got, tt.want)
+		}
+	}
+}
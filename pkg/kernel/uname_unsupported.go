@@ -1,4 +1,4 @@
-//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !aix
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !aix && !windows
 
 package kernel
 
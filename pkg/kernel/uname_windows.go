@@ -0,0 +1,12 @@
+//go:build windows
+
+package kernel
+
+import "golang.org/x/sys/windows"
+
+// uname returns the version of the running Windows kernel. RtlGetVersion always
+// succeeds and, unlike GetVersion, reports the real version regardless of how
+// the calling executable is manifested.
+func uname() *windows.OsVersionInfoEx {
+	return windows.RtlGetVersion()
+}
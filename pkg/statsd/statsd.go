@@ -0,0 +1,158 @@
+// Package statsd pushes the key tcp_info gauges for a connection to a statsd or DogStatsD agent.
+package statsd
+
+import (
+	"errors"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// Client is the subset of a statsd client used by Emit. The method matches the Gauge method of the common
+// DogStatsD clients, so those can be passed directly; plain statsd clients need a small adapter that drops the tags.
+type Client interface {
+	Gauge(name string, value float64, tags []string, rate float64) error
+}
+
+// Prefix is prepended to every metric name. Adjust it during initialization, before any metrics are emitted.
+var Prefix = "tcpinfo."
+
+// EmitBitRates makes Emit also send delivery_rate_bits, the delivery rate in bits per second, next to the bytes per
+// second delivery_rate. Like Prefix, adjust it during initialization.
+var EmitBitRates = false
+
+// HealthPolicy is the policy the healthy gauge is evaluated against. Like Prefix, adjust it during initialization.
+var HealthPolicy = tcpinfo.DefaultHealthPolicy
+
+// PathQualityPolicy weighs the signals of the path_quality gauge; see tcpinfo.Info.PathQualityWith. Like Prefix,
+// adjust it during initialization.
+var PathQualityPolicy = tcpinfo.DefaultPathQualityPolicy
+
+// Metric names follow the tcpi tag names on the Linux SysInfo fields they come from.
+const (
+	MetricRTT              = "rtt"                // Sender's smoothed round-trip time in seconds; see tcpinfo.Info.SenderRTT
+	MetricRcvRTT           = "rcv_rtt"            // Receiver-side RTT estimate in seconds (Linux); see tcpinfo.Info.ReceiverRTT
+	MetricMinRTT           = "min_rtt"            // Minimum observed round-trip time in seconds
+	MetricSndCwnd          = "snd_cwnd"           // Congestion window in segments (Linux)
+	MetricSndCwndBytes     = "snd_cwnd_bytes"     // Congestion window in bytes; snd_cwnd × MSS on Linux
+	MetricTotalRetrans     = "total_retrans"      // Retransmitted segments or packets
+	MetricDeliveryRate     = "delivery_rate"      // Most recent delivery rate in bytes per second
+	MetricDeliveryRateBits = "delivery_rate_bits" // Most recent delivery rate in bits per second; see EmitBitRates
+	MetricBackoff          = "backoff"            // Consecutive retransmission timeouts, the RTO backoff (Linux)
+	MetricFastOpen         = "fastopen"           // tcpinfo.FastOpenState: 1 not attempted, 2 succeeded, 3 failed
+	MetricFastOpenFail     = "fastopen_fail"      // tcpinfo.FastOpenFailReason of a failed Fast Open attempt
+	MetricCwndLimited      = "cwnd_limited"       // 1 if the congestion window is below the bandwidth-delay product
+	MetricPathQuality      = "path_quality"       // Path quality score from 0 (poor) to 1 (clean) under PathQualityPolicy
+	MetricHealthy          = "healthy"            // 1 if the connection is within HealthPolicy, otherwise 0
+	MetricCERate           = "ce_rate"            // Fraction of delivered segments that were CE marked (Linux 4.18+)
+	MetricRwndLimited      = "rwnd_limited"       // 1 if the receive window limited the sender in the last sample interval
+	MetricSndbufLimited    = "sndbuf_limited"     // 1 if the send buffer limited the sender in the last sample interval
+	MetricStalledConns     = "stalled_conns"      // Number of connections conniver.Conn.Stalled reports as stalled
+)
+
+// CongestionTag returns a "congestion:<algorithm>" tag, such as "congestion:bbr", naming the congestion control
+// algorithm in info, or "congestion:unknown" when it was not read. The algorithm rarely changes after connect, so
+// compute the tag once per connection from conniver.Conn.OpenedInfo and append it to the tags passed to Emit, rather
+// than reading it on every report; comparing gauges by this tag shows, for example, bbr against cubic.
+func CongestionTag(info *tcpinfo.Info) string {
+	alg := info.CongestionAlgorithm()
+	if alg == "" {
+		alg = "unknown"
+	}
+	return "congestion:" + alg
+}
+
+// Emit sends the key gauges from info to c, tagged with tags. Gauges the platform or running kernel did not report are
+// skipped rather than sent as zero; an Info without Sys sends every gauge. The healthy gauge is always sent,
+// path_quality only when at least one of its signals is reported, backoff only on Linux, rcv_rtt only on Linux once the
+// receiver has an estimate, fastopen only where Fast Open is reported and fastopen_fail only for failed attempts,
+// cwnd_limited only when the bandwidth-delay product and the window in bytes are known, and ce_rate only when the
+// kernel counted delivered segments. Errors from the client are joined and returned after every gauge is tried.
+func Emit(c Client, info *tcpinfo.Info, tags []string) error {
+	if info == nil {
+		return nil
+	}
+
+	var errs []error
+	send := func(name string, value float64) {
+		if err := c.Gauge(Prefix+name, value, tags, 1); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	gauge := func(key, name string, value float64) {
+		if info.Sys != nil && !info.Reported(key) {
+			return
+		}
+		send(name, value)
+	}
+
+	gauge("rtt", MetricRTT, info.RTT.Seconds())
+	if rtt, ok := info.ReceiverRTT(); ok {
+		send(MetricRcvRTT, rtt.Seconds())
+	}
+	gauge("minRTT", MetricMinRTT, info.MinRTT.Seconds())
+	gauge("txCWindowSegs", MetricSndCwnd, float64(info.TxWindowSegs))
+	// Linux reports the window in segments, so the byte gauge is derived from the MSS there.
+	if info.Sys == nil || info.Reported("txCWindowBytes") || info.Reported("txCWindowSegs") && info.TxMSS > 0 {
+		send(MetricSndCwndBytes, float64(info.CwndBytes()))
+	}
+	gauge("retransmits", MetricTotalRetrans, float64(info.Retransmits))
+	gauge("deliveryRate", MetricDeliveryRate, float64(info.DeliveryRate))
+	if EmitBitRates {
+		gauge("deliveryRate", MetricDeliveryRateBits, float64(info.DeliveryRateBitsPerSec()))
+	}
+
+	if backoff, ok := info.Backoff(); ok {
+		send(MetricBackoff, float64(backoff))
+	}
+	if fo := info.FastOpen(); fo.State != tcpinfo.FastOpenUnknown {
+		send(MetricFastOpen, float64(fo.State))
+		if fo.State == tcpinfo.FastOpenFailed {
+			send(MetricFastOpenFail, float64(fo.Reason))
+		}
+	}
+	if limited, ok := info.CwndLimited(); ok {
+		var v float64
+		if limited {
+			v = 1
+		}
+		send(MetricCwndLimited, v)
+	}
+	if rate, ok := info.ECN().CERate(); ok {
+		send(MetricCERate, rate)
+	}
+
+	if score, ok := info.PathQualityWith(PathQualityPolicy); ok {
+		send(MetricPathQuality, score)
+	}
+
+	var healthy float64
+	if info.Healthy(HealthPolicy) {
+		healthy = 1
+	}
+	send(MetricHealthy, healthy)
+	return errors.Join(errs...)
+}
+
+// EmitFlowControl sends the rwnd_limited and sndbuf_limited gauges as 0 or 1, tagged with tags. Pass whether
+// conniver.Conn.FlowControlState reported FlowControlRwndLimited or FlowControlSndbufLimited, and skip the call while
+// it reports FlowControlUnknown.
+func EmitFlowControl(c Client, rwndLimited, sndbufLimited bool, tags []string) error {
+	var rwnd, sndbuf float64
+	if rwndLimited {
+		rwnd = 1
+	}
+	if sndbufLimited {
+		sndbuf = 1
+	}
+	return errors.Join(
+		c.Gauge(Prefix+MetricRwndLimited, rwnd, tags, 1),
+		c.Gauge(Prefix+MetricSndbufLimited, sndbuf, tags, 1),
+	)
+}
+
+// EmitStalled sends the stalled_conns gauge, the number of open connections for which conniver.Conn.Stalled
+// reports true, tagged with tags. Count every open connection on each reporting interval so the gauge falls back to
+// zero once the stalls clear.
+func EmitStalled(c Client, stalled int, tags []string) error {
+	return c.Gauge(Prefix+MetricStalledConns, float64(stalled), tags, 1)
+}
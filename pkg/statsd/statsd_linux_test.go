@@ -0,0 +1,121 @@
+//go:build linux
+
+package statsd
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestEmitSkipsUnreportedGauges(t *testing.T) {
+	c := &recordingClient{}
+	sys := &tcpinfo.SysInfo{
+		RTT:    time.Millisecond,
+		MinRTT: tcpinfo.NullableDuration{Valid: true, Value: 500 * time.Microsecond},
+	}
+	if err := Emit(c, sys.ToInfo(), nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+
+	var names []string
+	for _, call := range c.calls {
+		names = append(names, call.name)
+	}
+	// Without delivery_rate from the kernel, an MSS to size the cwnd in bytes, or any path quality signal, those
+	// gauges are skipped.
+	want := []string{"tcpinfo.rtt", "tcpinfo.min_rtt", "tcpinfo.snd_cwnd", "tcpinfo.total_retrans", "tcpinfo.backoff", "tcpinfo.healthy"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("gauges = %v, want %v", names, want)
+	}
+}
+
+func TestEmitCERate(t *testing.T) {
+	c := &recordingClient{}
+	sys := &tcpinfo.SysInfo{
+		Delivered:   tcpinfo.NullableUint32{Valid: true, Value: 400},
+		DeliveredCE: tcpinfo.NullableUint32{Valid: true, Value: 4},
+	}
+	if err := Emit(c, sys.ToInfo(), nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	for _, call := range c.calls {
+		if call.name == "tcpinfo.ce_rate" {
+			if call.value != 0.01 {
+				t.Fatalf("ce_rate = %v, want 0.01", call.value)
+			}
+			return
+		}
+	}
+	t.Fatal("Emit did not send ce_rate")
+}
+
+func TestEmitCwndBytesFromSegments(t *testing.T) {
+	c := &recordingClient{}
+	sys := &tcpinfo.SysInfo{TxMSS: 1448, TxCWindow: 10}
+	if err := Emit(c, sys.ToInfo(), nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	for _, call := range c.calls {
+		if call.name == Prefix+MetricSndCwndBytes {
+			if call.value != 14480 {
+				t.Fatalf("snd_cwnd_bytes = %v, want 14480", call.value)
+			}
+			return
+		}
+	}
+	t.Fatal("Emit did not send snd_cwnd_bytes")
+}
+
+func TestEmitBackoff(t *testing.T) {
+	c := &recordingClient{}
+	sys := &tcpinfo.SysInfo{Backoff: 4}
+	if err := Emit(c, sys.ToInfo(), nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	i := slices.IndexFunc(c.calls, func(call gaugeCall) bool { return call.name == Prefix+MetricBackoff })
+	if i < 0 || c.calls[i].value != 4 {
+		t.Fatalf("gauges = %v, want backoff 4", c.calls)
+	}
+}
+
+func TestEmitFastOpen(t *testing.T) {
+	c := &recordingClient{}
+	sys := &tcpinfo.SysInfo{FastOpenClientFail: tcpinfo.NullableUint8{Valid: true, Value: 2}}
+	if err := Emit(c, sys.ToInfo(), nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	got := map[string]float64{}
+	for _, call := range c.calls {
+		got[call.name] = call.value
+	}
+	if got[Prefix+MetricFastOpen] != float64(tcpinfo.FastOpenFailed) || got[Prefix+MetricFastOpenFail] != 2 {
+		t.Fatalf("gauges = %v, want fastopen failed with reason 2", c.calls)
+	}
+}
+
+func TestEmitReceiverRTT(t *testing.T) {
+	c := &recordingClient{}
+	sys := &tcpinfo.SysInfo{RTT: 2 * time.Millisecond, RxRTT: 8 * time.Millisecond}
+	if err := Emit(c, sys.ToInfo(), nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	got := map[string]float64{}
+	for _, call := range c.calls {
+		got[call.name] = call.value
+	}
+	if got[Prefix+MetricRTT] != 0.002 || got[Prefix+MetricRcvRTT] != 0.008 {
+		t.Fatalf("gauges = %v, want rtt 0.002 and rcv_rtt 0.008", c.calls)
+	}
+}
+
+func TestCongestionTag(t *testing.T) {
+	if got := CongestionTag((&tcpinfo.SysInfo{CCAlgorithm: "bbr"}).ToInfo()); got != "congestion:bbr" {
+		t.Fatalf("CongestionTag(bbr) = %q, want congestion:bbr", got)
+	}
+	if got := CongestionTag((&tcpinfo.SysInfo{}).ToInfo()); got != "congestion:unknown" {
+		t.Fatalf("CongestionTag without an algorithm = %q, want congestion:unknown", got)
+	}
+}
@@ -0,0 +1,158 @@
+package statsd
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+type gaugeCall struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+type recordingClient struct {
+	calls []gaugeCall
+	err   error
+}
+
+func (r *recordingClient) Gauge(name string, value float64, tags []string, _ float64) error {
+	r.calls = append(r.calls, gaugeCall{name, value, tags})
+	return r.err
+}
+
+func TestEmit(t *testing.T) {
+	c := &recordingClient{}
+	info := &tcpinfo.Info{RTT: 20 * time.Millisecond, TxWindowSegs: 10, DeliveryRate: 125000}
+	if err := Emit(c, info, []string{"target:example.com"}); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+
+	got := map[string]float64{}
+	for _, call := range c.calls {
+		if !slices.Equal(call.tags, []string{"target:example.com"}) {
+			t.Fatalf("%s tags = %v", call.name, call.tags)
+		}
+		got[call.name] = call.value
+	}
+	want := map[string]float64{
+		"tcpinfo.rtt":            0.02,
+		"tcpinfo.min_rtt":        0,
+		"tcpinfo.snd_cwnd":       10,
+		"tcpinfo.snd_cwnd_bytes": 0,
+		"tcpinfo.total_retrans":  0,
+		"tcpinfo.delivery_rate":  125000,
+		"tcpinfo.healthy":        1,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("gauges = %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %v, want %v", name, got[name], value)
+		}
+	}
+}
+
+func TestEmitBitRates(t *testing.T) {
+	defer func(enabled bool) { EmitBitRates = enabled }(EmitBitRates)
+	EmitBitRates = true
+
+	c := &recordingClient{}
+	if err := Emit(c, &tcpinfo.Info{DeliveryRate: 125000}, nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	got := map[string]float64{}
+	for _, call := range c.calls {
+		got[call.name] = call.value
+	}
+	if got[Prefix+MetricDeliveryRate] != 125000 || got[Prefix+MetricDeliveryRateBits] != 1e6 {
+		t.Fatalf("gauges = %v, want delivery_rate 125000 and delivery_rate_bits 1e6", got)
+	}
+}
+
+func TestEmitCwndLimited(t *testing.T) {
+	for _, tt := range []struct {
+		cwndSegs uint64
+		want     float64
+	}{
+		{10, 1},  // 14480 bytes against a 125000 byte BDP
+		{100, 0}, // 144800 bytes
+	} {
+		c := &recordingClient{}
+		info := &tcpinfo.Info{MinRTT: 10 * time.Millisecond, DeliveryRate: 12500000, TxWindowSegs: tt.cwndSegs, TxMSS: 1448}
+		if err := Emit(c, info, nil); err != nil {
+			t.Fatalf("Emit: %v", err)
+		}
+		i := slices.IndexFunc(c.calls, func(call gaugeCall) bool { return call.name == Prefix+MetricCwndLimited })
+		if i < 0 || c.calls[i].value != tt.want {
+			t.Fatalf("cwnd %d segments: gauges = %v, want cwnd_limited %v", tt.cwndSegs, c.calls, tt.want)
+		}
+	}
+}
+
+func TestCongestionTagUnknownWithoutSys(t *testing.T) {
+	for _, info := range []*tcpinfo.Info{nil, {}} {
+		if got := CongestionTag(info); got != "congestion:unknown" {
+			t.Fatalf("CongestionTag(%v) = %q, want congestion:unknown", info, got)
+		}
+	}
+}
+
+func TestEmitJoinsClientErrors(t *testing.T) {
+	errAgent := errors.New("agent unreachable")
+	c := &recordingClient{err: errAgent}
+	if err := Emit(c, &tcpinfo.Info{}, nil); !errors.Is(err, errAgent) {
+		t.Fatalf("Emit error = %v, want %v", err, errAgent)
+	}
+	if len(c.calls) != 7 {
+		t.Fatalf("Emit stopped after %d gauges, want all 7 attempted", len(c.calls))
+	}
+}
+
+func TestEmitHealthyFollowsPolicy(t *testing.T) {
+	defer func(p tcpinfo.HealthPolicy) { HealthPolicy = p }(HealthPolicy)
+	HealthPolicy = tcpinfo.HealthPolicy{MaxRTT: 10 * time.Millisecond}
+
+	c := &recordingClient{}
+	if err := Emit(c, &tcpinfo.Info{RTT: 20 * time.Millisecond}, nil); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	last := c.calls[len(c.calls)-1]
+	if last.name != "tcpinfo.healthy" || last.value != 0 {
+		t.Fatalf("last gauge = %s %v, want tcpinfo.healthy 0", last.name, last.value)
+	}
+}
+
+func TestEmitFlowControl(t *testing.T) {
+	c := &recordingClient{}
+	if err := EmitFlowControl(c, false, true, []string{"target:example.com"}); err != nil {
+		t.Fatalf("EmitFlowControl: %v", err)
+	}
+	want := []gaugeCall{
+		{Prefix + MetricRwndLimited, 0, []string{"target:example.com"}},
+		{Prefix + MetricSndbufLimited, 1, []string{"target:example.com"}},
+	}
+	if !slices.EqualFunc(c.calls, want, func(a, b gaugeCall) bool {
+		return a.name == b.name && a.value == b.value && slices.Equal(a.tags, b.tags)
+	}) {
+		t.Fatalf("calls = %v, want %v", c.calls, want)
+	}
+}
+
+func TestEmitStalled(t *testing.T) {
+	c := &recordingClient{}
+	if err := EmitStalled(c, 2, []string{"service:api"}); err != nil {
+		t.Fatalf("EmitStalled: %v", err)
+	}
+	want := []gaugeCall{{Prefix + MetricStalledConns, 2, []string{"service:api"}}}
+	if !slices.EqualFunc(c.calls, want, func(a, b gaugeCall) bool {
+		return a.name == b.name && a.value == b.value && slices.Equal(a.tags, b.tags)
+	}) {
+		t.Fatalf("calls = %v, want %v", c.calls, want)
+	}
+}
@@ -0,0 +1,104 @@
+//go:build linux || darwin
+
+package tcpinfo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Errors from syscall package are private, so we define our own to match the errno.
+var (
+	EAGAIN error = syscall.EAGAIN
+	EINVAL error = syscall.EINVAL
+	ENOENT error = syscall.ENOENT
+)
+
+// errnoErr maps the errno returned by a raw getsockopt call to the package-level error values. Errnos that mean
+// the option is not available on this socket or stack wrap ErrUnsupported, errnos that mean the socket is gone
+// wrap ErrConnClosed, and errnos that mean a sandbox refused the call wrap ErrPermission, so callers can branch
+// with errors.Is without knowing the platform errno.
+func errnoErr(errNo unix.Errno) error {
+	switch errNo {
+	case unix.EAGAIN:
+		return EAGAIN
+	case unix.EINVAL:
+		return EINVAL
+	case unix.ENOENT:
+		return fmt.Errorf("%w: %w", ErrConnClosed, ENOENT)
+	case unix.EBADF, unix.ENOTCONN, unix.ECONNRESET:
+		return fmt.Errorf("%w: %w", ErrConnClosed, errNo)
+	case unix.ENOPROTOOPT, unix.EOPNOTSUPP:
+		return fmt.Errorf("%w: %w", ErrUnsupported, errNo)
+	case unix.EPERM, unix.EACCES:
+		return fmt.Errorf("%w: %w", ErrPermission, errNo)
+	}
+	return errNo
+}
+
+// socketErr is errnoErr for a failed TCP-level getsockopt on fd. When the failure is because fd is not a TCP
+// socket, it returns ErrNotTCP naming what the socket is, instead of whichever errno that socket family uses for
+// an unknown option.
+func socketErr(fd uintptr, errNo unix.Errno) error {
+	switch errNo {
+	case unix.EINVAL, unix.ENOPROTOOPT, unix.EOPNOTSUPP:
+		if err := checkTCPSocket(int(fd)); err != nil {
+			return err
+		}
+	}
+	return errnoErr(errNo)
+}
+
+// checkTCPSocket returns an error wrapping ErrNotTCP unless fd is a stream socket with an IPv4 or IPv6 address. It
+// returns nil when the socket cannot be inspected, leaving the caller's errno as the more useful answer.
+func checkTCPSocket(fd int) error {
+	typ, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TYPE)
+	if err != nil {
+		return nil
+	}
+	sa, err := unix.Getsockname(fd)
+	if err != nil {
+		return nil
+	}
+
+	var family string
+	switch sa.(type) {
+	case *unix.SockaddrInet4:
+		family = "ipv4"
+	case *unix.SockaddrInet6:
+		family = "ipv6"
+	case *unix.SockaddrUnix:
+		family = "unix"
+	default:
+		family = fmt.Sprintf("%T", sa)
+	}
+	if typ == unix.SOCK_STREAM && (family == "ipv4" || family == "ipv6") {
+		return nil
+	}
+
+	kind := "type " + strconv.Itoa(typ)
+	switch typ {
+	case unix.SOCK_STREAM:
+		kind = "stream"
+	case unix.SOCK_DGRAM:
+		kind = "datagram"
+	case unix.SOCK_SEQPACKET:
+		kind = "seqpacket"
+	case unix.SOCK_RAW:
+		kind = "raw"
+	}
+	return fmt.Errorf("%w (%s %s socket)", ErrNotTCP, family, kind)
+}
+
+// sockoptErr applies errnoErr to errors returned by the x/sys/unix getsockopt helpers.
+func sockoptErr(err error) error {
+	var errNo unix.Errno
+	if errors.As(err, &errNo) {
+		return errnoErr(errNo)
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+//go:build windows
+
+package tcpinfo
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// Errors from syscall package are private, so we define our own to match the errno.
+var (
+	EAGAIN error = syscall.EAGAIN
+	EINVAL error = syscall.EINVAL
+	ENOENT error = syscall.ENOENT
+)
+
+// soType is SO_TYPE from winsock2.h, which x/sys/windows does not define.
+const soType = 0x1008
+
+// wsaErr maps a WSAIoctl failure on fd to the package-level sentinel errors where the cause is known. When the
+// ioctl is rejected because fd is not a TCP socket, it returns ErrNotTCP naming what the socket is.
+func wsaErr(fd syscall.Handle, err error) error {
+	switch err {
+	case windows.WSAEOPNOTSUPP, windows.WSAEINVAL:
+		if notTCP := checkTCPSocket(windows.Handle(fd)); notTCP != nil {
+			return notTCP
+		}
+		return fmt.Errorf("%w: %w", ErrUnsupported, err)
+	case windows.WSAENOTSOCK, windows.WSAENOTCONN, windows.WSAECONNRESET, windows.WSAESHUTDOWN:
+		return fmt.Errorf("%w: %w", ErrConnClosed, err)
+	case windows.WSAEACCES, windows.ERROR_ACCESS_DENIED:
+		return fmt.Errorf("%w: %w", ErrPermission, err)
+	}
+	return err
+}
+
+// checkTCPSocket returns an error wrapping ErrNotTCP unless fd is a stream socket with an IPv4 or IPv6 address. It
+// returns nil when the socket cannot be inspected, leaving the caller's error as the more useful answer.
+func checkTCPSocket(fd windows.Handle) error {
+	typ, err := windows.GetsockoptInt(fd, windows.SOL_SOCKET, soType)
+	if err != nil {
+		return nil
+	}
+	sa, err := windows.Getsockname(fd)
+	if err != nil {
+		return nil
+	}
+
+	var family string
+	switch sa.(type) {
+	case *windows.SockaddrInet4:
+		family = "ipv4"
+	case *windows.SockaddrInet6:
+		family = "ipv6"
+	case *windows.SockaddrUnix:
+		family = "unix"
+	default:
+		family = fmt.Sprintf("%T", sa)
+	}
+	if typ == windows.SOCK_STREAM && (family == "ipv4" || family == "ipv6") {
+		return nil
+	}
+
+	kind := "type " + strconv.Itoa(typ)
+	switch typ {
+	case windows.SOCK_STREAM:
+		kind = "stream"
+	case windows.SOCK_DGRAM:
+		kind = "datagram"
+	case windows.SOCK_SEQPACKET:
+		kind = "seqpacket"
+	case windows.SOCK_RAW:
+		kind = "raw"
+	}
+	return fmt.Errorf("%w (%s %s socket)", ErrNotTCP, family, kind)
+}
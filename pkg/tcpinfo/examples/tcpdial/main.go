@@ -21,23 +21,16 @@ func main() {
 	}
 
 	rawConn, err := sysConn.SyscallConn()
-	if err != nil {
-		return
-	}
-
-	var sysInfo *tcpinfo.SysInfo
-	if err := rawConn.Control(func(fd uintptr) {
-		// Pass the `fd` to GetTCPInfo here
-		sysInfo, err = tcpinfo.GetTCPInfo(fd)
-	}); err != nil {
-		panic(err)
-	}
 	if err != nil {
 		panic(err)
 	}
-	if sysInfo == nil {
-		panic("tcpinfo unavailable for live TCP connection")
+
+	// GetTCPInfoConn reads tcp_info inside rawConn.Control, without duplicating the descriptor.
+	info, err := tcpinfo.GetTCPInfoConn(rawConn)
+	if info == nil {
+		panic(fmt.Sprintf("tcpinfo unavailable for live TCP connection: %v", err))
 	}
+	sysInfo := info.Sys
 
 	jb, _ := json.MarshalIndent(sysInfo, "", "  ")
 	fmt.Printf("%s\n", string(jb))
@@ -0,0 +1,35 @@
+//go:build darwin
+
+package tcpinfo
+
+import (
+	"sync"
+
+	"github.com/runZeroInc/conniver/pkg/kernel"
+)
+
+var darwinKernelVersion *kernel.VersionInfo
+
+// TCP_CONNECTION_INFO first shipped with Darwin 15 (OS X 10.11); older kernels reject the option outright.
+var darwinKernelVersionIsAtLeast_15 = false
+
+// kernelVersionOnce makes the kernel version probe lazy, so importing the package has no runtime side effects. The
+// probe runs on the first call to GetTCPInfo or Supported.
+var kernelVersionOnce sync.Once
+
+// ensureKernelVersion probes the running kernel once and sets darwinKernelVersionIsAtLeast_15.
+func ensureKernelVersion() {
+	kernelVersionOnce.Do(adaptToKernelVersion)
+}
+
+func adaptToKernelVersion() {
+	if darwinKernelVersion == nil {
+		var err error
+		darwinKernelVersion, err = kernel.GetKernelVersion()
+		if err != nil {
+			// Assume a supported kernel and let getsockopt report the real answer.
+			darwinKernelVersion = &kernel.VersionInfo{Kernel: 15}
+		}
+	}
+	darwinKernelVersionIsAtLeast_15 = kernel.CompareKernelVersion(*darwinKernelVersion, kernel.VersionInfo{Kernel: 15}) >= 0
+}
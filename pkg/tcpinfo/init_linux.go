@@ -10,6 +10,8 @@
 package tcpinfo
 
 import (
+	"sync"
+
 	"github.com/runZeroInc/conniver/pkg/kernel"
 )
 
@@ -46,7 +48,7 @@ var tcpInfoSizes = []VersionedStructSize{
 	{Version: kernel.VersionInfo{Kernel: 4, Major: 1, Minor: 0}, Size: 136, Flag: &kernelVersionIsAtLeast_4_1},
 	{Version: kernel.VersionInfo{Kernel: 4, Major: 2, Minor: 0}, Size: 144, Flag: &kernelVersionIsAtLeast_4_2},
 	{Version: kernel.VersionInfo{Kernel: 4, Major: 6, Minor: 0}, Size: 160, Flag: &kernelVersionIsAtLeast_4_6},
-	{Version: kernel.VersionInfo{Kernel: 4, Major: 9, Minor: 0}, Size: 148, Flag: &kernelVersionIsAtLeast_4_9},
+	{Version: kernel.VersionInfo{Kernel: 4, Major: 9, Minor: 0}, Size: 168, Flag: &kernelVersionIsAtLeast_4_9},
 	{Version: kernel.VersionInfo{Kernel: 4, Major: 10, Minor: 0}, Size: 192, Flag: &kernelVersionIsAtLeast_4_10},
 	{Version: kernel.VersionInfo{Kernel: 4, Major: 18, Minor: 0}, Size: 200, Flag: &kernelVersionIsAtLeast_4_18},
 	{Version: kernel.VersionInfo{Kernel: 4, Major: 19, Minor: 0}, Size: 224, Flag: &kernelVersionIsAtLeast_4_19},
@@ -56,8 +58,13 @@ var tcpInfoSizes = []VersionedStructSize{
 	{Version: kernel.VersionInfo{Kernel: 6, Major: 7, Minor: 0}, Size: 248, Flag: &kernelVersionIsAtLeast_6_7},
 }
 
-func init() {
-	adaptToKernelVersion()
+// kernelVersionOnce makes the kernel version probe lazy, so importing the package has no runtime side effects. The
+// probe runs on the first call that needs the version: GetTCPInfo and its variants, Supported, or Unpack.
+var kernelVersionOnce sync.Once
+
+// ensureKernelVersion probes the running kernel once and sets sizeOfRawTCPInfo and the kernelVersionIsAtLeast flags.
+func ensureKernelVersion() {
+	kernelVersionOnce.Do(adaptToKernelVersion)
 }
 
 func adaptToKernelVersion() {
@@ -0,0 +1,63 @@
+package tcpinfo
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// LineProtocol serializes the numeric fields of i as one InfluxDB line-protocol point named measurement, with
+// tags as its tag set and t as its timestamp. Field names are the ToMap keys, durations are integer nanoseconds,
+// and booleans are 0 or 1. Like MarshalJSONCompact, fields the platform did not report are left out when Sys is
+// set. Tags with an empty value are dropped, and a zero t omits the timestamp so the server assigns one. A nil Info
+// returns "", since a point needs at least one field.
+func (i *Info) LineProtocol(measurement string, tags map[string]string, t time.Time) string {
+	if i == nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		if k == "" || tags[k] == "" {
+			continue
+		}
+		b.WriteString("," + tagEscaper.Replace(k) + "=" + tagEscaper.Replace(tags[k]))
+	}
+
+	m := i.ToMap()
+	sep := " "
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		if i.Sys != nil && !i.Reported(key) {
+			continue
+		}
+		var value int64
+		switch v := m[key].(type) {
+		case uint8:
+			value = int64(v)
+		case uint64:
+			value = int64(v)
+		case time.Duration:
+			value = int64(v)
+		case bool:
+			if v {
+				value = 1
+			}
+		default:
+			continue
+		}
+		b.WriteString(sep + key + "=" + strconv.FormatInt(value, 10) + "i")
+		sep = ","
+	}
+
+	if !t.IsZero() {
+		b.WriteString(" " + strconv.FormatInt(t.UnixNano(), 10))
+	}
+	return b.String()
+}
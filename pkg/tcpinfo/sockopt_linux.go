@@ -0,0 +1,51 @@
+//go:build linux
+
+package tcpinfo
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetMaxPacingRate sets SO_MAX_PACING_RATE on the socket, capping the rate (in bytes per second) at which the
+// kernel paces outgoing data. Pacing is enforced by the fq qdisc or, since Linux 4.13, by TCP itself. The value
+// can be read back through the MaxPacingRate field returned by GetTCPInfo.
+func SetMaxPacingRate(fd uintptr, bytesPerSec uint64) error {
+	var err error
+	if bytesPerSec <= math.MaxUint32 {
+		// The 32-bit form is accepted by every kernel that supports the option (3.13+).
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MAX_PACING_RATE, int(int32(uint32(bytesPerSec))))
+	} else {
+		err = unix.SetsockoptUint64(int(fd), unix.SOL_SOCKET, unix.SO_MAX_PACING_RATE, bytesPerSec)
+	}
+	if err != nil {
+		return fmt.Errorf("set SO_MAX_PACING_RATE: %w", sockoptErr(err))
+	}
+	return nil
+}
+
+// SetNotSentLowat sets TCP_NOTSENT_LOWAT on the socket, limiting how many bytes the application may queue beyond
+// what has already been sent. Once more than bytes are unsent, writes wait instead of filling the send buffer,
+// which keeps queued data, and the latency it adds, small. The unsent amount is reported by GetTCPInfo as
+// NotSentBytes. The option needs Linux 3.12 or later; bytes must fit in a signed 32-bit integer.
+func SetNotSentLowat(fd uintptr, bytes uint32) error {
+	if bytes > math.MaxInt32 {
+		return fmt.Errorf("set TCP_NOTSENT_LOWAT: %d bytes exceeds the maximum of %d", bytes, math.MaxInt32)
+	}
+	if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_NOTSENT_LOWAT, int(bytes)); err != nil {
+		return fmt.Errorf("set TCP_NOTSENT_LOWAT: %w", sockoptErr(err))
+	}
+	return nil
+}
+
+// SocketInode returns the inode number of the socket, the value shown as socket:[inode] under /proc/self/fd and
+// in the inode column of /proc/net/tcp, so a connection can be joined with those tables and with eBPF traces.
+func SocketInode(fd uintptr) (uint64, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(int(fd), &st); err != nil {
+		return 0, fmt.Errorf("fstat socket: %w", err)
+	}
+	return st.Ino, nil
+}
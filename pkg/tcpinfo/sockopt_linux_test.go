@@ -0,0 +1,133 @@
+//go:build linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"math"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// loopbackTCPConn returns the client side of an established loopback TCP connection.
+func loopbackTCPConn(t testing.TB) *net.TCPConn {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if peer, ok := <-accepted; ok {
+		t.Cleanup(func() { _ = peer.Close() })
+	}
+	return conn.(*net.TCPConn)
+}
+
+func controlFD(t *testing.T, conn *net.TCPConn, fn func(fd uintptr)) {
+	t.Helper()
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+	if err := rawConn.Control(fn); err != nil {
+		t.Fatalf("Control: %v", err)
+	}
+}
+
+func TestSetMaxPacingRate(t *testing.T) {
+	conn := loopbackTCPConn(t)
+
+	const rate = 1 << 20
+	var setErr error
+	var sysInfo *SysInfo
+	controlFD(t, conn, func(fd uintptr) {
+		if setErr = SetMaxPacingRate(fd, rate); setErr == nil {
+			sysInfo, _ = GetTCPInfo(fd)
+		}
+	})
+	if errors.Is(setErr, ErrUnsupported) {
+		t.Skipf("skipping: pacing is not supported by this network stack: %v", setErr)
+	}
+	if setErr != nil {
+		t.Fatalf("SetMaxPacingRate: %v", setErr)
+	}
+	if sysInfo == nil || !sysInfo.MaxPacingRate.Valid {
+		t.Skip("skipping: tcp_info does not report max_pacing_rate on this kernel")
+	}
+	if sysInfo.MaxPacingRate.Value != rate {
+		t.Fatalf("MaxPacingRate = %d, want %d", sysInfo.MaxPacingRate.Value, rate)
+	}
+}
+
+func TestSetNotSentLowat(t *testing.T) {
+	conn := loopbackTCPConn(t)
+
+	const lowat = 16 << 10
+	var setErr error
+	controlFD(t, conn, func(fd uintptr) {
+		setErr = SetNotSentLowat(fd, lowat)
+	})
+	if errors.Is(setErr, ErrUnsupported) {
+		t.Skipf("skipping: TCP_NOTSENT_LOWAT is not supported by this network stack: %v", setErr)
+	}
+	if setErr != nil {
+		t.Fatalf("SetNotSentLowat: %v", setErr)
+	}
+	controlFD(t, conn, func(fd uintptr) {
+		if got, err := unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_NOTSENT_LOWAT); err != nil || got != lowat {
+			t.Fatalf("TCP_NOTSENT_LOWAT = %d, %v; want %d", got, err, lowat)
+		}
+	})
+
+	// The peer never reads, so once its receive window is full everything else stays unsent. The low-water mark
+	// must stop writes from queueing much more than lowat on top of that.
+	if err := conn.SetWriteDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+		t.Fatalf("SetWriteDeadline: %v", err)
+	}
+	if _, err := conn.Write(make([]byte, 16<<20)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write error = %v, want the write to stall on the deadline", err)
+	}
+	var sysInfo *SysInfo
+	controlFD(t, conn, func(fd uintptr) {
+		sysInfo, _ = GetTCPInfo(fd)
+	})
+	if sysInfo == nil || !sysInfo.NotSentBytes.Valid {
+		t.Skip("skipping: tcp_info does not report notsent_bytes on this kernel")
+	}
+	// The kernel checks the mark between buffer allocations, so a send may overshoot it by up to a 64KB TSO
+	// chunk. Without the mark, megabytes stay queued.
+	if limit := uint32(lowat + 128<<10); sysInfo.NotSentBytes.Value > limit {
+		t.Fatalf("NotSentBytes = %d, want at most %d with TCP_NOTSENT_LOWAT=%d", sysInfo.NotSentBytes.Value, limit, lowat)
+	}
+}
+
+func TestSetNotSentLowatRejectsOversizedValue(t *testing.T) {
+	conn := loopbackTCPConn(t)
+	controlFD(t, conn, func(fd uintptr) {
+		if err := SetNotSentLowat(fd, math.MaxUint32); err == nil {
+			t.Fatal("SetNotSentLowat accepted a value that does not fit in an int")
+		}
+	})
+}
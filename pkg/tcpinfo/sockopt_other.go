@@ -0,0 +1,23 @@
+//go:build !linux
+
+package tcpinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// SetMaxPacingRate is only supported on Linux.
+func SetMaxPacingRate(fd uintptr, bytesPerSec uint64) error {
+	return fmt.Errorf("%w: SO_MAX_PACING_RATE on %s", ErrUnsupported, runtime.GOOS)
+}
+
+// SetNotSentLowat is only supported on Linux.
+func SetNotSentLowat(fd uintptr, bytes uint32) error {
+	return fmt.Errorf("%w: TCP_NOTSENT_LOWAT on %s", ErrUnsupported, runtime.GOOS)
+}
+
+// SocketInode is only supported on Linux.
+func SocketInode(fd uintptr) (uint64, error) {
+	return 0, fmt.Errorf("%w: socket inode on %s", ErrUnsupported, runtime.GOOS)
+}
@@ -1,31 +1,191 @@
 package tcpinfo
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// Sentinel errors shared by every platform. Platform-specific errors returned by GetTCPInfo wrap one of these
+// where the cause is known, so callers can use errors.Is to tell "not available here" apart from "socket gone".
+var (
+	ErrUnsupported = errors.New("tcp_info is not supported")
+	ErrConnClosed  = errors.New("connection is closed")
+
+	// ErrPermission is returned when the read was refused, as a seccomp filter or other sandbox policy does for
+	// getsockopt with EPERM. The refusal applies to every socket in the process, so retrying will not help.
+	ErrPermission = errors.New("tcp_info access denied")
+
+	// ErrNotTCP is returned when the descriptor is not a TCP socket at all, such as a Unix-domain or UDP socket.
+	// It wraps ErrUnsupported.
+	ErrNotTCP = fmt.Errorf("%w: not a TCP socket", ErrUnsupported)
+
+	// ErrNotEstablished is returned, naming the state, for a socket that has not completed its handshake, such as
+	// a listener or a connect still in SYN_SENT, when the caller asked to skip those, as with
+	// GetOptions.RequireEstablished on Linux. The socket's tcp_info is mostly zero until then, so the read can be
+	// retried once the connection is up.
+	ErrNotEstablished = errors.New("connection is not established")
+)
+
+// GetTCPInfoConn reads tcpinfo for the socket behind rc, as returned by the SyscallConn method of *net.TCPConn, and
+// converts it to the portable Info. The read runs inside rc.Control, so unlike File().Fd() it neither duplicates
+// the descriptor nor switches the connection to blocking mode, and there is nothing to close afterwards. Like
+// GetTCPInfo, it can return a partial Info together with an error.
+func GetTCPInfoConn(rc syscall.RawConn) (*Info, error) {
+	var sysInfo *SysInfo
+	var infoErr error
+	if err := rc.Control(func(fd uintptr) {
+		sysInfo, infoErr = GetTCPInfo(fd)
+	}); err != nil {
+		return nil, err
+	}
+	if sysInfo == nil {
+		return nil, infoErr
+	}
+	return sysInfo.ToInfo(), infoErr
+}
+
+// WarnAppLimited is the warning reported when the delivery rate was limited by the application rather than the
+// network, so a low rate should not be read as a network problem.
+const WarnAppLimited = "appLimited=true"
+
+// WarnConnectionReset is the warning reported when the socket is in the CLOSE state while still open, which
+// happens when the peer reset the connection or it timed out.
+const WarnConnectionReset = "connectionReset=true"
+
+// Loss recovery (congestion avoidance) states reported in Info.CAState, from include/net/tcp.h on Linux. Other
+// platforms do not report a recovery state.
+const (
+	TCP_CA_Open     CAState = 0 // Normal operation
+	TCP_CA_Disorder CAState = 1 // Duplicate ACKs or SACKs seen, possible reordering
+	TCP_CA_CWR      CAState = 2 // Congestion window reduced after an ECN or local congestion signal
+	TCP_CA_Recovery CAState = 3 // Fast retransmit recovery
+	TCP_CA_Loss     CAState = 4 // Retransmission timeout recovery
+)
+
+var caStateNames = [...]string{
+	TCP_CA_Open:     "Open",
+	TCP_CA_Disorder: "Disorder",
+	TCP_CA_CWR:      "CWR",
+	TCP_CA_Recovery: "Recovery",
+	TCP_CA_Loss:     "Loss",
+}
+
+// CAState is a loss recovery state, one of the TCP_CA_* constants.
+type CAState uint8
+
+// String returns the name of the state, such as "Recovery", or "UNKNOWN" for values outside the TCP_CA_* range.
+func (s CAState) String() string {
+	if int(s) < len(caStateNames) {
+		return caStateNames[s]
+	}
+	return "UNKNOWN"
+}
+
+// CAStateName returns the name of a loss recovery state, such as "Recovery", or "UNKNOWN" for values outside
+// the TCP_CA_* range. It is shorthand for CAState(state).String().
+func CAStateName(state uint8) string {
+	return CAState(state).String()
+}
+
+// Thresholds controls when SysInfo.Warnings reports rate-based diagnostics.
+type Thresholds struct {
+	RetransRate     float64 // Fraction of sent segments that were retransmitted
+	LimitedFraction float64 // Fraction of busy time spent limited by the receive window or send buffer
+}
+
+// DefaultThresholds are the thresholds used by SysInfo.Warnings. Adjust them
+// during initialization, before any connections are inspected.
+var DefaultThresholds = Thresholds{
+	RetransRate:     0.01,
+	LimitedFraction: 0.10,
+}
+
+// HealthPolicy sets the limits Info.Healthy checks a connection against. A zero limit disables its check.
+type HealthPolicy struct {
+	MaxRetransRate     float64       // Highest fraction of sent segments (bytes on Windows) that may be retransmitted
+	MaxRTT             time.Duration // Highest smoothed round-trip time
+	MaxLimitedFraction float64       // Highest fraction of busy time the sender may be limited by the receive window or send buffer
+}
+
+// DefaultHealthPolicy matches the rate limits of DefaultThresholds and leaves the RTT check disabled, since a
+// healthy RTT depends on the path.
+var DefaultHealthPolicy = HealthPolicy{
+	MaxRetransRate:     0.01,
+	MaxLimitedFraction: 0.10,
+}
+
+// PathQualityPolicy sets how Info.PathQualityWith combines its signals into a score. Each signal is a rate or ratio
+// that is scaled into a penalty between 0 (clean) and 1 (at or beyond its Max), and the score is one minus the
+// weighted mean of the penalties the platform reports. A zero weight or Max leaves its signal out.
+//
+// Reordering is measured by reord_seen, the count of out-of-order ACKs, rather than the Linux Reordering field
+// (tcpi_reordering). That field is the kernel's reordering tolerance in segments, not a count of events: every
+// connection starts at the net.ipv4.tcp_reordering sysctl, 3 by default, and it only moves once reordering has been
+// seen, so as a penalty it would mostly score the sysctl.
+type PathQualityPolicy struct {
+	RetransWeight    float64
+	ReorderingWeight float64
+	DSACKWeight      float64
+	RTTVarWeight     float64
+	MaxRetransRate   float64 // Retransmitted over sent segments (bytes on Windows) at which the retransmit penalty is 1
+	MaxReorderRate   float64 // Out-of-order ACKs (reord_seen) over sent segments at which the reordering penalty is 1 [Linux 4.19+]
+	MaxDSACKRate     float64 // DSACK-reported duplicate segments over sent segments at which the DSACK penalty is 1 [Linux 4.19+]
+	MaxRTTVarRatio   float64 // RTTVar over RTT at which the RTT variance penalty is 1 [Darwin and Linux]
+}
+
+// DefaultPathQualityPolicy weighs retransmits as heavily as the other three signals together, saturating at 5%
+// retransmitted or reordered, 2% duplicated, and an RTT variance as large as the RTT. Like DefaultThresholds, adjust
+// it during initialization.
+var DefaultPathQualityPolicy = PathQualityPolicy{
+	RetransWeight:    3,
+	ReorderingWeight: 1,
+	DSACKWeight:      1,
+	RTTVarWeight:     1,
+	MaxRetransRate:   0.05,
+	MaxReorderRate:   0.05,
+	MaxDSACKRate:     0.02,
+	MaxRTTVarRatio:   1,
+}
+
+// Info is the portable subset of tcp_info that every supported platform maps
+// its SysInfo into via ToInfo. Fields are populated on Darwin, Linux, and
+// Windows unless the comment lists the platforms that provide them; fields a
+// platform does not provide are left at their zero value. The platform-specific
+// details remain available through Sys.
 type Info struct {
 	State         string        `json:"state,omitempty"`          // Connection state
-	TxOptions     []Option      `json:"txOptions,omitempty"`      // Requesting options
-	RxOptions     []Option      `json:"rxOptions,omitempty"`      // Options requested from peer
+	CAState       CAState       `json:"caState,omitempty"`        // Loss recovery state [Linux only]
+	TxOptions     []Option      `json:"txOptions,omitempty"`      // Requesting options [Darwin and Linux]
+	RxOptions     []Option      `json:"rxOptions,omitempty"`      // Options requested from peer [Darwin and Linux]
 	TxMSS         uint64        `json:"txMSS,omitempty"`          // Maximum segment size for sender in bytes
-	RxMSS         uint64        `json:"rxMSS,omitempty"`          // Maximum segment size for receiver in bytes
+	RxMSS         uint64        `json:"rxMSS,omitempty"`          // Maximum segment size for receiver in bytes [Darwin and Linux]
 	RTT           time.Duration `json:"rtt,omitempty"`            // Round-trip time in nanoseconds
-	RTTVar        time.Duration `json:"rttVar,omitempty"`         // Round-trip time variation in nanoseconds
-	RTO           time.Duration `json:"rto,omitempty"`            // Retransmission timeout
+	RTTVar        time.Duration `json:"rttVar,omitempty"`         // Round-trip time variation in nanoseconds [Darwin and Linux]
+	MinRTT        time.Duration `json:"minRTT,omitempty"`         // Minimum observed round-trip time [Linux 4.6+ and Windows]
+	RTO           time.Duration `json:"rto,omitempty"`            // Retransmission timeout [Darwin and Linux]
 	ATO           time.Duration `json:"ato,omitempty"`            // Delayed acknowledgement timeout [Linux only]
 	LastTxAt      time.Duration `json:"lastTxAt,omitempty"`       // Nanoseconds since last data sent [Linux only]
-	LastRxAt      time.Duration `json:"lastRxAt,omitempty"`       // Nanoseconds since last data received [FreeBSD and Linux]
-	LastTxAckAt   time.Duration `json:"lastTxAckAt,omitempty"`    // Nanoseconds since last ack sent [Linux only]
+	LastRxAt      time.Duration `json:"lastRxAt,omitempty"`       // Nanoseconds since last data received [Linux only]
+	LastTxAckAt   time.Duration `json:"lastTxAckAt,omitempty"`    // Nanoseconds since last ack sent [Linux only, not implemented by the kernel]
 	LastRxAckAt   time.Duration `json:"lastRxAckAt,omitempty"`    // Nanoseconds since last ack received [Linux only]
 	RxWindow      uint64        `json:"rxWindow,omitempty"`       // Advertised receiver window in bytes
-	TxSSThreshold uint64        `json:"txSSThreshold,omitempty"`  // Slow start threshold for sender in bytes or # of segments
+	TxSSThreshold uint64        `json:"txSSThreshold,omitempty"`  // Slow start threshold for sender in bytes (Darwin) or # of segments (Linux) [Darwin and Linux]
 	RxSSThreshold uint64        `json:"rxSSThreshold,omitempty"`  // Slow start threshold for receiver in bytes [Linux only]
-	TxWindowBytes uint64        `json:"txCWindowBytes,omitempty"` // Congestion window for sender in bytes [Darwin and FreeBSD]
-	TxWindowSegs  uint64        `json:"txCWindowSegs,omitempty"`  // Congestion window for sender in # of segments [Linux and NetBSD]
-	Retransmits   uint64        `json:"retransmits,omitempty"`    // Number of retransmissions (segments or packets)
+	TxWindowBytes uint64        `json:"txCWindowBytes,omitempty"` // Congestion window for sender in bytes [Darwin and Windows]
+	TxWindowSegs  uint64        `json:"txCWindowSegs,omitempty"`  // Congestion window for sender in # of segments [Linux only]
+	Retransmits   uint64        `json:"retransmits,omitempty"`    // Number of retransmissions (segments or packets; SYN retransmissions only on Windows)
+	TxBytes       uint64        `json:"txBytes,omitempty"`        // Payload bytes sent, including retransmissions [Darwin, Linux 4.19+, Windows]
+	RxBytes       uint64        `json:"rxBytes,omitempty"`        // Payload bytes received [Darwin, Linux 4.1+, Windows]
+	BytesAcked    uint64        `json:"bytesAcked,omitempty"`     // Payload bytes acknowledged by the peer [Linux 4.1+]
+	DeliveryRate  uint64        `json:"deliveryRate,omitempty"`   // Most recent delivery rate in bytes per second [Linux 4.9+]
+	AppLimited    bool          `json:"appLimited,omitempty"`     // DeliveryRate was limited by the application, not the network [Linux 4.9+]
 	Sys           *SysInfo      `json:"sysInfo,omitempty"`        // Platform-specific information
 }
 
@@ -33,12 +193,14 @@ type Info struct {
 func (i *Info) ToMap() map[string]any {
 	m := map[string]any{
 		"state":          i.State,
+		"caState":        uint8(i.CAState),
 		"txOptions":      i.TxOptions,
 		"rxOptions":      i.RxOptions,
 		"txMSS":          i.TxMSS,
 		"rxMSS":          i.RxMSS,
 		"rtt":            i.RTT,
 		"rttVar":         i.RTTVar,
+		"minRTT":         i.MinRTT,
 		"rto":            i.RTO,
 		"ato":            i.ATO,
 		"lastTxAt":       i.LastTxAt,
@@ -51,6 +213,11 @@ func (i *Info) ToMap() map[string]any {
 		"txCWindowBytes": i.TxWindowBytes,
 		"txCWindowSegs":  i.TxWindowSegs,
 		"retransmits":    i.Retransmits,
+		"txBytes":        i.TxBytes,
+		"rxBytes":        i.RxBytes,
+		"bytesAcked":     i.BytesAcked,
+		"deliveryRate":   i.DeliveryRate,
+		"appLimited":     i.AppLimited,
 	}
 	if i.Sys != nil {
 		m["sysInfo"] = i.Sys.ToMap()
@@ -58,6 +225,326 @@ func (i *Info) ToMap() map[string]any {
 	return m
 }
 
+// MarshalJSONCompact encodes the same keys as ToMap but omits the fields the platform or running kernel did not
+// report, so a reported zero is kept and an absent field is dropped. The default encoding instead drops every zero
+// value. Without Sys to consult, MarshalJSONCompact falls back to dropping zero values. A nil Info encodes as null.
+func (i *Info) MarshalJSONCompact() ([]byte, error) {
+	if i == nil {
+		return []byte("null"), nil
+	}
+	m := i.ToMap()
+	for key, value := range m {
+		if key == "sysInfo" {
+			continue
+		}
+		if i.Sys != nil && !i.Reported(key) || i.Sys == nil && reflect.ValueOf(value).IsZero() {
+			delete(m, key)
+		}
+	}
+	return json.Marshal(m)
+}
+
+// Reported reports whether the field with the given ToMap key was filled from data the platform and running kernel
+// provided, as opposed to left at its zero value because it is unavailable. It returns false when Sys is nil.
+func (i *Info) Reported(key string) bool {
+	return i.Sys != nil && i.Sys.reportsInfoField(key)
+}
+
+// Healthy reports whether the connection is within every limit of p. Checks that need data the platform or running
+// kernel does not report pass: the retransmit rate needs Linux 4.2+, macOS, or Windows, and the limited fraction
+// needs Linux 4.10+ or Windows. A nil Info is not healthy.
+func (i *Info) Healthy(p HealthPolicy) bool {
+	if i == nil {
+		return false
+	}
+	if p.MaxRTT > 0 && i.RTT > p.MaxRTT {
+		return false
+	}
+	if i.Sys == nil {
+		return true
+	}
+	if rate, ok := i.Sys.retransRate(); ok && p.MaxRetransRate > 0 && rate > p.MaxRetransRate {
+		return false
+	}
+	if frac, ok := i.Sys.limitedFraction(); ok && p.MaxLimitedFraction > 0 && frac > p.MaxLimitedFraction {
+		return false
+	}
+	return true
+}
+
+// PathQuality returns a score from 0 (poor) to 1 (clean) for the network path, combining the retransmit rate,
+// reordering, DSACK-reported duplicates, and RTT variance under DefaultPathQualityPolicy. It is meant for at-a-glance
+// dashboards; see PathQualityWith for the formula and ok.
+func (i *Info) PathQuality() (score float64, ok bool) {
+	return i.PathQualityWith(DefaultPathQualityPolicy)
+}
+
+// PathQualityWith returns the path quality score under p: one minus the weighted mean of the penalties of the signals
+// the platform reports, where each penalty is min(signal / Max, 1). The rates are cumulative over the connection's
+// lifetime. Signals a platform or kernel does not report are left out of the mean rather than counted as clean. ok
+// is false when none of the signals p weighs is reported, or i is nil, since there is nothing to score.
+func (i *Info) PathQualityWith(p PathQualityPolicy) (score float64, ok bool) {
+	if i == nil {
+		return 0, false
+	}
+	var penalty, weight float64
+	add := func(w, value, limit float64) {
+		if w <= 0 || limit <= 0 {
+			return
+		}
+		penalty += w * min(value/limit, 1)
+		weight += w
+	}
+	if i.RTT > 0 && i.RTTVar > 0 {
+		add(p.RTTVarWeight, float64(i.RTTVar)/float64(i.RTT), p.MaxRTTVarRatio)
+	}
+	if i.Sys != nil {
+		if rate, ok := i.Sys.retransRate(); ok {
+			add(p.RetransWeight, rate, p.MaxRetransRate)
+		}
+		if reorder, dsack, ok := i.Sys.reorderRates(); ok {
+			add(p.ReorderingWeight, reorder, p.MaxReorderRate)
+			add(p.DSACKWeight, dsack, p.MaxDSACKRate)
+		}
+	}
+	if weight == 0 {
+		return 0, false
+	}
+	return 1 - penalty/weight, true
+}
+
+// LimitedTime returns the cumulative time the sender has spent limited by the peer's receive window and by the
+// local send buffer. The totals only grow, so the change between two samples shows what limited the connection in
+// between. ok is false where they are not reported: they need Linux 4.10+ or Windows, and Sys.
+func (i *Info) LimitedTime() (rwnd, sndbuf time.Duration, ok bool) {
+	if i == nil || i.Sys == nil {
+		return 0, 0, false
+	}
+	return i.Sys.limitedTime()
+}
+
+// CongestionAlgorithm returns the name of the congestion control algorithm, such as "cubic" or "bbr", read with
+// TCP_CONGESTION alongside tcp_info. It is empty when the read failed and on platforms other than Linux.
+func (i *Info) CongestionAlgorithm() string {
+	if i == nil || i.Sys == nil {
+		return ""
+	}
+	return i.Sys.congestionAlgorithm()
+}
+
+// Backoff returns the RTO backoff, the number of consecutive retransmission timeouts since the last successful RTT
+// measurement; each doubles the RTO. ok is false on platforms that do not report it, which is all but Linux.
+func (i *Info) Backoff() (backoff uint8, ok bool) {
+	if i == nil || i.Sys == nil {
+		return 0, false
+	}
+	return i.Sys.backoff()
+}
+
+// SenderRTT returns the smoothed round-trip time measured by this side as a sender, from the acknowledgements of the
+// data it sent. It is the RTT field, the one the RTO, congestion control, and Healthy use, and it is the RTT every
+// platform reports; it is zero until data has been acknowledged, and goes stale on a connection that only receives.
+func (i *Info) SenderRTT() time.Duration {
+	if i == nil {
+		return 0
+	}
+	return i.RTT
+}
+
+// ReceiverRTT returns the kernel's receiver-side RTT estimate, tcpi_rcv_rtt on Linux, measured from the data this
+// side receives rather than from acknowledgements: roughly the time for the peer to send a window's worth of data
+// after the window opened. It is coarser than SenderRTT and exists for receive buffer auto-tuning, which once per
+// receiver RTT checks how many bytes the application read (rcv_space) and grows the receive buffer to keep up. On a
+// connection that mostly receives, it is the only RTT that stays current. ok is false on platforms other than
+// Linux, without Sys, and until enough data has been received for an estimate.
+func (i *Info) ReceiverRTT() (rtt time.Duration, ok bool) {
+	if i == nil || i.Sys == nil {
+		return 0, false
+	}
+	return i.Sys.receiverRTT()
+}
+
+// FastOpenState is whether a connection used TCP Fast Open, one of the FastOpen* constants.
+type FastOpenState uint8
+
+const (
+	FastOpenUnknown      FastOpenState = 0 // Not reported: Windows, Linux before 5.5 without SYN data, or no Sys
+	FastOpenNotAttempted FastOpenState = 1 // No data was carried in the SYN
+	FastOpenSucceeded    FastOpenState = 2 // Data in the SYN was acknowledged, sent or received
+	FastOpenFailed       FastOpenState = 3 // A Fast Open attempt fell back to a regular handshake; see FastOpenResult.Reason
+)
+
+var fastOpenStateNames = [...]string{
+	FastOpenUnknown:      "unknown",
+	FastOpenNotAttempted: "not_attempted",
+	FastOpenSucceeded:    "succeeded",
+	FastOpenFailed:       "failed",
+}
+
+// String returns the name of the state, such as "succeeded".
+func (s FastOpenState) String() string {
+	if int(s) < len(fastOpenStateNames) {
+		return fastOpenStateNames[s]
+	}
+	return "unknown"
+}
+
+// FastOpenFailReason is why a client's Fast Open attempt failed, the tcpi_fastopen_client_fail values on Linux.
+type FastOpenFailReason uint8
+
+const (
+	FastOpenFailUnspecified      FastOpenFailReason = 0 // No reason was recorded
+	FastOpenFailNoCookie         FastOpenFailReason = 1 // No cookie was cached, so the SYN only requested one
+	FastOpenFailDataNotAcked     FastOpenFailReason = 2 // The SYN-ACK did not acknowledge the SYN data
+	FastOpenFailSYNRetransmitted FastOpenFailReason = 3 // The SYN was retransmitted without data after a timeout
+)
+
+var fastOpenFailReasonNames = [...]string{
+	FastOpenFailUnspecified:      "unspecified",
+	FastOpenFailNoCookie:         "no_cookie",
+	FastOpenFailDataNotAcked:     "data_not_acked",
+	FastOpenFailSYNRetransmitted: "syn_retransmitted",
+}
+
+// String returns the name of the reason, such as "no_cookie".
+func (r FastOpenFailReason) String() string {
+	if int(r) < len(fastOpenFailReasonNames) {
+		return fastOpenFailReasonNames[r]
+	}
+	return "unspecified"
+}
+
+// FastOpenResult is the outcome of TCP Fast Open on a connection. Reason is only meaningful when State is
+// FastOpenFailed.
+type FastOpenResult struct {
+	State  FastOpenState      `json:"state"`
+	Reason FastOpenFailReason `json:"reason,omitempty"`
+}
+
+// String returns the state, followed by the reason for failures, such as "succeeded" or "failed:no_cookie".
+func (r FastOpenResult) String() string {
+	if r.State == FastOpenFailed {
+		return r.State.String() + ":" + r.Reason.String()
+	}
+	return r.State.String()
+}
+
+// FastOpen returns whether the connection used TCP Fast Open. On Linux it combines the SYN_DATA and TFO_CHILD
+// options, which mark data in the SYN as acknowledged or accepted, with tcpi_fastopen_client_fail (Linux 5.5+), which
+// tells a failed client attempt from one never made. On macOS it is decoded from tcpi_tfo_flags. It needs Sys, and
+// is FastOpenUnknown elsewhere.
+func (i *Info) FastOpen() FastOpenResult {
+	if i == nil || i.Sys == nil {
+		return FastOpenResult{}
+	}
+	return i.Sys.fastOpen()
+}
+
+// String returns a one-line summary in the style of `ss -ti`, e.g.
+// "ESTABLISHED rtt:1.500/0.750ms rto:204.000ms mss:1448 cwnd:10 retrans:0".
+func (i *Info) String() string {
+	if i == nil {
+		return "<nil>"
+	}
+
+	var b strings.Builder
+	b.WriteString(i.State)
+	if b.Len() == 0 {
+		b.WriteString("UNKNOWN")
+	}
+	fmt.Fprintf(&b, " rtt:%s/%sms", formatMillis(i.RTT), formatMillis(i.RTTVar))
+	if i.RTO > 0 {
+		fmt.Fprintf(&b, " rto:%sms", formatMillis(i.RTO))
+	}
+	if i.TxMSS > 0 {
+		fmt.Fprintf(&b, " mss:%d", i.TxMSS)
+	}
+	if i.TxWindowSegs > 0 {
+		fmt.Fprintf(&b, " cwnd:%d", i.TxWindowSegs)
+	} else if i.TxWindowBytes > 0 {
+		fmt.Fprintf(&b, " cwnd:%dB", i.TxWindowBytes)
+	}
+	fmt.Fprintf(&b, " retrans:%d", i.Retransmits)
+	return b.String()
+}
+
+// CwndBytes returns the sender's congestion window in bytes, the figure to compare with the bandwidth-delay product:
+// TxWindowBytes on macOS and Windows, which report it in bytes, and TxWindowSegs × TxMSS on Linux, which reports
+// segments. It returns 0 when the window is not reported or the MSS is zero.
+func (i *Info) CwndBytes() uint64 {
+	if i == nil {
+		return 0
+	}
+	if i.TxWindowBytes > 0 {
+		return i.TxWindowBytes
+	}
+	if i.TxMSS == 0 {
+		return 0
+	}
+	return i.TxWindowSegs * i.TxMSS
+}
+
+// BDP returns the bandwidth-delay product in bytes: DeliveryRate, in bytes per second, times MinRTT. The kernel
+// reports tcpi_min_rtt in microseconds, but MinRTT is already converted to a time.Duration, so the product is taken
+// in seconds and needs no further scaling. ok is false when either input is missing (Linux before 4.9, macOS) or
+// zero. While AppLimited is set, DeliveryRate, and so the BDP, understates what the path can carry.
+func (i *Info) BDP() (bytes uint64, ok bool) {
+	if i == nil || i.DeliveryRate == 0 || i.MinRTT <= 0 {
+		return 0, false
+	}
+	return uint64(float64(i.DeliveryRate) * i.MinRTT.Seconds()), true
+}
+
+// CwndLimited reports whether the congestion window, from CwndBytes, is smaller than the BDP, meaning the sender
+// cannot keep the path full and throughput is capped by cwnd rather than the network or the application. ok is
+// false when the BDP or the window in bytes is unknown.
+func (i *Info) CwndLimited() (limited, ok bool) {
+	bdp, ok := i.BDP()
+	cwnd := i.CwndBytes()
+	if !ok || cwnd == 0 {
+		return false, false
+	}
+	return cwnd < bdp, true
+}
+
+// DeliveryRateBitsPerSec returns DeliveryRate, which the kernel reports in bytes per second, in bits per second.
+func (i *Info) DeliveryRateBitsPerSec() uint64 {
+	if i == nil {
+		return 0
+	}
+	return i.DeliveryRate * 8
+}
+
+// bitRateUnits are the decimal SI units FormatBitRate picks from, in increasing steps of 1000.
+var bitRateUnits = [...]string{"bit/s", "kbit/s", "Mbit/s", "Gbit/s", "Tbit/s"}
+
+// FormatBitRate formats a rate given in bytes per second, such as DeliveryRate or the Linux PacingRate, as bits per
+// second with a decimal SI prefix and one decimal place, e.g. "94.2 Mbit/s". Rates below 1 kbit/s are whole bits,
+// e.g. "800 bit/s".
+func FormatBitRate(bytesPerSec uint64) string {
+	bits := float64(bytesPerSec) * 8
+	if bits < 1000 {
+		return strconv.FormatFloat(bits, 'f', 0, 64) + " " + bitRateUnits[0]
+	}
+	// Step up at 999.95 rather than 1000 so a value does not round to "1000.0" of the smaller unit.
+	unit := 0
+	for bits >= 999.95 && unit < len(bitRateUnits)-1 {
+		bits /= 1000
+		unit++
+	}
+	return strconv.FormatFloat(bits, 'f', 1, 64) + " " + bitRateUnits[unit]
+}
+
+// formatMillis formats d as milliseconds with microsecond precision.
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// formatMbps formats a rate given in bytes per second as megabits per second.
+func formatMbps(bytesPerSec uint64) string {
+	return strconv.FormatFloat(float64(bytesPerSec)*8/1e6, 'f', 2, 64) + "Mbps"
+}
+
 type Option struct {
 	Kind  string `json:"kind"`
 	Value uint64 `json:"value"`
@@ -70,18 +557,98 @@ func cloneOptions(options []Option) []Option {
 	return append([]Option(nil), options...)
 }
 
+// cloneOptionPair clones a transmit and receive option list with one allocation.
+func cloneOptionPair(tx, rx []Option) ([]Option, []Option) {
+	if tx == nil || rx == nil {
+		return cloneOptions(tx), cloneOptions(rx)
+	}
+	buf := make([]Option, len(tx)+len(rx))
+	copy(buf, tx)
+	copy(buf[len(tx):], rx)
+	return buf[:len(tx):len(tx)], buf[len(tx):]
+}
+
+// cloneSharedOptions clones options, unless they are the same list as shared, as they are when ToInfo passed the
+// Sys options through, in which case the clone shares sharedClone, Sys's clone of them, instead.
+func cloneSharedOptions(options, shared, sharedClone []Option) []Option {
+	if len(options) > 0 && len(options) == len(shared) && &options[0] == &shared[0] {
+		return sharedClone
+	}
+	return cloneOptions(options)
+}
+
 func (i *Info) Clone() *Info {
 	if i == nil {
 		return nil
 	}
 
 	clone := *i
-	clone.TxOptions = cloneOptions(i.TxOptions)
-	clone.RxOptions = cloneOptions(i.RxOptions)
 	clone.Sys = i.Sys.Clone()
+	var sysTx, sysRx, cloneTx, cloneRx []Option
+	if i.Sys != nil {
+		sysTx, sysRx = i.Sys.optionLists()
+		cloneTx, cloneRx = clone.Sys.optionLists()
+	}
+	clone.TxOptions = cloneSharedOptions(i.TxOptions, sysTx, cloneTx)
+	clone.RxOptions = cloneSharedOptions(i.RxOptions, sysRx, cloneRx)
 	return &clone
 }
 
+// VolatileFields are the Info fields, by JSON key as in ToMap, that Normalize zeroes because they vary from run to
+// run even for identical traffic: the RTT estimates and timers, the times since the last activity, the delivery
+// rate, and Sys, which repeats them. Pass them to EqualIgnoring to compare two snapshots the same way.
+var VolatileFields = []string{
+	"rtt", "rttVar", "minRTT", "rto", "ato",
+	"lastTxAt", "lastRxAt", "lastTxAckAt", "lastRxAckAt",
+	"deliveryRate", "appLimited", "sysInfo",
+}
+
+// infoFieldIndex maps the JSON key of each Info field to its index, for Normalize and EqualIgnoring.
+var infoFieldIndex = sync.OnceValue(func() map[string]int {
+	t := reflect.TypeFor[Info]()
+	m := make(map[string]int, t.NumField())
+	for idx := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(idx).Tag.Get("json"), ",")
+		m[key] = idx
+	}
+	return m
+})
+
+// Normalize zeroes the fields listed in VolatileFields, so that snapshots taken in tests can be compared on their
+// stable parts, such as the state, MSS, options, and byte counters.
+func (i *Info) Normalize() {
+	if i == nil {
+		return
+	}
+	v := reflect.ValueOf(i).Elem()
+	for _, key := range VolatileFields {
+		if idx, ok := infoFieldIndex()[key]; ok {
+			v.Field(idx).SetZero()
+		}
+	}
+}
+
+// EqualIgnoring reports whether i and b hold the same values, Sys included, apart from the fields named in
+// ignore by their JSON keys as in ToMap; unknown keys are ignored. Two nil Infos are equal.
+func (i *Info) EqualIgnoring(b *Info, ignore ...string) bool {
+	if i == nil || b == nil {
+		return i == b
+	}
+	skip := make([]bool, reflect.TypeFor[Info]().NumField())
+	for _, key := range ignore {
+		if idx, ok := infoFieldIndex()[key]; ok {
+			skip[idx] = true
+		}
+	}
+	va, vb := reflect.ValueOf(i).Elem(), reflect.ValueOf(b).Elem()
+	for idx := range skip {
+		if !skip[idx] && !reflect.DeepEqual(va.Field(idx).Interface(), vb.Field(idx).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
 func (o *Option) String() string {
 	if o.Value == 0 {
 		return o.Kind
@@ -92,3 +659,97 @@ func (o *Option) String() string {
 func (o *Option) MarshalJSON() ([]byte, error) {
 	return []byte(strconv.Quote(o.String())), nil
 }
+
+// UnmarshalJSON parses the form MarshalJSON writes, the kind optionally followed by a colon and the value in hex,
+// such as "SACK" or "WindowScale:08".
+func (o *Option) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	kind, hex, found := strings.Cut(str, ":")
+	var value uint64
+	if found {
+		v, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return fmt.Errorf("tcpinfo: invalid option %q: %w", str, err)
+		}
+		value = v
+	}
+	*o = Option{Kind: kind, Value: value}
+	return nil
+}
+
+// ECN summarizes Explicit Congestion Notification on a connection: whether it was negotiated and how many of the
+// delivered data segments the peer reported as Congestion Experienced (CE) marked by the path.
+type ECN struct {
+	Negotiated  bool   `json:"negotiated"`            // ECN was negotiated at connection setup [Darwin and Linux]
+	ECTSeen     bool   `json:"ectSeen"`               // At least one ECN-capable packet was received [Linux only]
+	Delivered   uint32 `json:"delivered,omitempty"`   // Data segments delivered to the peer, including retransmits [Linux 4.18+]
+	DeliveredCE uint32 `json:"deliveredCE,omitempty"` // Delivered segments the peer reported as CE marked [Linux 4.18+]
+}
+
+// CERate returns the fraction of delivered segments that were CE marked. ok is false when no deliveries were
+// reported.
+func (e ECN) CERate() (rate float64, ok bool) {
+	if e.Delivered == 0 {
+		return 0, false
+	}
+	return float64(e.DeliveredCE) / float64(e.Delivered), true
+}
+
+// ECN returns the ECN summary for the connection. The delivery counts come from Sys and are zero without it.
+func (i *Info) ECN() ECN {
+	if i == nil {
+		return ECN{}
+	}
+	opts := i.DecodedOptions()
+	e := ECN{Negotiated: opts.ECN, ECTSeen: opts.ECNSeen}
+	if i.Sys != nil {
+		e.Delivered, e.DeliveredCE = i.Sys.deliveredCE()
+	}
+	return e
+}
+
+// Options reports which TCP options and negotiations are in effect on a connection, decoded from the tcpi_options
+// bitmask (the TCPI_OPT_* flags on Linux, TCPCI_OPT_* on macOS).
+type Options struct {
+	Timestamps bool `json:"timestamps"` // Timestamps were negotiated
+	SACK       bool `json:"sack"`       // Selective acknowledgements are permitted
+	WScale     bool `json:"wscale"`     // Window scaling was negotiated
+	ECN        bool `json:"ecn"`        // ECN was negotiated
+	ECNSeen    bool `json:"ecnSeen"`    // At least one packet with ECT was received [Linux only]
+	SynData    bool `json:"synData"`    // The SYN-ACK acknowledged data sent or received in the SYN [Linux only]
+	UsecTS     bool `json:"usecTS"`     // Timestamps are in microseconds [Linux 6.7+]
+	TFOChild   bool `json:"tfoChild"`   // The socket was accepted from a Fast Open SYN [Linux only]
+}
+
+// DecodedOptions returns the options in TxOptions as booleans, so callers can check for one, such as SACK, without
+// matching on Option.Kind. Windows does not report options, so every field is false there, as it is for a nil Info.
+func (i *Info) DecodedOptions() Options {
+	var o Options
+	if i == nil {
+		return o
+	}
+	for _, opt := range i.TxOptions {
+		switch opt.Kind {
+		case "Timestamps":
+			o.Timestamps = true
+		case "SACK":
+			o.SACK = true
+		case "WindowScale":
+			o.WScale = true
+		case "ECN":
+			o.ECN = true
+		case "ECNSeen":
+			o.ECNSeen = true
+		case "SYNData":
+			o.SynData = true
+		case "UsecTS":
+			o.UsecTS = true
+		case "TFOChild":
+			o.TFOChild = true
+		}
+	}
+	return o
+}
@@ -94,7 +94,7 @@ type RawInfo struct {
 
 // SysInfo is a gopher-style unpacked representation of RawTCPInfo.
 type SysInfo struct {
-	State               uint8         `tcpi:"name=state,prom_type=gauge,prom_help='Connection state, see bsd/netinet/tcp_fsm.h'" json:"-"`
+	State               TCPState      `tcpi:"name=state,prom_type=gauge,prom_help='Connection state, see bsd/netinet/tcp_fsm.h'" json:"-"`
 	StateName           string        `tcpi:"name=state_name,prom_type=gauge,prom_help='Connection state name, see bsd/netinet/tcp_fsm.h'" json:"state,omitempty"`
 	TxWindowScale       uint8         `tcpi:"name=snd_wscale,prom_type=gauge,prom_help='Window scaling of send-half of connection.'" json:"txWScale,omitempty"`
 	RxWindowScale       uint8         `tcpi:"name=rcv_wscale,prom_type=gauge,prom_help='Window scaling of receive-half of connection.'" json:"rxWScale,omitempty"`
@@ -127,8 +127,7 @@ func (s *SysInfo) Clone() *SysInfo {
 	}
 
 	clone := *s
-	clone.TxOptions = cloneOptions(s.TxOptions)
-	clone.RxOptions = cloneOptions(s.RxOptions)
+	clone.TxOptions, clone.RxOptions = cloneOptionPair(s.TxOptions, s.RxOptions)
 	return &clone
 }
 
@@ -171,8 +170,8 @@ var timeFieldMultiplier = time.Millisecond
 // Unpack converts fields from RawInfo to SysInfo
 func (packed *RawInfo) Unpack() *SysInfo {
 	var unpacked SysInfo
-	unpacked.State = packed.State
-	unpacked.StateName = tcpStateMap[packed.State]
+	unpacked.State = TCPState(packed.State)
+	unpacked.StateName = tcpStateMap[unpacked.State]
 	unpacked.TxWindowScale = packed.SendWscale
 	unpacked.RxWindowScale = packed.RecvWscale
 	unpacked.Flags = tcpInfoTCPFlagsString(packed.Flags)
@@ -226,32 +225,54 @@ func (s *SysInfo) ToInfo() *Info {
 		RxWindow:      uint64(s.RxWindow),
 		TxSSThreshold: uint64(s.TxSSThreshold),
 		TxWindowBytes: uint64(s.TxCWindow),
-		TxWindowSegs:  uint64(s.TxWindow),
 		Retransmits:   s.TxRetransmitPackets,
+		TxBytes:       s.TxBytes,
+		RxBytes:       s.RxBytes,
 		Sys:           s,
 	}
 	return info
 }
 
+// reportsInfoField reports whether ToInfo fills the Info field with the given ToMap key.
+func (s *SysInfo) reportsInfoField(key string) bool {
+	switch key {
+	case "state", "txOptions", "rxOptions", "txMSS", "rxMSS", "rtt", "rttVar", "rto", "rxWindow", "txSSThreshold",
+		"txCWindowBytes", "retransmits", "txBytes", "rxBytes":
+		return true
+	}
+	return false
+}
+
+// TCPState is a connection state, one of the TCPS_* constants.
+type TCPState uint8
+
+// String returns the name of the state, such as "ESTABLISHED", or "UNKNOWN" for values outside the TCPS_* range.
+func (s TCPState) String() string {
+	if name, ok := tcpStateMap[s]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
 // TCP state constants from xnu bsd/netinet/ip_compat.h
 const (
-	TCPS_CLOSED       = 0 /* closed */
-	TCPS_LISTEN       = 1 /* listening for connection */
-	TCPS_SYN_SENT     = 2 /* active, have sent syn */
-	TCPS_SYN_RECEIVED = 3 /* have send and received syn */
+	TCPS_CLOSED       TCPState = 0 /* closed */
+	TCPS_LISTEN       TCPState = 1 /* listening for connection */
+	TCPS_SYN_SENT     TCPState = 2 /* active, have sent syn */
+	TCPS_SYN_RECEIVED TCPState = 3 /* have send and received syn */
 	/* states < TCPS_ESTABLISHED are those where connections not established */
-	TCPS_ESTABLISHED = 4 /* established */
-	TCPS_CLOSE_WAIT  = 5 /* rcvd fin, waiting for close */
+	TCPS_ESTABLISHED TCPState = 4 /* established */
+	TCPS_CLOSE_WAIT  TCPState = 5 /* rcvd fin, waiting for close */
 	/* states > TCPS_CLOSE_WAIT are those where user has closed */
-	TCPS_FIN_WAIT_1 = 6 /* have closed, sent fin */
-	TCPS_CLOSING    = 7 /* closed xchd FIN; await FIN ACK */
-	TCPS_LAST_ACK   = 8 /* had fin and close; await FIN ACK */
+	TCPS_FIN_WAIT_1 TCPState = 6 /* have closed, sent fin */
+	TCPS_CLOSING    TCPState = 7 /* closed xchd FIN; await FIN ACK */
+	TCPS_LAST_ACK   TCPState = 8 /* had fin and close; await FIN ACK */
 	/* states > TCPS_CLOSE_WAIT && < TCPS_FIN_WAIT_2 await ACK of FIN */
-	TCPS_FIN_WAIT_2 = 9  /* have closed, fin is acked */
-	TCPS_TIME_WAIT  = 10 /* in 2*msl quiet wait after close */
+	TCPS_FIN_WAIT_2 TCPState = 9  /* have closed, fin is acked */
+	TCPS_TIME_WAIT  TCPState = 10 /* in 2*msl quiet wait after close */
 )
 
-var tcpStateMap = map[uint8]string{
+var tcpStateMap = map[TCPState]string{
 	TCPS_ESTABLISHED:  "ESTABLISHED",
 	TCPS_SYN_SENT:     "SYN_SENT",
 	TCPS_SYN_RECEIVED: "SYN_RECV",
@@ -314,15 +335,13 @@ var tcpOptions = []uint32{
 
 // ================================================================================================================== //
 
-// Errors from syscall package are private, so we define our own to match the errno.
-var (
-	EAGAIN error = syscall.EAGAIN
-	EINVAL error = syscall.EINVAL
-	ENOENT error = syscall.ENOENT
-)
-
-// GetTCPInfo calls getsockopt(2) on Linux to retrieve tcp_info and unpacks that into the golang-friendly TCPInfo.
+// GetTCPInfo calls getsockopt(2) on Darwin to retrieve tcp_connection_info and unpacks that into the golang-friendly
+// SysInfo. Kernels older than Darwin 15 (OS X 10.11) lack TCP_CONNECTION_INFO and get ErrUnsupported.
 func GetTCPInfo(fds uintptr) (*SysInfo, error) {
+	ensureKernelVersion()
+	if !darwinKernelVersionIsAtLeast_15 {
+		return nil, ErrUnsupported
+	}
 	fd := int(fds)
 	var value RawInfo
 	length := uint32(unsafe.Sizeof(value))
@@ -340,22 +359,87 @@ func GetTCPInfo(fds uintptr) (*SysInfo, error) {
 		0,
 	)
 	if errno != 0 {
-		switch errno {
-		case syscall.EAGAIN:
-			return nil, EAGAIN
-		case syscall.EINVAL:
-			return nil, EINVAL
-		case syscall.ENOENT:
-			return nil, ENOENT
-		}
-		return nil, errno
+		return nil, socketErr(fds, errno)
 	}
 
 	return value.Unpack(), nil
 }
 
 func Supported() bool {
-	return true
+	ensureKernelVersion()
+	return darwinKernelVersionIsAtLeast_15
+}
+
+// retransRate returns the fraction of sent packets that were retransmitted, for Info.Healthy.
+func (s *SysInfo) retransRate() (float64, bool) {
+	if s.TxPackets == 0 {
+		return 0, false
+	}
+	return float64(s.TxRetransmitPackets) / float64(s.TxPackets), true
+}
+
+// reorderRates is not available on Darwin, which does not count reordering or DSACKs.
+func (s *SysInfo) reorderRates() (reorder, dsack float64, ok bool) {
+	return 0, 0, false
+}
+
+// limitedFraction is not available on Darwin, which does not report send limits.
+func (s *SysInfo) limitedFraction() (float64, bool) {
+	return 0, false
+}
+
+// optionLists returns the decoded option lists, which ToInfo passes through to Info, for Info.Clone.
+func (s *SysInfo) optionLists() (tx, rx []Option) {
+	return s.TxOptions, s.RxOptions
+}
+
+// limitedTime is not available on Darwin, which does not report send limits.
+func (s *SysInfo) limitedTime() (rwnd, sndbuf time.Duration, ok bool) {
+	return 0, 0, false
+}
+
+// congestionAlgorithm is not available on Darwin, which has no TCP_CONGESTION.
+func (s *SysInfo) congestionAlgorithm() string {
+	return ""
+}
+
+// backoff is not available on Darwin, which does not report the RTO backoff.
+func (s *SysInfo) backoff() (uint8, bool) {
+	return 0, false
+}
+
+// receiverRTT is not available on Darwin, which has no receiver-side RTT estimate.
+func (s *SysInfo) receiverRTT() (time.Duration, bool) {
+	return 0, false
+}
+
+// tcpi_tfo_flags bits, in the order of the bitfield in struct tcp_connection_info.
+const (
+	tfoCookieReq    = 1 << 0
+	tfoSYNLoss      = 1 << 2
+	tfoSYNDataSent  = 1 << 3
+	tfoSYNDataAcked = 1 << 4
+	tfoSYNDataRcv   = 1 << 5
+)
+
+// fastOpen decodes tcpi_tfo_flags, for Info.FastOpen. A cookie request without SYN data means no cookie was cached.
+func (s *SysInfo) fastOpen() FastOpenResult {
+	switch f := s.TFOFlags; {
+	case f&(tfoSYNDataAcked|tfoSYNDataRcv) != 0:
+		return FastOpenResult{State: FastOpenSucceeded}
+	case f&tfoSYNLoss != 0:
+		return FastOpenResult{State: FastOpenFailed, Reason: FastOpenFailSYNRetransmitted}
+	case f&tfoSYNDataSent != 0:
+		return FastOpenResult{State: FastOpenFailed, Reason: FastOpenFailDataNotAcked}
+	case f&tfoCookieReq != 0:
+		return FastOpenResult{State: FastOpenFailed, Reason: FastOpenFailNoCookie}
+	}
+	return FastOpenResult{State: FastOpenNotAttempted}
+}
+
+// deliveredCE is not available on Darwin, which does not count CE-marked deliveries.
+func (s *SysInfo) deliveredCE() (delivered, ce uint32) {
+	return 0, 0
 }
 
 func (s *SysInfo) Warnings() []string {
@@ -3,11 +3,16 @@
 package tcpinfo
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"math/bits"
+	"reflect"
 	"strconv"
-	"syscall"
+	"strings"
+	"sync"
 	"time"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
@@ -111,9 +116,9 @@ type NullableDuration struct {
 
 // SysInfo is a gopher-style unpacked representation of RawTCPInfo.
 type SysInfo struct {
-	State                  uint8            `tcpi:"name=state,prom_type=gauge,prom_help='Connection state, see include/net/tcp_states.h.'" json:"-"`
+	State                  TCPState         `tcpi:"name=state,prom_type=gauge,prom_help='Connection state, see include/net/tcp_states.h.'" json:"-"`
 	StateName              string           `tcpi:"name=state_name,prom_type=gauge,prom_help='Connection state name, see include/net/tcp_states.h.'" json:"state"`
-	CAState                uint8            `tcpi:"name=ca_state,prom_type=gauge,prom_help='Loss recovery state machine, see include/net/tcp.h.'" json:"caState,omitempty"`
+	CAState                CAState          `tcpi:"name=ca_state,prom_type=gauge,prom_help='Loss recovery state machine, see include/net/tcp.h.'" json:"caState,omitempty"`
 	Retransmits            uint8            `tcpi:"name=retransmits,prom_type=gauge,prom_help='Number of timeouts (RTO based retransmissions) at this sequence (reset to zero on forward progress).'" json:"retransmits,omitempty"`
 	Probes                 uint8            `tcpi:"name=probes,prom_type=gauge,prom_help='Consecutive zero window probes that have gone unanswered.'" json:"probes,omitempty"`
 	Backoff                uint8            `tcpi:"name=backoff,prom_type=gauge,prom_help='Exponential timeout backoff counter. Increment on RTO, reset on successful RTT measurements.'" json:"backoff,omitempty"`
@@ -138,13 +143,13 @@ type SysInfo struct {
 	LastRxAckAt            time.Duration    `tcpi:"name=last_ack_recv,prom_type=gauge,prom_help='Time since last ACK was received. Quantized to jiffies.'" json:"lastRxAckAt,omitempty"`
 	PMTU                   uint32           `tcpi:"name=pmtu,prom_type=gauge,prom_help='Maximum IP Transmission Unit for this path.'" json:"pmtu,omitempty"`
 	RxSSThreshold          uint32           `tcpi:"name=rcv_ssthresh,prom_type=gauge,prom_help='Current Window Clamp. Receiver algorithm to avoid allocating excessive receive buffers.'" json:"rxSSThreshold,omitempty"`
-	RTT                    time.Duration    `tcpi:"name=rtt,prom_type=gauge,prom_help='Smoothed Round Trip Time (RTT). The Linux implementation differs from the standard.'" json:"rtt,omitempty"`
+	RTT                    time.Duration    `tcpi:"name=rtt,prom_type=gauge,prom_help='Sender side smoothed Round Trip Time (RTT), from acknowledgements of sent data. The Linux implementation differs from the standard.'" json:"rtt,omitempty"`
 	RTTVar                 time.Duration    `tcpi:"name=rttvar,prom_type=gauge,prom_help='RTT variance. The Linux implementation differs from the standard.'" json:"rttVar,omitempty"`
 	TxSSThreshold          uint32           `tcpi:"name=snd_ssthresh,prom_type=gauge,prom_help='Slow Start Threshold. Value controlled by the selected congestion control algorithm.'" json:"txSSThreshold,omitempty"`
 	TxCWindow              uint32           `tcpi:"name=snd_cwnd,prom_type=gauge,prom_help='Congestion Window. Value controlled by the selected congestion control algorithm.'" json:"txCWindow,omitempty"`
 	AdvMSS                 uint32           `tcpi:"name=advmss,prom_type=gauge,prom_help='Advertised maximum segment size.'" json:"advMSS,omitempty"`
 	Reordering             uint32           `tcpi:"name=reordering,prom_type=gauge,prom_help='Maximum observed reordering distance.'" json:"reordering,omitempty"`
-	RxRTT                  time.Duration    `tcpi:"name=rcv_rtt,prom_type=gauge,prom_help='Receiver Side RTT estimate.'" json:"rxRTT,omitempty"`
+	RxRTT                  time.Duration    `tcpi:"name=rcv_rtt,prom_type=gauge,prom_help='Receiver side RTT estimate, from the data received. Drives receive buffer auto-tuning; 0 until enough data has arrived.'" json:"rxRTT,omitempty"`
 	RxSpace                uint32           `tcpi:"name=rcv_space,prom_type=gauge,prom_help='Space reserved for the receive queue. Typically updated by receiver side auto-tuning.'" json:"rxSpace,omitempty"`
 	TotalRetrans           uint32           `tcpi:"name=total_retrans,prom_type=gauge,prom_help='Total number of segments containing retransmitted data.'" json:"totalRetrans,omitempty"`
 	PacingRate             NullableUint64   `tcpi:"name=pacing_rate,prom_type=gauge,prom_help='Current Pacing Rate, nominally updated by congestion control.'" json:"pacingRate,omitempty"`
@@ -158,9 +163,9 @@ type SysInfo struct {
 	DataSegsIn             NullableUint32   `tcpi:"name=data_segs_in,prom_type=gauge,prom_help='Input segments carrying data (len>0) | RFC4898 tcpEStatsDataSegsIn (actually tcpEStatsPerfDataSegsIn).'" json:"dataSegsIn,omitempty"`
 	DataSegsOut            NullableUint32   `tcpi:"name=data_segs_out,prom_type=gauge,prom_help='Transmitted segments carrying data (len>0) | RFC4898 tcpEStatsDataSegsOut (actually tcpEStatsPerfDataSegsOut).'" json:"dataSegsOut,omitempty"`
 	DeliveryRate           NullableUint64   `tcpi:"name=delivery_rate,prom_type=gauge,prom_help='Observed Maximum Delivery Rate.'" json:"deliveryRate,omitempty"`
-	BusyTime               NullableUint64   `tcpi:"name=busy_time,prom_type=gauge,prom_help='Time in usecs with outstanding (unacknowledged) data. Time when snd.una not equal to snd.next.'" json:"busyTime,omitempty"`
-	RxWindowLimited        NullableUint64   `tcpi:"name=rwnd_limited,prom_type=gauge,prom_help='Time in usecs spent limited by/waiting for receiver window.'" json:"rwndLimited,omitempty"`
-	TxBufferLimited        NullableUint64   `tcpi:"name=sndbuf_limited,prom_type=gauge,prom_help='Time in usecs spent limited by/waiting for sender buffer space. This only includes the time when TCP transmissions are starved for data, but the application has been stopped because the buffer is full and can not be grown for some reason.'" json:"sndbufLimited,omitempty"`
+	BusyTime               NullableUint64   `tcpi:"name=busy_time,prom_type=gauge,unit=us,prom_help='Time in usecs with outstanding (unacknowledged) data. Time when snd.una not equal to snd.next.'" json:"busyTime,omitempty"`
+	RxWindowLimited        NullableUint64   `tcpi:"name=rwnd_limited,prom_type=gauge,unit=us,prom_help='Time in usecs spent limited by/waiting for receiver window.'" json:"rwndLimited,omitempty"`
+	TxBufferLimited        NullableUint64   `tcpi:"name=sndbuf_limited,prom_type=gauge,unit=us,prom_help='Time in usecs spent limited by/waiting for sender buffer space. This only includes the time when TCP transmissions are starved for data, but the application has been stopped because the buffer is full and can not be grown for some reason.'" json:"sndbufLimited,omitempty"`
 	Delivered              NullableUint32   `tcpi:"name=delivered,prom_type=gauge,prom_help='Data segments delivered to the receiver including retransmits. As reported by returning ACKs, used by ECN.'" json:"delivered,omitempty"`
 	DeliveredCE            NullableUint32   `tcpi:"name=delivered_ce,prom_type=gauge,prom_help='ECE marked data segments delivered to the receiver including retransmits. As reported by returning ACKs, used by ECN.'" json:"deliveredCE,omitempty"`
 	BytesSent              NullableUint64   `tcpi:"name=bytes_sent,prom_type=gauge,prom_help='Payload bytes sent (excludes headers, includes retransmissions) | RFC4898 tcpEStatsPerfHCDataOctetsOut.'" json:"bytesSent,omitempty"`
@@ -173,7 +178,7 @@ type SysInfo struct {
 	Rehash                 NullableUint32   `tcpi:"name=rehash,prom_type=gauge,prom_help='PLB or timeout triggered rehash attempts.'" json:"rehash,omitempty"`
 	TotalRTO               NullableUint16   `tcpi:"name=total_rto,prom_type=counter,prom_help='Total number of RTO timeouts, including SYN/SYN-ACK and recurring timeouts.'" json:"totalRTO,omitempty"`
 	TotalRTORecoveries     NullableUint16   `tcpi:"name=total_rto_recoveries,prom_type=counter,prom_help='Total number of RTO recoveries, including any unfinished recovery.'" json:"totalRTORecoveries,omitempty"`
-	TotalRTOTime           NullableUint32   `tcpi:"name=total_rto_time,prom_type=counter,prom_help='Total time spent in RTO recoveries in nanoseconds, including any unfinished recovery.'" json:"totalRTOTime,omitempty"`
+	TotalRTOTime           NullableUint32   `tcpi:"name=total_rto_time,prom_type=counter,unit=ms,prom_help='Total time spent in RTO recoveries in milliseconds, including any unfinished recovery.'" json:"totalRTOTime,omitempty"`
 	CCAlgorithm            string           `tcpi:"name=cc_algorithm,prom_type=gauge,prom_help='Congestion control algorithm in use for this connection.'" json:"ccAlgorithm,omitempty"`
 	// Vegas
 	CCVegasEnabled NullableUint32   `tcpi:"name=cc_vegas_enabled,prom_type=gauge,prom_help='Whether TCP Vegas is enabled system-wide (true/false).'" json:"ccVegasEnabled,omitempty"`
@@ -192,6 +197,14 @@ type SysInfo struct {
 	CCDCTCPAlpha   NullableUint32 `tcpi:"name=cc_dctcp_alpha,prom_type=gauge,prom_help='DCTCP alpha parameter.'" json:"ccDCTCPAlpha,omitempty"`
 	CCDCTCPABECN   NullableUint32 `tcpi:"name=cc_dctcp_ab_ecn,prom_type=gauge,prom_help='DCTCP AB ECN count.'" json:"ccDCTCPABECN,omitempty"`
 	CCDCTCPABTOT   NullableUint32 `tcpi:"name=cc_dctcp_ab_tot,prom_type=gauge,prom_help='DCTCP AB total count.'" json:"ccDCTCPABTOT,omitempty"`
+
+	// Raw holds the unparsed tcp_info bytes when requested with GetOptions.KeepRaw, for decoding fields newer
+	// than this package models. It is nil otherwise.
+	Raw []byte `json:"-"`
+
+	// Truncated is set when the kernel returned fewer tcp_info bytes than its version is known to provide. Fields
+	// past the returned length are marked invalid instead of being reported as zero.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 func (s *SysInfo) Clone() *SysInfo {
@@ -200,15 +213,15 @@ func (s *SysInfo) Clone() *SysInfo {
 	}
 
 	clone := *s
-	clone.TxOptions = cloneOptions(s.TxOptions)
-	clone.RxOptions = cloneOptions(s.RxOptions)
+	clone.TxOptions, clone.RxOptions = cloneOptionPair(s.TxOptions, s.RxOptions)
+	clone.Raw = bytes.Clone(s.Raw)
 	return &clone
 }
 
 func (s *SysInfo) ToMap() map[string]any {
 	r := map[string]any{
 		"state":         s.StateName,
-		"caState":       s.CAState,
+		"caState":       uint8(s.CAState),
 		"retransmits":   s.Retransmits,
 		"probes":        s.Probes,
 		"backoff":       s.Backoff,
@@ -242,6 +255,9 @@ func (s *SysInfo) ToMap() map[string]any {
 		"totalRetrans":  s.TotalRetrans,
 		"ccAlgorithm":   s.CCAlgorithm,
 	}
+	if s.Truncated {
+		r["truncated"] = true
+	}
 	if s.DeliveryRateAppLimited.Valid {
 		r["deliveryRateAppLimited"] = s.DeliveryRateAppLimited.Value
 	}
@@ -378,33 +394,231 @@ func (s *SysInfo) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.ToMap())
 }
 
+// String returns a one-line summary in the style of `ss -ti`, e.g.
+// "ESTABLISHED cubic rtt:1.500/0.750ms rto:204.000ms mss:1448 cwnd:10 ssthresh:7 retrans:0/2 delivery_rate:94.21Mbps".
+func (s *SysInfo) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+
+	var b strings.Builder
+	b.WriteString(s.StateName)
+	if b.Len() == 0 {
+		b.WriteString("UNKNOWN")
+	}
+	if s.CCAlgorithm != "" {
+		b.WriteString(" " + s.CCAlgorithm)
+	}
+	fmt.Fprintf(&b, " rtt:%s/%sms rto:%sms", formatMillis(s.RTT), formatMillis(s.RTTVar), formatMillis(s.RTO))
+	fmt.Fprintf(&b, " mss:%d cwnd:%d", s.TxMSS, s.TxCWindow)
+	if s.TxSSThreshold > 0 && s.TxSSThreshold < infiniteSSThreshold {
+		fmt.Fprintf(&b, " ssthresh:%d", s.TxSSThreshold)
+	}
+	fmt.Fprintf(&b, " retrans:%d/%d", s.Retrans, s.TotalRetrans)
+	if s.DeliveryRate.Valid {
+		b.WriteString(" delivery_rate:" + formatMbps(s.DeliveryRate.Value))
+		if s.DeliveryRateAppLimited.Valid && s.DeliveryRateAppLimited.Value {
+			b.WriteString(" app_limited")
+		}
+	}
+	return b.String()
+}
+
+// infiniteSSThreshold is TCP_INFINITE_SSTHRESH from include/net/tcp.h; ss omits ssthresh until it drops below it.
+const infiniteSSThreshold = 0x7fffffff
+
+// ToMapWithUnits is like ToMap, but each time field is emitted as an object carrying the raw kernel value, its unit,
+// and the value converted to seconds, e.g. {"raw": 204000, "unit": "us", "seconds": 0.204}. The kernel measures
+// these timers in jiffies and converts them to usec or msec before reporting them, so the values are quantized to
+// the jiffy length (1ms at the common HZ=1000, up to 10ms at HZ=100).
+func (s *SysInfo) ToMapWithUnits() map[string]any {
+	r := s.ToMap()
+	for _, f := range []struct {
+		key   string
+		value time.Duration
+		unit  time.Duration
+	}{
+		{"rto", s.RTO, timeFieldMultiplier},
+		{"ato", s.ATO, timeFieldMultiplier},
+		{"lastTxAt", s.LastTxAt, msTimeFieldMultiplier},
+		{"lastTxAckAt", s.LastTxAckAt, msTimeFieldMultiplier},
+		{"lastRxAt", s.LastRxAt, msTimeFieldMultiplier},
+		{"lastRxAckAt", s.LastRxAckAt, msTimeFieldMultiplier},
+		{"rtt", s.RTT, timeFieldMultiplier},
+		{"rttVar", s.RTTVar, timeFieldMultiplier},
+		{"rxRTT", s.RxRTT, timeFieldMultiplier},
+	} {
+		r[f.key] = timeWithUnit(uint64(f.value/f.unit), f.unit)
+	}
+	if s.MinRTT.Valid {
+		r["minRTT"] = timeWithUnit(uint64(s.MinRTT.Value/timeFieldMultiplier), timeFieldMultiplier)
+	}
+	if s.BusyTime.Valid {
+		r["busyTime"] = timeWithUnit(s.BusyTime.Value, time.Microsecond)
+	}
+	if s.RxWindowLimited.Valid {
+		r["rxWindowLimited"] = timeWithUnit(s.RxWindowLimited.Value, time.Microsecond)
+	}
+	if s.TxBufferLimited.Valid {
+		r["txBufferLimited"] = timeWithUnit(s.TxBufferLimited.Value, time.Microsecond)
+	}
+	if s.TotalRTOTime.Valid {
+		r["totalRTOTime"] = timeWithUnit(uint64(s.TotalRTOTime.Value), time.Millisecond)
+	}
+	return r
+}
+
+func timeWithUnit(raw uint64, unit time.Duration) map[string]any {
+	name := "us"
+	if unit == time.Millisecond {
+		name = "ms"
+	}
+	return map[string]any{
+		"raw":     raw,
+		"unit":    name,
+		"seconds": (time.Duration(raw) * unit).Seconds(),
+	}
+}
+
+// ToFlatMap returns the fields as a flat map keyed by the snake_case names in the tcpi struct tags, the same names
+// the metric descriptions are built from, so JSON, exported metrics, and log output agree on one set of keys. Time
+// fields, whether time.Duration or raw kernel counters tagged with unit=us or unit=ms, are converted to float64
+// seconds. Rates (pacing_rate, max_pacing_rate, delivery_rate) are already bytes per second and are passed
+// through, as are counts and byte totals. Nullable fields the running kernel did not report are omitted rather
+// than emitted as zero.
+func (s *SysInfo) ToFlatMap() map[string]any {
+	v := reflect.ValueOf(s).Elem()
+	r := make(map[string]any, len(flatFields()))
+	for _, f := range flatFields() {
+		fv := v.Field(f.index)
+		if f.nullable {
+			if !fv.Field(0).Bool() {
+				continue
+			}
+			fv = fv.Field(1)
+		}
+		switch {
+		case fv.Type() == reflect.TypeFor[time.Duration]():
+			r[f.name] = time.Duration(fv.Int()).Seconds()
+		case f.unit != 0:
+			r[f.name] = (time.Duration(fv.Uint()) * f.unit).Seconds()
+		default:
+			r[f.name] = fv.Interface()
+		}
+	}
+	return r
+}
+
+// flatField is a SysInfo field with a tcpi tag, as emitted by ToFlatMap.
+type flatField struct {
+	index    int
+	name     string
+	unit     time.Duration
+	nullable bool
+}
+
+// flatFields lists the tagged SysInfo fields in declaration order. It is derived from the struct tags once.
+var flatFields = sync.OnceValue(func() []flatField {
+	t := reflect.TypeFor[SysInfo]()
+	var fields []flatField
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("tcpi")
+		if !ok {
+			continue
+		}
+		attrs := parseTCPITag(tag)
+		f := flatField{
+			index:    i,
+			name:     attrs["name"],
+			nullable: strings.HasPrefix(sf.Type.Name(), "Nullable"),
+		}
+		switch attrs["unit"] {
+		case "us":
+			f.unit = time.Microsecond
+		case "ms":
+			f.unit = time.Millisecond
+		}
+		fields = append(fields, f)
+	}
+	return fields
+})
+
+// parseTCPITag splits a tcpi struct tag such as "name=rtt,prom_type=gauge,prom_help='Smoothed RTT, in usec.'" into
+// its key=value attributes. Values may be wrapped in single quotes to contain commas.
+func parseTCPITag(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for tag != "" {
+		key, rest, _ := strings.Cut(tag, "=")
+		var value string
+		if strings.HasPrefix(rest, "'") {
+			value, rest, _ = strings.Cut(rest[1:], "'")
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[key] = value
+		tag = rest
+	}
+	return attrs
+}
+
 // timeFieldMultiplier is used to convert fields representing time in microseconds to time.Duration (nanoseconds).
 var timeFieldMultiplier = time.Microsecond
 
+// msTimeFieldMultiplier is used for the tcpi_last_* fields, which the kernel reports in milliseconds.
+var msTimeFieldMultiplier = time.Millisecond
+
 // Unpack copies fields from RawTCPInfo to TCPInfo, taking care of the bitfields and marking fields not provided
-// by older kernel versions as null. In the future it may deal with varying lengths of the struct returned by the
-// system call (i.e., kernels older than 5.4.0).
+// by older kernel versions as null.
 func (packed *RawTCPInfo) Unpack() *SysInfo {
+	return packed.unpack(int(unsafe.Sizeof(*packed)))
+}
+
+// UnpackInto is Unpack into s, which it overwrites. It reuses the backing arrays of s.TxOptions and s.RxOptions,
+// so a poller that keeps one SysInfo per connection allocates nothing per sample. An Info from s.ToInfo shares
+// those arrays, so it must not be kept across the next UnpackInto.
+func (packed *RawTCPInfo) UnpackInto(s *SysInfo) {
+	packed.unpackInto(s, int(unsafe.Sizeof(*packed)))
+}
+
+// unpack is Unpack for a RawTCPInfo of which the kernel only filled in the first length bytes. Nullable fields
+// that end past length are marked as null even when the kernel version says they exist, and Truncated is set
+// when length is shorter than the running kernel is known to provide.
+func (packed *RawTCPInfo) unpack(length int) *SysInfo {
 	var unpacked SysInfo
+	packed.unpackInto(&unpacked, length)
+	return &unpacked
+}
 
-	unpacked.State = packed.state
-	unpacked.StateName = tcpStateMap[packed.state]
+func (packed *RawTCPInfo) unpackInto(unpacked *SysInfo, length int) {
+	ensureKernelVersion()
+	txOptions, rxOptions := unpacked.TxOptions[:0], unpacked.RxOptions[:0]
+	*unpacked = SysInfo{}
+	unpacked.Truncated = length < sizeOfRawTCPInfo
+	filled := func(offset, size uintptr) bool { return offset+size <= uintptr(length) }
 
-	unpacked.CAState = packed.ca_state
+	unpacked.State = TCPState(packed.state)
+	unpacked.StateName = tcpStateMap[unpacked.State]
+
+	unpacked.CAState = CAState(packed.ca_state)
 	unpacked.Retransmits = packed.retransmits
 	unpacked.Probes = packed.probes
 	unpacked.Backoff = packed.backoff
 	unpacked.TxWindowScale = packed.bitfield0 & 0x0f
 	unpacked.RxWindowScale = packed.bitfield0 >> 4
 
+	// bitfield1 took over a padding byte, so it is always inside the returned length. Each of its bits is only
+	// trusted when the kernel also returned the field it was added alongside: delivery_rate for
+	// delivery_rate_app_limited (v4.9), and snd_wnd, the last field before it, for fastopen_client_fail (v5.5).
 	unpacked.DeliveryRateAppLimited = NullableBool{Valid: false}
-	if kernelVersionIsAtLeast_4_9 {
+	if kernelVersionIsAtLeast_4_9 && filled(unsafe.Offsetof(packed.delivery_rate), unsafe.Sizeof(packed.delivery_rate)) {
 		unpacked.DeliveryRateAppLimited.Valid = true
-		unpacked.DeliveryRateAppLimited.Value = packed.bitfield1&1 == 1 // added in v4.9
+		unpacked.DeliveryRateAppLimited.Value = packed.bitfield1&1 == 1
 	}
 
 	unpacked.FastOpenClientFail = NullableUint8{Valid: false}
-	if kernelVersionIsAtLeast_5_5 { // added in v5.5
+	if kernelVersionIsAtLeast_5_5 && filled(unsafe.Offsetof(packed.snd_wnd), unsafe.Sizeof(packed.snd_wnd)) {
 		unpacked.FastOpenClientFail.Valid = true
 		unpacked.FastOpenClientFail.Value = (packed.bitfield1 >> 1) & 0x3
 	}
@@ -418,10 +632,10 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 	unpacked.Lost = packed.lost
 	unpacked.Retrans = packed.retrans
 	unpacked.Fackets = packed.fackets
-	unpacked.LastTxAt = time.Duration(packed.last_data_sent) * timeFieldMultiplier
-	unpacked.LastTxAckAt = time.Duration(packed.last_ack_sent) * timeFieldMultiplier
-	unpacked.LastRxAt = time.Duration(packed.last_data_recv) * timeFieldMultiplier
-	unpacked.LastRxAckAt = time.Duration(packed.last_ack_recv) * timeFieldMultiplier
+	unpacked.LastTxAt = time.Duration(packed.last_data_sent) * msTimeFieldMultiplier
+	unpacked.LastTxAckAt = time.Duration(packed.last_ack_sent) * msTimeFieldMultiplier
+	unpacked.LastRxAt = time.Duration(packed.last_data_recv) * msTimeFieldMultiplier
+	unpacked.LastRxAckAt = time.Duration(packed.last_ack_recv) * msTimeFieldMultiplier
 	unpacked.PMTU = packed.pmtu
 	unpacked.RxSSThreshold = packed.rcv_ssthresh
 	unpacked.RTT = time.Duration(packed.rtt) * timeFieldMultiplier
@@ -435,7 +649,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 	unpacked.TotalRetrans = packed.total_retrans
 	unpacked.PacingRate = NullableUint64{Valid: false}
 	unpacked.MaxPacingRate = NullableUint64{Valid: false}
-	if kernelVersionIsAtLeast_3_15 {
+	if kernelVersionIsAtLeast_3_15 && filled(unsafe.Offsetof(packed.max_pacing_rate), unsafe.Sizeof(packed.max_pacing_rate)) {
 		unpacked.PacingRate.Valid = true
 		unpacked.PacingRate.Value = packed.pacing_rate
 		unpacked.MaxPacingRate.Valid = true
@@ -444,7 +658,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 
 	unpacked.BytesAcked = NullableUint64{Valid: false}
 	unpacked.BytesReceived = NullableUint64{Valid: false}
-	if kernelVersionIsAtLeast_4_1 {
+	if kernelVersionIsAtLeast_4_1 && filled(unsafe.Offsetof(packed.bytes_received), unsafe.Sizeof(packed.bytes_received)) {
 		unpacked.BytesAcked.Valid = true
 		unpacked.BytesAcked.Value = packed.bytes_acked
 		unpacked.BytesReceived.Valid = true
@@ -453,7 +667,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 
 	unpacked.SegsOut = NullableUint32{Valid: false}
 	unpacked.SegsIn = NullableUint32{Valid: false}
-	if kernelVersionIsAtLeast_4_2 {
+	if kernelVersionIsAtLeast_4_2 && filled(unsafe.Offsetof(packed.segs_in), unsafe.Sizeof(packed.segs_in)) {
 		unpacked.SegsOut.Valid = true
 		unpacked.SegsOut.Value = packed.segs_out
 		unpacked.SegsIn.Valid = true
@@ -464,7 +678,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 	unpacked.MinRTT = NullableDuration{Valid: false}
 	unpacked.DataSegsIn = NullableUint32{Valid: false}
 	unpacked.DataSegsOut = NullableUint32{Valid: false}
-	if kernelVersionIsAtLeast_4_6 {
+	if kernelVersionIsAtLeast_4_6 && filled(unsafe.Offsetof(packed.data_segs_out), unsafe.Sizeof(packed.data_segs_out)) {
 		unpacked.NotSentBytes.Valid = true
 		unpacked.NotSentBytes.Value = packed.notsent_bytes
 		unpacked.MinRTT.Valid = true
@@ -476,7 +690,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 	}
 
 	unpacked.DeliveryRate = NullableUint64{Valid: false}
-	if kernelVersionIsAtLeast_4_9 {
+	if kernelVersionIsAtLeast_4_9 && filled(unsafe.Offsetof(packed.delivery_rate), unsafe.Sizeof(packed.delivery_rate)) {
 		unpacked.DeliveryRate.Valid = true
 		unpacked.DeliveryRate.Value = packed.delivery_rate
 	}
@@ -484,7 +698,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 	unpacked.BusyTime = NullableUint64{Valid: false}
 	unpacked.RxWindowLimited = NullableUint64{Valid: false}
 	unpacked.TxBufferLimited = NullableUint64{Valid: false}
-	if kernelVersionIsAtLeast_4_10 {
+	if kernelVersionIsAtLeast_4_10 && filled(unsafe.Offsetof(packed.sndbuf_limited), unsafe.Sizeof(packed.sndbuf_limited)) {
 		unpacked.BusyTime.Valid = true
 		unpacked.BusyTime.Value = packed.busy_time
 		unpacked.RxWindowLimited.Valid = true
@@ -495,7 +709,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 
 	unpacked.Delivered = NullableUint32{Valid: false}
 	unpacked.DeliveredCE = NullableUint32{Valid: false}
-	if kernelVersionIsAtLeast_4_18 {
+	if kernelVersionIsAtLeast_4_18 && filled(unsafe.Offsetof(packed.delivered_ce), unsafe.Sizeof(packed.delivered_ce)) {
 		unpacked.Delivered.Valid = true
 		unpacked.Delivered.Value = packed.delivered
 		unpacked.DeliveredCE.Valid = true
@@ -506,7 +720,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 	unpacked.BytesRetrans = NullableUint64{Valid: false}
 	unpacked.DSACKDups = NullableUint32{Valid: false}
 	unpacked.ReordSeen = NullableUint32{Valid: false}
-	if kernelVersionIsAtLeast_4_19 {
+	if kernelVersionIsAtLeast_4_19 && filled(unsafe.Offsetof(packed.reord_seen), unsafe.Sizeof(packed.reord_seen)) {
 		unpacked.BytesSent.Valid = true
 		unpacked.BytesSent.Value = packed.bytes_sent
 		unpacked.BytesRetrans.Valid = true
@@ -519,7 +733,7 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 
 	unpacked.RxOutOfOrder = NullableUint32{Valid: false}
 	unpacked.TxWindow = NullableUint32{Valid: false}
-	if kernelVersionIsAtLeast_5_4 {
+	if kernelVersionIsAtLeast_5_4 && filled(unsafe.Offsetof(packed.snd_wnd), unsafe.Sizeof(packed.snd_wnd)) {
 		unpacked.RxOutOfOrder.Valid = true
 		unpacked.RxOutOfOrder.Value = packed.rcv_ooopack
 		unpacked.TxWindow.Valid = true
@@ -531,11 +745,14 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 	unpacked.TotalRTO = NullableUint16{Valid: false}
 	unpacked.TotalRTORecoveries = NullableUint16{Valid: false}
 	unpacked.TotalRTOTime = NullableUint32{Valid: false}
-	if kernelVersionIsAtLeast_6_2 {
+	if kernelVersionIsAtLeast_6_2 && filled(unsafe.Offsetof(packed.rehash), unsafe.Sizeof(packed.rehash)) {
 		unpacked.RxWindow.Valid = true
 		unpacked.RxWindow.Value = packed.rcv_wnd
 		unpacked.Rehash.Valid = true
 		unpacked.Rehash.Value = packed.rehash
+	}
+	// The RTO totals were added in v6.7; on v6.2 through v6.6 the shorter length the kernel returns leaves them null.
+	if kernelVersionIsAtLeast_6_2 && filled(unsafe.Offsetof(packed.total_rto_time), unsafe.Sizeof(packed.total_rto_time)) {
 		unpacked.TotalRTO.Valid = true
 		unpacked.TotalRTO.Value = packed.total_rto
 		unpacked.TotalRTORecoveries.Valid = true
@@ -544,26 +761,33 @@ func (packed *RawTCPInfo) Unpack() *SysInfo {
 		unpacked.TotalRTOTime.Value = packed.total_rto_time
 	}
 
+	// Size both option lists up front, from one allocation, instead of growing them flag by flag.
+	if n := bits.OnesCount8(packed.options); n > 0 && (cap(txOptions) < n || cap(rxOptions) < n) {
+		buf := make([]Option, 2*n)
+		txOptions, rxOptions = buf[:0:n], buf[n:n:2*n]
+	}
 	for _, flag := range tcpOptions {
 		if packed.options&flag == 0 {
 			continue
 		}
 		switch flag {
 		case TCPI_OPT_TIMESTAMPS, TCPI_OPT_SACK, TCPI_OPT_ECN, TCPI_OPT_ECN_SEEN, TCPI_OPT_SYN_DATA, TCPI_OPT_USEC_TS, TCPI_OPT_TFO_CHILD:
-			unpacked.TxOptions = append(unpacked.TxOptions, Option{Kind: tcpOptionsMap[flag], Value: 0})
-			unpacked.RxOptions = append(unpacked.RxOptions, Option{Kind: tcpOptionsMap[flag], Value: 0})
+			txOptions = append(txOptions, Option{Kind: tcpOptionsMap[flag], Value: 0})
+			rxOptions = append(rxOptions, Option{Kind: tcpOptionsMap[flag], Value: 0})
 		case TCPI_OPT_WSCALE:
-			unpacked.TxOptions = append(unpacked.TxOptions, Option{Kind: tcpOptionsMap[flag], Value: uint64(unpacked.TxWindowScale)})
-			unpacked.RxOptions = append(unpacked.RxOptions, Option{Kind: tcpOptionsMap[flag], Value: uint64(unpacked.RxWindowScale)})
+			txOptions = append(txOptions, Option{Kind: tcpOptionsMap[flag], Value: uint64(unpacked.TxWindowScale)})
+			rxOptions = append(rxOptions, Option{Kind: tcpOptionsMap[flag], Value: uint64(unpacked.RxWindowScale)})
 		}
 	}
-
-	return &unpacked
+	if len(txOptions) > 0 {
+		unpacked.TxOptions, unpacked.RxOptions = txOptions, rxOptions
+	}
 }
 
 func (s *SysInfo) ToInfo() *Info {
 	info := &Info{
 		State:         s.StateName,
+		CAState:       s.CAState,
 		TxOptions:     s.TxOptions,
 		RxOptions:     s.RxOptions,
 		TxMSS:         uint64(s.TxMSS),
@@ -583,13 +807,74 @@ func (s *SysInfo) ToInfo() *Info {
 		Retransmits:   uint64(s.TotalRetrans),
 		Sys:           s,
 	}
+	if s.BytesSent.Valid {
+		info.TxBytes = s.BytesSent.Value
+	}
+	if s.BytesAcked.Valid {
+		info.BytesAcked = s.BytesAcked.Value
+	}
+	if s.BytesReceived.Valid {
+		info.RxBytes = s.BytesReceived.Value
+	}
+	if s.MinRTT.Valid {
+		info.MinRTT = s.MinRTT.Value
+	}
+	if s.DeliveryRate.Valid {
+		info.DeliveryRate = s.DeliveryRate.Value
+	}
+	if s.DeliveryRateAppLimited.Valid {
+		info.AppLimited = s.DeliveryRateAppLimited.Value
+	}
 
 	return info
 }
 
+// reportsInfoField reports whether ToInfo fills the Info field with the given ToMap key from data the running
+// kernel provided. last_ack_sent is never updated by the kernel, so lastTxAckAt is treated as absent.
+func (s *SysInfo) reportsInfoField(key string) bool {
+	switch key {
+	case "txCWindowBytes", "lastTxAckAt":
+		return false
+	case "txBytes":
+		return s.BytesSent.Valid
+	case "rxBytes":
+		return s.BytesReceived.Valid
+	case "bytesAcked":
+		return s.BytesAcked.Valid
+	case "minRTT":
+		return s.MinRTT.Valid
+	case "deliveryRate":
+		return s.DeliveryRate.Valid
+	case "appLimited":
+		return s.DeliveryRateAppLimited.Valid
+	}
+	return true
+}
+
+// TCPState is a connection state, one of the TCP_* state constants.
+type TCPState uint8
+
+// String returns the name of the state, such as "ESTABLISHED", or "UNKNOWN" for values outside the TCP_* range.
+func (s TCPState) String() string {
+	if name, ok := tcpStateMap[s]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// handshakeDone reports whether a socket in state s has completed the three-way handshake, so its tcp_info
+// describes a connection rather than a listener or a connection attempt.
+func handshakeDone(s TCPState) bool {
+	switch s {
+	case TCP_LISTEN, TCP_SYN_SENT, TCP_SYN_RECV, TCP_NEW_SYN_RECV:
+		return false
+	}
+	return true
+}
+
 // TCP state constants from linux net/tcp_states.h
 const (
-	TCP_ESTABLISHED = iota + 1
+	TCP_ESTABLISHED TCPState = iota + 1
 	TCP_SYN_SENT
 	TCP_SYN_RECV
 	TCP_FIN_WAIT1
@@ -603,18 +888,19 @@ const (
 	TCP_NEW_SYN_RECV
 )
 
-var tcpStateMap = map[uint8]string{
-	TCP_ESTABLISHED: "ESTABLISHED",
-	TCP_SYN_SENT:    "SYN_SENT",
-	TCP_SYN_RECV:    "SYN_RECV",
-	TCP_FIN_WAIT1:   "FIN_WAIT1",
-	TCP_FIN_WAIT2:   "FIN_WAIT2",
-	TCP_TIME_WAIT:   "TIME_WAIT",
-	TCP_CLOSE:       "CLOSE",
-	TCP_CLOSE_WAIT:  "CLOSE_WAIT",
-	TCP_LAST_ACK:    "LAST_ACK",
-	TCP_LISTEN:      "LISTEN",
-	TCP_CLOSING:     "CLOSING",
+var tcpStateMap = map[TCPState]string{
+	TCP_ESTABLISHED:  "ESTABLISHED",
+	TCP_SYN_SENT:     "SYN_SENT",
+	TCP_SYN_RECV:     "SYN_RECV",
+	TCP_FIN_WAIT1:    "FIN_WAIT1",
+	TCP_FIN_WAIT2:    "FIN_WAIT2",
+	TCP_TIME_WAIT:    "TIME_WAIT",
+	TCP_CLOSE:        "CLOSE",
+	TCP_CLOSE_WAIT:   "CLOSE_WAIT",
+	TCP_LAST_ACK:     "LAST_ACK",
+	TCP_LISTEN:       "LISTEN",
+	TCP_CLOSING:      "CLOSING",
+	TCP_NEW_SYN_RECV: "NEW_SYN_RECV",
 }
 
 // TCP option flags from linux uapi/linux/tcp.h
@@ -651,21 +937,14 @@ var tcpOptions = []uint8{
 	TCPI_OPT_TFO_CHILD,
 }
 
-// Errors from syscall package are private, so we define our own to match the errno.
-var (
-	EAGAIN error = syscall.EAGAIN
-	EINVAL error = syscall.EINVAL
-	ENOENT error = syscall.ENOENT
-)
-
-var ErrKernelTooOld = errors.New("tcp_info is not available on Linux prior to kernel 2.6.2")
+var ErrKernelTooOld = fmt.Errorf("%w: tcp_info is not available on Linux prior to kernel 2.6.2", ErrUnsupported)
 
 // GetTCPCongestionAlgorithm retrieves the TCP congestion control algorithm in use for the given socket.
 // The returned string is one of "vegas", "dctp", "bbr", "cubic", or newer algorithms.
 func GetTCPCongestionAlgorithm(fds uintptr) (string, error) {
 	algo, err := unix.GetsockoptString(int(fds), unix.IPPROTO_TCP, unix.TCP_CONGESTION)
 	if err != nil {
-		return "", err
+		return "", sockoptErr(err)
 	}
 	return algo, nil
 }
@@ -676,11 +955,20 @@ type TCPInfoPlusCC struct {
 	CCVegas *unix.TCPVegasInfo
 	CCBBR   *unix.TCPBBRInfo
 	CCDCTP  *unix.TCPDCTCPInfo
+	Raw     []byte
+
+	length int // Bytes of TCPInfo the kernel filled in; zero means all of it
 }
 
 func (t *TCPInfoPlusCC) Unpack() *SysInfo {
-	sysInfo := t.TCPInfo.Unpack()
+	var sysInfo *SysInfo
+	if t.length > 0 {
+		sysInfo = t.TCPInfo.unpack(t.length)
+	} else {
+		sysInfo = t.TCPInfo.Unpack()
+	}
 	sysInfo.CCAlgorithm = t.CCAlg
+	sysInfo.Raw = t.Raw
 
 	if t.CCAlg == "vegas" && t.CCVegas != nil {
 		sysInfo.CCVegasEnabled = NullableUint32{Valid: true, Value: t.CCVegas.Enabled}
@@ -707,20 +995,133 @@ func (t *TCPInfoPlusCC) Unpack() *SysInfo {
 	return sysInfo
 }
 
+// maxRawTCPInfoSize bounds the buffer offered to the kernel when GetOptions.KeepRaw is set. It leaves ample room
+// for fields appended to tcp_info after the newest layout RawTCPInfo models.
+const maxRawTCPInfoSize = 512
+
+// GetOptions controls optional work done by GetTCPInfoWithOptions.
+type GetOptions struct {
+	// KeepRaw retains the bytes the kernel returned for tcp_info in SysInfo.Raw, including any fields newer
+	// than this package decodes. It costs one extra allocation per call, so it is off by default.
+	KeepRaw bool
+
+	// Level and OptName override the getsockopt level and option name tcp_info is read with, for network stacks
+	// that expose it differently. Zero keeps the defaults, SOL_TCP and TCP_INFO. The congestion control options
+	// are still read at SOL_TCP.
+	Level   int
+	OptName int
+
+	// RequireEstablished makes GetTCPInfoWithOptions return ErrNotEstablished, and no SysInfo, for sockets in
+	// LISTEN, SYN_SENT, SYN_RECV or NEW_SYN_RECV, whose tcp_info holds little beyond the state and the zero
+	// values of a connection that has not started, instead of reading the congestion control details.
+	RequireEstablished bool
+}
+
+// sockopt returns the getsockopt level and option name to read tcp_info with.
+func (o GetOptions) sockopt() (level, opt int) {
+	level, opt = unix.SOL_TCP, unix.TCP_INFO
+	if o.Level != 0 {
+		level = o.Level
+	}
+	if o.OptName != 0 {
+		opt = o.OptName
+	}
+	return level, opt
+}
+
+// tcpInfoErr adds the getsockopt level and option name that tcp_info was read with to err, so a failure such as
+// EINVAL on an unusual network stack shows what was asked for.
+func tcpInfoErr(level, opt int, err error) error {
+	levelName, optName := "level "+strconv.Itoa(level), "optname "+strconv.Itoa(opt)
+	if level == unix.SOL_TCP {
+		levelName = "SOL_TCP"
+	}
+	if opt == unix.TCP_INFO {
+		optName = "TCP_INFO"
+	}
+	return fmt.Errorf("getsockopt(%s, %s): %w", levelName, optName, err)
+}
+
+// GetRawTCPInfo calls getsockopt(2) on Linux to retrieve tcp_info, reading only as much of the struct as the
+// running kernel is known to provide.
+func GetRawTCPInfo(fd uintptr) (*RawTCPInfo, error) {
+	value, _, err := getRawTCPInfo(fd, unix.SOL_TCP, unix.TCP_INFO)
+	return value, err
+}
+
+// getRawTCPInfo is GetRawTCPInfo with the getsockopt level and option name to use, that also returns how many
+// bytes the kernel wrote.
+func getRawTCPInfo(fd uintptr, level, opt int) (*RawTCPInfo, int, error) {
+	ensureKernelVersion()
+	var value RawTCPInfo
+	length := uint32(sizeOfRawTCPInfo)
+	if err := getsockoptTCPInfo(fd, level, opt, unsafe.Pointer(&value), &length); err != nil {
+		return nil, 0, tcpInfoErr(level, opt, err)
+	}
+	return &value, int(length), nil
+}
+
+// GetRawTCPInfoBytes calls getsockopt(2) on Linux and returns tcp_info exactly as the kernel wrote it, which may
+// be longer than RawTCPInfo on newer kernels.
+func GetRawTCPInfoBytes(fd uintptr) ([]byte, error) {
+	return getRawTCPInfoBytes(fd, unix.SOL_TCP, unix.TCP_INFO)
+}
+
+// getRawTCPInfoBytes is GetRawTCPInfoBytes with the getsockopt level and option name to use.
+func getRawTCPInfoBytes(fd uintptr, level, opt int) ([]byte, error) {
+	buf := make([]byte, maxRawTCPInfoSize)
+	length := uint32(len(buf))
+	if err := getsockoptTCPInfo(fd, level, opt, unsafe.Pointer(&buf[0]), &length); err != nil {
+		return nil, tcpInfoErr(level, opt, err)
+	}
+	return buf[:length], nil
+}
+
+// rawTCPInfoFromBytes decodes the prefix of raw that the running kernel is known to provide into a RawTCPInfo.
+func rawTCPInfoFromBytes(raw []byte) *RawTCPInfo {
+	ensureKernelVersion()
+	var value RawTCPInfo
+	dst := unsafe.Slice((*byte)(unsafe.Pointer(&value)), min(sizeOfRawTCPInfo, int(unsafe.Sizeof(value))))
+	copy(dst, raw)
+	return &value
+}
+
 // GetTCPInfo retrieves the TCP_INFO struct along with the congestion control algorithm and algorithm-specific info.
 func GetTCPInfo(fds uintptr) (*SysInfo, error) {
+	return GetTCPInfoWithOptions(fds, GetOptions{})
+}
+
+// GetTCPInfoWithOptions is GetTCPInfo with optional extras controlled by opts.
+func GetTCPInfoWithOptions(fds uintptr, opts GetOptions) (*SysInfo, error) {
 	res := &TCPInfoPlusCC{}
 
 	fd := int(fds)
+	ensureKernelVersion()
 	if !kernelVersionIsAtLeast_2_6_2 {
 		return nil, ErrKernelTooOld
 	}
 
-	tcpInfo, err := GetRawTCPInfo(fds)
-	if err != nil {
-		return nil, err
+	level, opt := opts.sockopt()
+	if opts.KeepRaw {
+		raw, err := getRawTCPInfoBytes(fds, level, opt)
+		if err != nil {
+			return nil, err
+		}
+		res.Raw = raw
+		res.TCPInfo = rawTCPInfoFromBytes(raw)
+		res.length = len(raw)
+	} else {
+		tcpInfo, length, err := getRawTCPInfo(fds, level, opt)
+		if err != nil {
+			return nil, err
+		}
+		res.TCPInfo = tcpInfo
+		res.length = length
+	}
+
+	if state := TCPState(res.TCPInfo.state); opts.RequireEstablished && !handshakeDone(state) {
+		return nil, fmt.Errorf("%w: socket is in %s", ErrNotEstablished, state)
 	}
-	res.TCPInfo = tcpInfo
 
 	// Now resolve the congestion control algorithm data
 	alg, err := GetTCPCongestionAlgorithm(fds)
@@ -733,19 +1134,19 @@ func GetTCPInfo(fds uintptr) (*SysInfo, error) {
 	case "vegas":
 		v, err := unix.GetsockoptTCPCCVegasInfo(fd, unix.IPPROTO_TCP, 0)
 		if err != nil {
-			return res.Unpack(), err
+			return res.Unpack(), sockoptErr(err)
 		}
 		res.CCVegas = v
 	case "bbr":
 		v, err := unix.GetsockoptTCPCCBBRInfo(fd, unix.IPPROTO_TCP, 0)
 		if err != nil {
-			return res.Unpack(), err
+			return res.Unpack(), sockoptErr(err)
 		}
 		res.CCBBR = v
 	case "dctcp":
 		v, err := unix.GetsockoptTCPCCDCTCPInfo(fd, unix.IPPROTO_TCP, 0)
 		if err != nil {
-			return res.Unpack(), err
+			return res.Unpack(), sockoptErr(err)
 		}
 		res.CCDCTP = v
 	}
@@ -754,6 +1155,7 @@ func GetTCPInfo(fds uintptr) (*SysInfo, error) {
 }
 
 func Supported() bool {
+	ensureKernelVersion()
 	return kernelVersionIsAtLeast_2_6_2
 }
 
@@ -777,5 +1179,153 @@ func (s *SysInfo) Warnings() []string {
 	if s.RxWindowLimited.Valid && s.RxWindowLimited.Value > 0 {
 		warns = append(warns, "rxWindowLimited="+strconv.FormatUint(s.RxWindowLimited.Value, 10))
 	}
+	if s.DeliveryRateAppLimited.Valid && s.DeliveryRateAppLimited.Value {
+		warns = append(warns, WarnAppLimited)
+	}
+	return append(warns, s.thresholdWarnings(DefaultThresholds)...)
+}
+
+// thresholdWarnings reports rate-based diagnostics that exceed the given thresholds, plus resets.
+func (s *SysInfo) thresholdWarnings(th Thresholds) []string {
+	var warns []string
+	if s.SegsOut.Valid && s.SegsOut.Value > 0 {
+		if rate := float64(s.TotalRetrans) / float64(s.SegsOut.Value); rate >= th.RetransRate && s.TotalRetrans > 0 {
+			warns = append(warns, "highRetransRatePct="+formatPct(rate))
+		}
+	}
+	if s.BusyTime.Valid && s.BusyTime.Value > 0 {
+		busy := float64(s.BusyTime.Value)
+		if s.RxWindowLimited.Valid && s.RxWindowLimited.Value > 0 {
+			if frac := float64(s.RxWindowLimited.Value) / busy; frac >= th.LimitedFraction {
+				warns = append(warns, "rxWindowLimitedPct="+formatPct(frac))
+			}
+		}
+		if s.TxBufferLimited.Valid && s.TxBufferLimited.Value > 0 {
+			if frac := float64(s.TxBufferLimited.Value) / busy; frac >= th.LimitedFraction {
+				warns = append(warns, "txSendBufferLimitedPct="+formatPct(frac))
+			}
+		}
+	}
+	// A socket the application still holds only reaches CLOSE when the peer reset it or it timed out.
+	if s.State == TCP_CLOSE {
+		warns = append(warns, WarnConnectionReset)
+	}
 	return warns
 }
+
+// retransRate returns the fraction of sent segments that were retransmitted, for Info.Healthy.
+func (s *SysInfo) retransRate() (float64, bool) {
+	if !s.SegsOut.Valid || s.SegsOut.Value == 0 {
+		return 0, false
+	}
+	return float64(s.TotalRetrans) / float64(s.SegsOut.Value), true
+}
+
+// reorderRates returns the out-of-order ACKs and the DSACK-reported duplicate segments per segment sent, for
+// Info.PathQuality. Both counters need Linux 4.19+.
+func (s *SysInfo) reorderRates() (reorder, dsack float64, ok bool) {
+	if !s.SegsOut.Valid || s.SegsOut.Value == 0 || !s.ReordSeen.Valid || !s.DSACKDups.Valid {
+		return 0, 0, false
+	}
+	out := float64(s.SegsOut.Value)
+	return float64(s.ReordSeen.Value) / out, float64(s.DSACKDups.Value) / out, true
+}
+
+// limitedFraction returns the larger of the fractions of busy time spent limited by the receive window and by the
+// send buffer, for Info.Healthy.
+func (s *SysInfo) limitedFraction() (float64, bool) {
+	if !s.BusyTime.Valid || s.BusyTime.Value == 0 || !s.RxWindowLimited.Valid || !s.TxBufferLimited.Valid {
+		return 0, false
+	}
+	return float64(max(s.RxWindowLimited.Value, s.TxBufferLimited.Value)) / float64(s.BusyTime.Value), true
+}
+
+// optionLists returns the decoded option lists, which ToInfo passes through to Info, for Info.Clone.
+func (s *SysInfo) optionLists() (tx, rx []Option) {
+	return s.TxOptions, s.RxOptions
+}
+
+// limitedTime returns the time spent limited by the receive window and by the send buffer, for Info.LimitedTime.
+func (s *SysInfo) limitedTime() (rwnd, sndbuf time.Duration, ok bool) {
+	if !s.RxWindowLimited.Valid || !s.TxBufferLimited.Valid {
+		return 0, 0, false
+	}
+	return time.Duration(s.RxWindowLimited.Value) * time.Microsecond, time.Duration(s.TxBufferLimited.Value) * time.Microsecond, true
+}
+
+// congestionAlgorithm returns CCAlgorithm, for Info.CongestionAlgorithm.
+func (s *SysInfo) congestionAlgorithm() string {
+	return s.CCAlgorithm
+}
+
+// backoff returns tcpi_backoff, for Info.Backoff.
+func (s *SysInfo) backoff() (uint8, bool) {
+	return s.Backoff, true
+}
+
+// receiverRTT returns tcpi_rcv_rtt, for Info.ReceiverRTT.
+func (s *SysInfo) receiverRTT() (time.Duration, bool) {
+	return s.RxRTT, s.RxRTT > 0
+}
+
+// fastOpen combines the SYN_DATA and TFO_CHILD options with tcpi_fastopen_client_fail, for Info.FastOpen. Without
+// the fail reason, before Linux 5.5, a connection without SYN data may have failed an attempt or never made one.
+func (s *SysInfo) fastOpen() FastOpenResult {
+	for _, opt := range s.TxOptions {
+		if opt.Kind == "SYNData" || opt.Kind == "TFOChild" {
+			return FastOpenResult{State: FastOpenSucceeded}
+		}
+	}
+	switch {
+	case !s.FastOpenClientFail.Valid:
+		return FastOpenResult{}
+	case s.FastOpenClientFail.Value != 0:
+		return FastOpenResult{State: FastOpenFailed, Reason: FastOpenFailReason(s.FastOpenClientFail.Value)}
+	}
+	return FastOpenResult{State: FastOpenNotAttempted}
+}
+
+// deliveredCE returns the delivered and CE-marked delivered segment counts, for Info.ECN. Both are zero before
+// Linux 4.18.
+func (s *SysInfo) deliveredCE() (delivered, ce uint32) {
+	if !s.Delivered.Valid || !s.DeliveredCE.Valid {
+		return 0, 0
+	}
+	return s.Delivered.Value, s.DeliveredCE.Value
+}
+
+// BytesInFlight estimates the payload bytes sent but not yet acknowledged: the kernel's tcp_packets_in_flight
+// (unacked - sacked - lost + retrans segments) multiplied by the send MSS.
+func (s *SysInfo) BytesInFlight() uint64 {
+	segs := int64(s.UnAcked) - int64(s.Sacked) - int64(s.Lost) + int64(s.Retrans)
+	if segs <= 0 {
+		return 0
+	}
+	return uint64(segs) * uint64(s.TxMSS)
+}
+
+// SendWindowUtilization returns BytesInFlight as a fraction of the peer's advertised receive window (snd_wnd).
+// Values near 1 mean the receiver's window, not congestion or the application, is limiting the sender. The
+// estimate counts whole segments, so it can slightly exceed 1. ok is false before Linux 5.4, which does not report
+// snd_wnd, and while the peer advertises a zero window.
+func (s *SysInfo) SendWindowUtilization() (ratio float64, ok bool) {
+	if !s.TxWindow.Valid || s.TxWindow.Value == 0 {
+		return 0, false
+	}
+	return float64(s.BytesInFlight()) / float64(s.TxWindow.Value), true
+}
+
+// ReceiveWindowUtilization returns rcv_space, the bytes the application read during the last measured RTT, as a
+// fraction of rcv_ssthresh, the current clamp on the advertised receive window. Values near 1 mean the local
+// receive window is likely limiting the sender. rcv_space is only updated once per RTT while data arrives, so the
+// ratio lags the connection and says nothing about an idle one. ok is false when rcv_ssthresh is zero.
+func (s *SysInfo) ReceiveWindowUtilization() (ratio float64, ok bool) {
+	if s.RxSSThreshold == 0 {
+		return 0, false
+	}
+	return float64(s.RxSpace) / float64(s.RxSSThreshold), true
+}
+
+func formatPct(frac float64) string {
+	return strconv.FormatFloat(frac*100, 'f', 2, 64)
+}
@@ -4,30 +4,30 @@ package tcpinfo
 
 import (
 	"runtime"
-	"syscall"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
+// netGetSockOpt is the SYS_GETSOCKOPT call number for socketcall(2), see include/uapi/linux/net.h.
 const netGetSockOpt = 15
 
-// GetRawTCPInfo calls socketcall(2) on Linux to retrieve tcp_info and unpacks that into the golang-friendly TCPInfo.
-// This variant is for the 32-bit x86 (386) architecture.
+// getsockoptTCPInfo calls socketcall(2) on Linux to copy up to *length bytes of tcp_info, read with the given
+// level and optname, into value, updating *length to the number of bytes the kernel wrote.
+// This variant is for the 32-bit x86 (386) architecture, where getsockopt is multiplexed through socketcall.
 //
 // The args array stores pointers to value and length as uintptr. To satisfy
 // Go's unsafe.Pointer rules we pin both variables with runtime.KeepAlive
 // so the GC cannot collect or relocate them before the syscall completes.
-func GetRawTCPInfo(fd uintptr) (*RawTCPInfo, error) {
-	var value RawTCPInfo
-	length := uint32(sizeOfRawTCPInfo)
-
+func getsockoptTCPInfo(fd uintptr, level, opt int, value unsafe.Pointer, length *uint32) error {
 	args := [5]uintptr{
-		uintptr(fd),
-		uintptr(syscall.SOL_TCP), uintptr(syscall.TCP_INFO),
-		uintptr(unsafe.Pointer(&value)), uintptr(unsafe.Pointer(&length)),
+		fd,
+		uintptr(level), uintptr(opt),
+		uintptr(value), uintptr(unsafe.Pointer(length)),
 	}
 
-	_, _, errNo := syscall.RawSyscall(
-		syscall.SYS_SOCKETCALL,
+	_, _, errNo := unix.Syscall(
+		unix.SYS_SOCKETCALL,
 		netGetSockOpt,
 		uintptr(unsafe.Pointer(&args)),
 		0,
@@ -35,20 +35,11 @@ func GetRawTCPInfo(fd uintptr) (*RawTCPInfo, error) {
 
 	// Keep value and length alive across the syscall so the GC does not
 	// collect them while their addresses are held in the args array.
-	runtime.KeepAlive(&value)
-	runtime.KeepAlive(&length)
+	runtime.KeepAlive(value)
+	runtime.KeepAlive(length)
 
 	if errNo != 0 {
-		switch errNo {
-		case syscall.EAGAIN:
-			return nil, EAGAIN
-		case syscall.EINVAL:
-			return nil, EINVAL
-		case syscall.ENOENT:
-			return nil, ENOENT
-		}
-		return nil, errNo
+		return socketErr(fd, errNo)
 	}
-
-	return &value, nil
+	return nil
 }
@@ -3,34 +3,26 @@
 package tcpinfo
 
 import (
-	"syscall"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
-// GetRawTCPInfo calls getsockopt(2) on Linux to retrieve tcp_info and unpacks that into the golang-friendly TCPInfo.
-// This variant is for all non-x86 (386) architectures.
-func GetRawTCPInfo(fd uintptr) (*RawTCPInfo, error) {
-	var value RawTCPInfo
-	length := uint32(sizeOfRawTCPInfo)
-	_, _, errNo := syscall.Syscall6(
-		syscall.SYS_GETSOCKOPT,
-		uintptr(fd),
-		uintptr(syscall.SOL_TCP),
-		uintptr(syscall.TCP_INFO),
-		uintptr(unsafe.Pointer(&value)),
-		uintptr(unsafe.Pointer(&length)),
+// getsockoptTCPInfo calls getsockopt(2) on Linux to copy up to *length bytes of tcp_info, read with the given
+// level and optname, into value, updating *length to the number of bytes the kernel wrote.
+// This variant is for all architectures that expose getsockopt as a direct system call (everything except 386).
+func getsockoptTCPInfo(fd uintptr, level, opt int, value unsafe.Pointer, length *uint32) error {
+	_, _, errNo := unix.Syscall6(
+		unix.SYS_GETSOCKOPT,
+		fd,
+		uintptr(level),
+		uintptr(opt),
+		uintptr(value),
+		uintptr(unsafe.Pointer(length)),
 		0,
 	)
 	if errNo != 0 {
-		switch errNo {
-		case syscall.EAGAIN:
-			return nil, EAGAIN
-		case syscall.EINVAL:
-			return nil, EINVAL
-		case syscall.ENOENT:
-			return nil, ENOENT
-		}
-		return nil, errNo
+		return socketErr(fd, errNo)
 	}
-	return &value, nil
+	return nil
 }
@@ -8,13 +8,21 @@
 package tcpinfo
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/runZeroInc/conniver/pkg/kernel"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -47,6 +55,14 @@ func TestGetTCPInfo_LiveSocket(t *testing.T) {
 	}); err != nil {
 		t.Fatalf("Control: %v", err)
 	}
+	if errors.Is(infoErr, ErrUnsupported) {
+		if sysInfo == nil {
+			t.Skipf("skipping: tcp_info is not supported by this network stack: %v", infoErr)
+		}
+		// Some stacks (e.g. gVisor) provide tcp_info but not the congestion control options.
+		t.Logf("GetTCPInfo: partial result: %v", infoErr)
+		infoErr = nil
+	}
 	if infoErr != nil {
 		t.Fatalf("GetTCPInfo: %v", infoErr)
 	}
@@ -79,6 +95,44 @@ func TestGetTCPInfo_LiveSocket(t *testing.T) {
 	}
 }
 
+func TestKernelVersionProbedOnFirstUse(t *testing.T) {
+	// Start from the state the package has right after import.
+	kernelVersionOnce = sync.Once{}
+	linuxKernelVersion, sizeOfRawTCPInfo = nil, 0
+
+	if !Supported() {
+		t.Fatal("Supported() = false, want true on Linux")
+	}
+	if linuxKernelVersion == nil || sizeOfRawTCPInfo == 0 {
+		t.Fatalf("after Supported: kernel version = %v, tcp_info size = %d; want both probed", linuxKernelVersion, sizeOfRawTCPInfo)
+	}
+}
+
+func TestErrnoErrWrapsSentinels(t *testing.T) {
+	tests := []struct {
+		errNo unix.Errno
+		want  error
+	}{
+		{unix.ENOPROTOOPT, ErrUnsupported},
+		{unix.EOPNOTSUPP, ErrUnsupported},
+		{unix.EBADF, ErrConnClosed},
+		{unix.ENOTCONN, ErrConnClosed},
+		{unix.ENOENT, ErrConnClosed},
+		{unix.ENOENT, ENOENT},
+		{unix.EINVAL, EINVAL},
+		{unix.EPERM, ErrPermission},
+		{unix.EACCES, ErrPermission},
+	}
+	for _, tt := range tests {
+		if err := errnoErr(tt.errNo); !errors.Is(err, tt.want) {
+			t.Errorf("errnoErr(%v) = %v, want errors.Is(..., %v)", tt.errNo, err, tt.want)
+		}
+	}
+	if !errors.Is(ErrKernelTooOld, ErrUnsupported) {
+		t.Error("ErrKernelTooOld does not wrap ErrUnsupported")
+	}
+}
+
 func TestRawTCPInfo_Unpack(t *testing.T) {
 	type fields struct {
 		kernel                 kernel.VersionInfo
@@ -302,3 +356,672 @@ func TestRawTCPInfo_UnpackWindowScaleOptions(t *testing.T) {
 		t.Fatalf("RxOptions[0].Value = %d, want 7", got.RxOptions[0].Value)
 	}
 }
+
+func TestInfoDecodedOptions(t *testing.T) {
+	linuxKernelVersion = &kernel.VersionInfo{Kernel: minKernel, Major: minKernelMajor, Minor: minKernelMinor}
+	adaptToKernelVersion()
+
+	raw := RawTCPInfo{options: TCPI_OPT_TIMESTAMPS | TCPI_OPT_WSCALE | TCPI_OPT_ECN_SEEN}
+	want := Options{Timestamps: true, WScale: true, ECNSeen: true}
+	if got := raw.Unpack().ToInfo().DecodedOptions(); got != want {
+		t.Fatalf("DecodedOptions() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRawTCPInfo_UnpackTimeUnits(t *testing.T) {
+	linuxKernelVersion = &kernel.VersionInfo{Kernel: minKernel, Major: minKernelMajor, Minor: minKernelMinor}
+	adaptToKernelVersion()
+
+	raw := RawTCPInfo{
+		rto:            204000, // usec
+		rtt:            1500,   // usec
+		last_data_sent: 250,    // msec
+		last_data_recv: 120,    // msec
+		last_ack_recv:  80,     // msec
+		total_rto_time: 3000,   // msec
+	}
+
+	got := raw.Unpack()
+	if got.RTO != 204*time.Millisecond {
+		t.Errorf("RTO = %v, want 204ms", got.RTO)
+	}
+	if got.RTT != 1500*time.Microsecond {
+		t.Errorf("RTT = %v, want 1.5ms", got.RTT)
+	}
+	if got.LastTxAt != 250*time.Millisecond {
+		t.Errorf("LastTxAt = %v, want 250ms", got.LastTxAt)
+	}
+	if got.LastRxAt != 120*time.Millisecond {
+		t.Errorf("LastRxAt = %v, want 120ms", got.LastRxAt)
+	}
+	if got.LastRxAckAt != 80*time.Millisecond {
+		t.Errorf("LastRxAckAt = %v, want 80ms", got.LastRxAckAt)
+	}
+
+	m := got.ToMapWithUnits()
+	for key, want := range map[string]map[string]any{
+		"rto":          {"raw": uint64(204000), "unit": "us", "seconds": 0.204},
+		"lastTxAt":     {"raw": uint64(250), "unit": "ms", "seconds": 0.25},
+		"totalRTOTime": {"raw": uint64(3000), "unit": "ms", "seconds": 3.0},
+	} {
+		if !reflect.DeepEqual(m[key], want) {
+			t.Errorf("ToMapWithUnits()[%q] = %#v, want %#v", key, m[key], want)
+		}
+	}
+	if m["txMSS"] != got.TxMSS {
+		t.Errorf("ToMapWithUnits()[\"txMSS\"] = %#v, want the ToMap value", m["txMSS"])
+	}
+}
+
+func TestSysInfo_ToFlatMap(t *testing.T) {
+	linuxKernelVersion = &kernel.VersionInfo{Kernel: 4, Major: 10}
+	adaptToKernelVersion()
+
+	raw := RawTCPInfo{
+		state:          uint8(TCP_ESTABLISHED),
+		rto:            204000, // usec
+		last_data_sent: 250,    // msec
+		snd_mss:        1448,
+		delivery_rate:  125000, // bytes/sec
+		busy_time:      2000,   // usec
+		rwnd_limited:   500,    // usec
+	}
+	m := raw.Unpack().ToFlatMap()
+	for key, want := range map[string]any{
+		"state":          TCP_ESTABLISHED,
+		"state_name":     "ESTABLISHED",
+		"rto":            0.204,
+		"last_data_sent": 0.25,
+		"snd_mss":        uint32(1448),
+		"delivery_rate":  uint64(125000),
+		"busy_time":      0.002,
+		"rwnd_limited":   0.0005,
+	} {
+		if m[key] != want {
+			t.Errorf("ToFlatMap()[%q] = %#v, want %#v", key, m[key], want)
+		}
+	}
+	// Fields added after Linux 4.10 are omitted rather than reported as zero.
+	for _, key := range []string{"delivered", "bytes_sent", "snd_wnd", "total_rto_time"} {
+		if v, ok := m[key]; ok {
+			t.Errorf("ToFlatMap()[%q] = %#v, want it omitted on Linux 4.10", key, v)
+		}
+	}
+
+	// Every tcpi tag contributes a key, so the map and the metric names cannot drift apart.
+	typ := reflect.TypeFor[SysInfo]()
+	for i := range typ.NumField() {
+		tag, ok := typ.Field(i).Tag.Lookup("tcpi")
+		if !ok {
+			continue
+		}
+		name := parseTCPITag(tag)["name"]
+		if name == "" || strings.ContainsAny(name, "'=") {
+			t.Errorf("%s: tcpi tag name = %q", typ.Field(i).Name, name)
+		}
+	}
+	if got := parseTCPITag("name=rtt,prom_help='a, b',unit=us"); !reflect.DeepEqual(got, map[string]string{"name": "rtt", "prom_help": "a, b", "unit": "us"}) {
+		t.Errorf("parseTCPITag() = %#v", got)
+	}
+}
+
+func TestRawTCPInfo_UnpackTruncated(t *testing.T) {
+	linuxKernelVersion = &kernel.VersionInfo{Kernel: 6, Major: 7}
+	adaptToKernelVersion()
+
+	full := RawTCPInfo{
+		state:          uint8(TCP_ESTABLISHED),
+		rtt:            1500,
+		bytes_acked:    100,
+		bytes_received: 200,
+		segs_out:       3,
+		delivery_rate:  4,
+		total_rto:      5,
+	}
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&full)), unsafe.Sizeof(full))
+
+	// A kernel that stops after tcpi_bytes_received, as v4.1 does, while the running version promises more.
+	short := raw[:unsafe.Offsetof(full.segs_out)]
+	res := &TCPInfoPlusCC{TCPInfo: rawTCPInfoFromBytes(short), length: len(short)}
+	got := res.Unpack()
+	if !got.Truncated || got.ToMap()["truncated"] != true {
+		t.Fatalf("Truncated = %v, want true for %d of %d bytes", got.Truncated, len(short), sizeOfRawTCPInfo)
+	}
+	if got.RTT != 1500*time.Microsecond || got.BytesReceived != (NullableUint64{Valid: true, Value: 200}) {
+		t.Fatalf("RTT = %v, BytesReceived = %+v; want the fields inside the returned length", got.RTT, got.BytesReceived)
+	}
+	for name, valid := range map[string]bool{
+		"SegsOut":      got.SegsOut.Valid,
+		"MinRTT":       got.MinRTT.Valid,
+		"DeliveryRate": got.DeliveryRate.Valid,
+		"BytesSent":    got.BytesSent.Valid,
+		"TotalRTO":     got.TotalRTO.Valid,
+	} {
+		if valid {
+			t.Errorf("%s is valid past the returned length", name)
+		}
+	}
+	if _, ok := got.ToMap()["segsOut"]; ok {
+		t.Error("ToMap reports segsOut past the returned length")
+	}
+
+	got = (&TCPInfoPlusCC{TCPInfo: &full, length: len(raw)}).Unpack()
+	if got.Truncated || !got.SegsOut.Valid || !got.TotalRTO.Valid || got.TotalRTO.Value != 5 {
+		t.Fatalf("full read: Truncated = %v, SegsOut = %+v, TotalRTO = %+v", got.Truncated, got.SegsOut, got.TotalRTO)
+	}
+}
+
+func TestRawTCPInfo_UnpackBitfield1(t *testing.T) {
+	full := RawTCPInfo{state: uint8(TCP_ESTABLISHED), bitfield1: 0x07}
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&full)), unsafe.Sizeof(full))
+	withDeliveryRate := int(unsafe.Offsetof(full.delivery_rate) + unsafe.Sizeof(full.delivery_rate))
+	withSndWnd := int(unsafe.Offsetof(full.snd_wnd) + unsafe.Sizeof(full.snd_wnd))
+
+	tests := []struct {
+		name         string
+		kernel       kernel.VersionInfo
+		length       int
+		appLimited   NullableBool
+		fastOpenFail NullableUint8
+	}{
+		{
+			name:   "before 4.9",
+			kernel: kernel.VersionInfo{Kernel: 4, Major: 6},
+			length: withDeliveryRate - 8,
+		},
+		{
+			name:       "4.9 to 5.4",
+			kernel:     kernel.VersionInfo{Kernel: 5, Major: 4},
+			length:     withSndWnd,
+			appLimited: NullableBool{Valid: true, Value: true},
+		},
+		{
+			name:   "new kernel returning a 4.6 layout",
+			kernel: kernel.VersionInfo{Kernel: 6, Major: 7},
+			length: withDeliveryRate - 8,
+		},
+		{
+			name:       "new kernel returning a 4.9 layout",
+			kernel:     kernel.VersionInfo{Kernel: 6, Major: 7},
+			length:     withDeliveryRate,
+			appLimited: NullableBool{Valid: true, Value: true},
+		},
+		{
+			name:         "5.5 and later",
+			kernel:       kernel.VersionInfo{Kernel: 5, Major: 5},
+			length:       withSndWnd,
+			appLimited:   NullableBool{Valid: true, Value: true},
+			fastOpenFail: NullableUint8{Valid: true, Value: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linuxKernelVersion = &tt.kernel
+			adaptToKernelVersion()
+
+			short := raw[:tt.length]
+			got := (&TCPInfoPlusCC{TCPInfo: rawTCPInfoFromBytes(short), length: len(short)}).Unpack()
+			if got.DeliveryRateAppLimited != tt.appLimited {
+				t.Errorf("DeliveryRateAppLimited = %+v, want %+v", got.DeliveryRateAppLimited, tt.appLimited)
+			}
+			if got.FastOpenClientFail != tt.fastOpenFail {
+				t.Errorf("FastOpenClientFail = %+v, want %+v", got.FastOpenClientFail, tt.fastOpenFail)
+			}
+		})
+	}
+}
+
+func TestSysInfoString(t *testing.T) {
+	s := &SysInfo{
+		StateName:              "ESTABLISHED",
+		CCAlgorithm:            "cubic",
+		RTT:                    1500 * time.Microsecond,
+		RTTVar:                 750 * time.Microsecond,
+		RTO:                    204 * time.Millisecond,
+		TxMSS:                  1448,
+		TxCWindow:              10,
+		TxSSThreshold:          infiniteSSThreshold,
+		TotalRetrans:           2,
+		DeliveryRate:           NullableUint64{Valid: true, Value: 12_500_000},
+		DeliveryRateAppLimited: NullableBool{Valid: true, Value: true},
+	}
+
+	want := "ESTABLISHED cubic rtt:1.500/0.750ms rto:204.000ms mss:1448 cwnd:10 retrans:0/2 delivery_rate:100.00Mbps app_limited"
+	if got := s.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestTCPStateString(t *testing.T) {
+	for state, want := range map[TCPState]string{
+		TCP_ESTABLISHED: "ESTABLISHED",
+		TCP_SYN_SENT:    "SYN_SENT",
+		TCP_CLOSE:       "CLOSE",
+		0:               "UNKNOWN",
+	} {
+		if got := state.String(); got != want {
+			t.Errorf("TCPState(%d).String() = %q, want %q", uint8(state), got, want)
+		}
+	}
+}
+
+func TestSysInfoAppLimited(t *testing.T) {
+	s := &SysInfo{DeliveryRateAppLimited: NullableBool{Valid: true, Value: true}}
+	if !s.ToInfo().AppLimited {
+		t.Fatal("ToInfo().AppLimited = false, want true")
+	}
+	if !slices.Contains(s.Warnings(), WarnAppLimited) {
+		t.Fatalf("Warnings() = %v, want %q", s.Warnings(), WarnAppLimited)
+	}
+
+	s.DeliveryRateAppLimited.Value = false
+	if s.ToInfo().AppLimited || slices.Contains(s.Warnings(), WarnAppLimited) {
+		t.Fatal("app-limited reported for a network-limited sample")
+	}
+}
+
+func TestSysInfoThresholdWarnings(t *testing.T) {
+	s := &SysInfo{
+		State:           TCP_ESTABLISHED,
+		TotalRetrans:    5,
+		SegsOut:         NullableUint32{Valid: true, Value: 200},
+		BusyTime:        NullableUint64{Valid: true, Value: 1000},
+		RxWindowLimited: NullableUint64{Valid: true, Value: 400},
+		TxBufferLimited: NullableUint64{Valid: true, Value: 50},
+	}
+
+	got := s.thresholdWarnings(Thresholds{RetransRate: 0.01, LimitedFraction: 0.10})
+	want := []string{"highRetransRatePct=2.50", "rxWindowLimitedPct=40.00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("thresholdWarnings() = %v, want %v", got, want)
+	}
+
+	got = s.thresholdWarnings(Thresholds{RetransRate: 0.05, LimitedFraction: 0.01})
+	want = []string{"rxWindowLimitedPct=40.00", "txSendBufferLimitedPct=5.00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("thresholdWarnings() with custom thresholds = %v, want %v", got, want)
+	}
+
+	s.State = TCP_CLOSE
+	if !slices.Contains(s.Warnings(), WarnConnectionReset) {
+		t.Fatalf("Warnings() = %v, want %q for a socket in CLOSE", s.Warnings(), WarnConnectionReset)
+	}
+}
+
+func TestInfoHealthy(t *testing.T) {
+	s := &SysInfo{
+		RTT:             20 * time.Millisecond,
+		TotalRetrans:    1,
+		SegsOut:         NullableUint32{Valid: true, Value: 1000},
+		BusyTime:        NullableUint64{Valid: true, Value: 1000},
+		RxWindowLimited: NullableUint64{Valid: true, Value: 50},
+		TxBufferLimited: NullableUint64{Valid: true},
+	}
+	if !s.ToInfo().Healthy(DefaultHealthPolicy) {
+		t.Fatalf("Healthy(DefaultHealthPolicy) = false for %+v", s)
+	}
+
+	tests := []struct {
+		name   string
+		policy HealthPolicy
+	}{
+		{"rtt", HealthPolicy{MaxRTT: 10 * time.Millisecond}},
+		{"retransRate", HealthPolicy{MaxRetransRate: 0.0005}},
+		{"limitedFraction", HealthPolicy{MaxLimitedFraction: 0.01}},
+	}
+	for _, tt := range tests {
+		if s.ToInfo().Healthy(tt.policy) {
+			t.Errorf("Healthy(%+v) = true, want the %s check to fail", tt.policy, tt.name)
+		}
+	}
+
+	// Counters the kernel did not report cannot fail a check.
+	if !(&SysInfo{TotalRetrans: 5}).ToInfo().Healthy(HealthPolicy{MaxRetransRate: 0.0005, MaxLimitedFraction: 0.01}) {
+		t.Error("Healthy() = false without segs_out or busy_time")
+	}
+}
+
+func TestInfoECN(t *testing.T) {
+	linuxKernelVersion = &kernel.VersionInfo{Kernel: minKernel, Major: minKernelMajor, Minor: minKernelMinor}
+	adaptToKernelVersion()
+
+	raw := RawTCPInfo{options: TCPI_OPT_ECN | TCPI_OPT_ECN_SEEN, delivered: 200, delivered_ce: 10}
+	got := raw.Unpack().ToInfo().ECN()
+	if want := (ECN{Negotiated: true, ECTSeen: true, Delivered: 200, DeliveredCE: 10}); got != want {
+		t.Fatalf("ECN() = %+v, want %+v", got, want)
+	}
+	if rate, ok := got.CERate(); !ok || rate != 0.05 {
+		t.Fatalf("CERate() = %v, %v; want 0.05, true", rate, ok)
+	}
+	if _, ok := (ECN{Negotiated: true}).CERate(); ok {
+		t.Fatal("CERate() ok without deliveries")
+	}
+}
+
+func TestInfoLimitedTime(t *testing.T) {
+	info := (&SysInfo{
+		RxWindowLimited: NullableUint64{Valid: true, Value: 1500},
+		TxBufferLimited: NullableUint64{Valid: true, Value: 20},
+	}).ToInfo()
+	if rwnd, sndbuf, ok := info.LimitedTime(); !ok || rwnd != 1500*time.Microsecond || sndbuf != 20*time.Microsecond {
+		t.Fatalf("LimitedTime() = %v, %v, %v; want 1.5ms, 20µs, true", rwnd, sndbuf, ok)
+	}
+	if _, _, ok := (&SysInfo{}).ToInfo().LimitedTime(); ok {
+		t.Fatal("LimitedTime() ok before Linux 4.10")
+	}
+	if _, _, ok := (&Info{}).LimitedTime(); ok {
+		t.Fatal("LimitedTime() ok without Sys")
+	}
+}
+
+func TestInfoPathQuality(t *testing.T) {
+	clean := &SysInfo{
+		RTT:       10 * time.Millisecond,
+		RTTVar:    time.Millisecond,
+		SegsOut:   NullableUint32{Valid: true, Value: 1000},
+		ReordSeen: NullableUint32{Valid: true},
+		DSACKDups: NullableUint32{Valid: true},
+	}
+	// Only the RTT variance, 0.1 of its saturation point, costs anything; it carries 1 of the 6 weights.
+	if got, ok := clean.ToInfo().PathQuality(); !ok || math.Abs(got-(1-0.1/6)) > 1e-9 {
+		t.Fatalf("PathQuality() of a clean path = %v, %v; want %v, true", got, ok, 1-0.1/6)
+	}
+
+	lossy := *clean
+	lossy.TotalRetrans = 100 // 10%, past the 5% saturation point
+	if got, ok := lossy.ToInfo().PathQuality(); !ok || math.Abs(got-(1-(3+0.1)/6)) > 1e-9 {
+		t.Fatalf("PathQuality() with 10%% retransmits = %v, %v; want %v, true", got, ok, 1-(3+0.1)/6)
+	}
+
+	onlyRetrans := PathQualityPolicy{RetransWeight: 1, MaxRetransRate: 0.2}
+	if got, ok := lossy.ToInfo().PathQualityWith(onlyRetrans); !ok || math.Abs(got-0.5) > 1e-9 {
+		t.Fatalf("PathQualityWith(retransmits only) = %v, %v; want 0.5, true", got, ok)
+	}
+	if got, ok := (&Info{}).PathQuality(); ok {
+		t.Fatalf("PathQuality() without signals = %v, true; want ok false", got)
+	}
+	if _, ok := (*Info)(nil).PathQuality(); ok {
+		t.Fatal("PathQuality() of nil ok, want false")
+	}
+	noRTTVar := PathQualityPolicy{RTTVarWeight: 1, MaxRTTVarRatio: 1}
+	if _, ok := (&SysInfo{SegsOut: NullableUint32{Valid: true, Value: 1000}}).ToInfo().PathQualityWith(noRTTVar); ok {
+		t.Fatal("PathQualityWith() ok with only unweighted signals reported, want false")
+	}
+}
+
+func TestInfoSenderAndReceiverRTT(t *testing.T) {
+	info := (&SysInfo{RTT: 2 * time.Millisecond, RxRTT: 8 * time.Millisecond}).ToInfo()
+	if got := info.SenderRTT(); got != 2*time.Millisecond {
+		t.Fatalf("SenderRTT() = %v, want 2ms", got)
+	}
+	if rtt, ok := info.ReceiverRTT(); !ok || rtt != 8*time.Millisecond {
+		t.Fatalf("ReceiverRTT() = %v, %v; want 8ms, true", rtt, ok)
+	}
+	if _, ok := (&SysInfo{RTT: time.Millisecond}).ToInfo().ReceiverRTT(); ok {
+		t.Fatal("ReceiverRTT() ok before any data was received")
+	}
+	if _, ok := (&Info{RTT: time.Millisecond}).ReceiverRTT(); ok {
+		t.Fatal("ReceiverRTT() ok without Sys")
+	}
+}
+
+func TestInfoFastOpen(t *testing.T) {
+	for _, tc := range []struct {
+		sys  *SysInfo
+		want string
+	}{
+		{&SysInfo{}, "unknown"},
+		{&SysInfo{FastOpenClientFail: NullableUint8{Valid: true}}, "not_attempted"},
+		{&SysInfo{FastOpenClientFail: NullableUint8{Valid: true, Value: 1}}, "failed:no_cookie"},
+		{&SysInfo{FastOpenClientFail: NullableUint8{Valid: true, Value: 3}}, "failed:syn_retransmitted"},
+		{&SysInfo{TxOptions: []Option{{Kind: "SYNData", Value: TCPI_OPT_SYN_DATA}}}, "succeeded"},
+		{&SysInfo{TxOptions: []Option{{Kind: "TFOChild", Value: TCPI_OPT_TFO_CHILD}}}, "succeeded"},
+	} {
+		if got := tc.sys.ToInfo().FastOpen().String(); got != tc.want {
+			t.Errorf("FastOpen() for %+v = %s, want %s", tc.sys, got, tc.want)
+		}
+	}
+	if got := (&Info{}).FastOpen(); got.State != FastOpenUnknown {
+		t.Fatalf("FastOpen() without Sys = %v, want unknown", got)
+	}
+}
+
+func TestSysInfoWindowUtilization(t *testing.T) {
+	s := &SysInfo{
+		TxMSS:         1000,
+		UnAcked:       10,
+		Sacked:        2,
+		Lost:          1,
+		Retrans:       1,
+		TxWindow:      NullableUint32{Valid: true, Value: 16000},
+		RxSpace:       30000,
+		RxSSThreshold: 60000,
+	}
+	if got := s.BytesInFlight(); got != 8000 {
+		t.Fatalf("BytesInFlight() = %d, want 8000", got)
+	}
+	if got, ok := s.SendWindowUtilization(); !ok || got != 0.5 {
+		t.Fatalf("SendWindowUtilization() = %v, %v; want 0.5, true", got, ok)
+	}
+	if got, ok := s.ReceiveWindowUtilization(); !ok || got != 0.5 {
+		t.Fatalf("ReceiveWindowUtilization() = %v, %v; want 0.5, true", got, ok)
+	}
+
+	s.TxWindow = NullableUint32{}
+	s.RxSSThreshold = 0
+	if _, ok := s.SendWindowUtilization(); ok {
+		t.Fatal("SendWindowUtilization() ok without snd_wnd")
+	}
+	if _, ok := s.ReceiveWindowUtilization(); ok {
+		t.Fatal("ReceiveWindowUtilization() ok without rcv_ssthresh")
+	}
+}
+
+func TestGetTCPInfoRejectsNonTCPSockets(t *testing.T) {
+	pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Socketpair: %v", err)
+	}
+	udp, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatalf("Socket: %v", err)
+	}
+	for _, fd := range []int{pair[0], pair[1], udp} {
+		defer unix.Close(fd)
+	}
+
+	for _, tc := range []struct {
+		fd   int
+		want string
+	}{
+		{pair[0], "unix stream socket"},
+		{udp, "ipv4 datagram socket"},
+	} {
+		info, err := GetTCPInfo(uintptr(tc.fd))
+		if info != nil || !errors.Is(err, ErrNotTCP) || !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("GetTCPInfo(%s) = %v, %v; want ErrNotTCP", tc.want, info, err)
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("GetTCPInfo error = %q, want it to name a %s", err, tc.want)
+		}
+	}
+}
+
+func TestGetTCPInfoWithOptionsSockoptOverride(t *testing.T) {
+	conn := loopbackTCPConn(t)
+
+	var info *SysInfo
+	var err, badErr error
+	controlFD(t, conn, func(fd uintptr) {
+		info, err = GetTCPInfoWithOptions(fd, GetOptions{Level: unix.SOL_TCP, OptName: unix.TCP_INFO})
+		_, badErr = GetTCPInfoWithOptions(fd, GetOptions{OptName: 0x7fff})
+	})
+	if info == nil || info.StateName != "ESTABLISHED" {
+		t.Fatalf("GetTCPInfoWithOptions with the default sockopt = %v, %v", info, err)
+	}
+	if badErr == nil || !strings.Contains(badErr.Error(), "getsockopt(SOL_TCP, optname 32767)") {
+		t.Fatalf("GetTCPInfoWithOptions with an unknown optname error = %v, want it to name the sockopt", badErr)
+	}
+}
+
+func TestGetTCPInfoWithOptionsRequireEstablished(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	rc, err := ln.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+
+	var listening, required *SysInfo
+	var requiredErr error
+	if err := rc.Control(func(fd uintptr) {
+		listening, _ = GetTCPInfo(fd)
+		required, requiredErr = GetTCPInfoWithOptions(fd, GetOptions{RequireEstablished: true})
+	}); err != nil {
+		t.Fatalf("Control: %v", err)
+	}
+	if listening == nil || listening.State != TCP_LISTEN {
+		t.Fatalf("GetTCPInfo on a listener = %+v, want the LISTEN state", listening)
+	}
+	if required != nil || !errors.Is(requiredErr, ErrNotEstablished) || !strings.Contains(requiredErr.Error(), "LISTEN") {
+		t.Fatalf("GetTCPInfoWithOptions(RequireEstablished) on a listener = %v, %v; want ErrNotEstablished naming LISTEN", required, requiredErr)
+	}
+
+	var established *SysInfo
+	controlFD(t, loopbackTCPConn(t), func(fd uintptr) {
+		established, _ = GetTCPInfoWithOptions(fd, GetOptions{RequireEstablished: true})
+	})
+	if established == nil || established.State != TCP_ESTABLISHED {
+		t.Fatalf("GetTCPInfoWithOptions(RequireEstablished) on a connection = %+v, want ESTABLISHED info", established)
+	}
+}
+
+func TestGetTCPInfoWithOptionsKeepRaw(t *testing.T) {
+	conn := loopbackTCPConn(t)
+
+	var plain, kept *SysInfo
+	var plainErr, keptErr error
+	controlFD(t, conn, func(fd uintptr) {
+		plain, plainErr = GetTCPInfo(fd)
+		kept, keptErr = GetTCPInfoWithOptions(fd, GetOptions{KeepRaw: true})
+	})
+	// A congestion control lookup failure still returns the decoded tcp_info.
+	if plain == nil || kept == nil {
+		t.Fatalf("GetTCPInfo: %v, GetTCPInfoWithOptions: %v", plainErr, keptErr)
+	}
+	if plain.Raw != nil {
+		t.Fatalf("GetTCPInfo retained %d raw bytes without KeepRaw", len(plain.Raw))
+	}
+	if len(kept.Raw) == 0 {
+		t.Fatal("KeepRaw returned no raw bytes")
+	}
+	if TCPState(kept.Raw[0]) != kept.State || kept.StateName != plain.StateName {
+		t.Fatalf("raw state byte = %d, decoded state = %d (%s), plain state = %s",
+			kept.Raw[0], kept.State, kept.StateName, plain.StateName)
+	}
+	if clone := kept.Clone(); &clone.Raw[0] == &kept.Raw[0] {
+		t.Fatal("Clone shares the Raw buffer")
+	}
+}
+
+func TestInfoMarshalJSONCompact(t *testing.T) {
+	s := &SysInfo{
+		StateName: "ESTABLISHED",
+		BytesSent: NullableUint64{Valid: true},
+	}
+	b, err := s.ToInfo().MarshalJSONCompact()
+	if err != nil {
+		t.Fatalf("MarshalJSONCompact: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", b, err)
+	}
+	for _, key := range []string{"retransmits", "txBytes", "rtt", "sysInfo"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("reported field %q missing from %s", key, b)
+		}
+	}
+	for _, key := range []string{"rxBytes", "bytesAcked", "deliveryRate", "appLimited", "txCWindowBytes", "lastTxAckAt"} {
+		if _, ok := got[key]; ok {
+			t.Errorf("unreported field %q present in %s", key, b)
+		}
+	}
+}
+
+func TestGetTCPInfoConn(t *testing.T) {
+	rc, err := loopbackTCPConn(t).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+	info, err := GetTCPInfoConn(rc)
+	if err != nil && !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("GetTCPInfoConn: %v", err)
+	}
+	if info == nil || info.State != "ESTABLISHED" || info.Sys == nil {
+		t.Fatalf("GetTCPInfoConn() = %+v, want an ESTABLISHED Info with Sys", info)
+	}
+}
+
+func TestRawTCPInfo_UnpackInto(t *testing.T) {
+	linuxKernelVersion = &kernel.VersionInfo{Kernel: minKernel, Major: minKernelMajor, Minor: minKernelMinor}
+	adaptToKernelVersion()
+
+	raw := RawTCPInfo{state: uint8(TCP_ESTABLISHED), options: TCPI_OPT_SACK | TCPI_OPT_WSCALE, bitfield0: 0x87, rtt: 1500}
+	var s SysInfo
+	raw.UnpackInto(&s)
+	if !reflect.DeepEqual(&s, raw.Unpack()) {
+		t.Fatalf("UnpackInto = %+v, want %+v", s, raw.Unpack())
+	}
+
+	tx := &s.TxOptions[0]
+	raw.options, raw.rtt = TCPI_OPT_SACK, 2000
+	raw.UnpackInto(&s)
+	if !reflect.DeepEqual(&s, raw.Unpack()) {
+		t.Fatalf("second UnpackInto = %+v, want %+v", s, raw.Unpack())
+	}
+	if &s.TxOptions[0] != tx {
+		t.Fatal("UnpackInto did not reuse the TxOptions backing array")
+	}
+	if allocs := testing.AllocsPerRun(10, func() { raw.UnpackInto(&s) }); allocs != 0 {
+		t.Fatalf("UnpackInto allocated %v times per call, want 0", allocs)
+	}
+}
+
+func BenchmarkGetTCPInfo(b *testing.B) {
+	rc, err := loopbackTCPConn(b).SyscallConn()
+	if err != nil {
+		b.Fatalf("SyscallConn: %v", err)
+	}
+	var fd uintptr
+	_ = rc.Control(func(sysfd uintptr) { fd = sysfd })
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if info, err := GetTCPInfo(fd); info == nil {
+			b.Fatalf("GetTCPInfo: %v", err)
+		}
+	}
+}
+
+func BenchmarkRawTCPInfoUnpack(b *testing.B) {
+	raw := RawTCPInfo{state: uint8(TCP_ESTABLISHED), options: TCPI_OPT_SACK | TCPI_OPT_TIMESTAMPS, rtt: 1500, segs_out: 10}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = raw.Unpack()
+	}
+}
+
+func BenchmarkRawTCPInfoUnpackInto(b *testing.B) {
+	raw := RawTCPInfo{state: uint8(TCP_ESTABLISHED), options: TCPI_OPT_SACK | TCPI_OPT_TIMESTAMPS, rtt: 1500, segs_out: 10}
+	var s SysInfo
+
+	b.ReportAllocs()
+	for b.Loop() {
+		raw.UnpackInto(&s)
+	}
+}
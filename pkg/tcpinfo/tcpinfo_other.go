@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime"
+	"time"
 )
 
 type SysInfo struct {
@@ -29,6 +30,50 @@ func (s *SysInfo) Warnings() []string {
 	return nil
 }
 
+func (s *SysInfo) reportsInfoField(string) bool {
+	return false
+}
+
+func (s *SysInfo) retransRate() (float64, bool) {
+	return 0, false
+}
+
+func (s *SysInfo) limitedFraction() (float64, bool) {
+	return 0, false
+}
+
+func (s *SysInfo) optionLists() (tx, rx []Option) {
+	return nil, nil
+}
+
+func (s *SysInfo) limitedTime() (rwnd, sndbuf time.Duration, ok bool) {
+	return 0, 0, false
+}
+
+func (s *SysInfo) congestionAlgorithm() string {
+	return ""
+}
+
+func (s *SysInfo) reorderRates() (reorder, dsack float64, ok bool) {
+	return 0, 0, false
+}
+
+func (s *SysInfo) receiverRTT() (time.Duration, bool) {
+	return 0, false
+}
+
+func (s *SysInfo) fastOpen() FastOpenResult {
+	return FastOpenResult{}
+}
+
+func (s *SysInfo) backoff() (uint8, bool) {
+	return 0, false
+}
+
+func (s *SysInfo) deliveredCE() (delivered, ce uint32) {
+	return 0, 0
+}
+
 func (s *SysInfo) ToMap() map[string]any {
 	return map[string]any{}
 }
@@ -38,7 +83,7 @@ func (s *SysInfo) MarshalJSON() ([]byte, error) {
 }
 
 func GetTCPInfo(fd uintptr) (*SysInfo, error) {
-	return nil, fmt.Errorf("%s is unsupported", runtime.GOOS)
+	return nil, fmt.Errorf("%w on %s", ErrUnsupported, runtime.GOOS)
 }
 
 func Supported() bool {
@@ -0,0 +1,230 @@
+package tcpinfo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfoString(t *testing.T) {
+	info := &Info{
+		State:        "ESTABLISHED",
+		RTT:          1500 * time.Microsecond,
+		RTTVar:       750 * time.Microsecond,
+		RTO:          204 * time.Millisecond,
+		TxMSS:        1448,
+		TxWindowSegs: 10,
+		Retransmits:  3,
+	}
+
+	want := "ESTABLISHED rtt:1.500/0.750ms rto:204.000ms mss:1448 cwnd:10 retrans:3"
+	if got := info.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+
+	var nilInfo *Info
+	if got := nilInfo.String(); got != "<nil>" {
+		t.Fatalf("nil String() = %q, want %q", got, "<nil>")
+	}
+}
+
+func TestInfoMarshalJSONCompactWithoutSys(t *testing.T) {
+	b, err := (&Info{State: "ESTABLISHED", RTT: time.Millisecond}).MarshalJSONCompact()
+	if err != nil {
+		t.Fatalf("MarshalJSONCompact: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", b, err)
+	}
+	if len(got) != 2 || got["state"] != "ESTABLISHED" || got["rtt"] != float64(time.Millisecond) {
+		t.Fatalf("MarshalJSONCompact() = %s, want only state and rtt", b)
+	}
+
+	var nilInfo *Info
+	if b, err := nilInfo.MarshalJSONCompact(); err != nil || string(b) != "null" {
+		t.Fatalf("nil MarshalJSONCompact() = %s, %v; want null", b, err)
+	}
+}
+
+func TestInfoLineProtocol(t *testing.T) {
+	info := &Info{
+		State:        "ESTABLISHED",
+		RTT:          1500 * time.Microsecond,
+		TxMSS:        1448,
+		DeliveryRate: 125000,
+		AppLimited:   true,
+	}
+	tags := map[string]string{"target": "example.com:443", "host name": "a,b", "empty": ""}
+	got := info.LineProtocol("tcp info", tags, time.Unix(1, 5))
+
+	want := `tcp\ info,host\ name=a\,b,target=example.com:443 ` +
+		`appLimited=1i,ato=0i,bytesAcked=0i,caState=0i,deliveryRate=125000i,lastRxAckAt=0i,lastRxAt=0i,` +
+		`lastTxAckAt=0i,lastTxAt=0i,minRTT=0i,retransmits=0i,rto=0i,rtt=1500000i,rttVar=0i,rxBytes=0i,rxMSS=0i,rxSSThreshold=0i,` +
+		`rxWindow=0i,txBytes=0i,txCWindowBytes=0i,txCWindowSegs=0i,txMSS=1448i,txSSThreshold=0i 1000000005`
+	if got != want {
+		t.Fatalf("LineProtocol() =\n%s\nwant\n%s", got, want)
+	}
+	if strings.Contains(got, "state=") || strings.Contains(got, "Options=") {
+		t.Fatalf("LineProtocol() = %s, want non-numeric fields left out", got)
+	}
+
+	if got := info.LineProtocol("tcp", nil, time.Time{}); strings.Count(got, " ") != 1 {
+		t.Fatalf("LineProtocol() with a zero time = %s, want no timestamp", got)
+	}
+
+	var nilInfo *Info
+	if got := nilInfo.LineProtocol("tcp", tags, time.Unix(1, 5)); got != "" {
+		t.Fatalf("nil LineProtocol() = %q, want empty", got)
+	}
+}
+
+func TestInfoDecodedOptionsWithoutOptions(t *testing.T) {
+	var nilInfo *Info
+	if got := nilInfo.DecodedOptions(); got != (Options{}) {
+		t.Fatalf("nil DecodedOptions() = %+v, want all false", got)
+	}
+	info := &Info{TxOptions: []Option{{Kind: "SACK"}, {Kind: "unknown"}}}
+	if got := info.DecodedOptions(); got != (Options{SACK: true}) {
+		t.Fatalf("DecodedOptions() = %+v, want only SACK", got)
+	}
+}
+
+func TestInfoHealthyWithoutSys(t *testing.T) {
+	var nilInfo *Info
+	if nilInfo.Healthy(DefaultHealthPolicy) {
+		t.Fatal("nil Healthy() = true, want false")
+	}
+	info := &Info{RTT: 80 * time.Millisecond}
+	if !info.Healthy(DefaultHealthPolicy) {
+		t.Fatal("Healthy(DefaultHealthPolicy) = false, want the disabled RTT check to pass")
+	}
+	if info.Healthy(HealthPolicy{MaxRTT: 50 * time.Millisecond}) {
+		t.Fatal("Healthy(MaxRTT: 50ms) = true for an 80ms RTT")
+	}
+}
+
+func TestInfoCwndBytes(t *testing.T) {
+	for _, tt := range []struct {
+		info *Info
+		want uint64
+	}{
+		{&Info{TxWindowSegs: 10, TxMSS: 1448}, 14480},
+		{&Info{TxWindowBytes: 65535, TxMSS: 1448}, 65535},
+		{&Info{TxWindowSegs: 10}, 0},
+		{nil, 0},
+	} {
+		if got := tt.info.CwndBytes(); got != tt.want {
+			t.Errorf("%+v.CwndBytes() = %d, want %d", tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestInfoBDPAndCwndLimited(t *testing.T) {
+	// 100 Mbit/s over a 10ms minimum RTT keeps 125000 bytes in flight.
+	info := &Info{DeliveryRate: 12500000, MinRTT: 10 * time.Millisecond, TxWindowSegs: 10, TxMSS: 1448}
+	if bdp, ok := info.BDP(); !ok || bdp != 125000 {
+		t.Fatalf("BDP() = %d, %v, want 125000, true", bdp, ok)
+	}
+	if limited, ok := info.CwndLimited(); !ok || !limited {
+		t.Fatalf("CwndLimited() = %v, %v with a 14480 byte cwnd, want true, true", limited, ok)
+	}
+	info.TxWindowSegs = 100
+	if limited, ok := info.CwndLimited(); !ok || limited {
+		t.Fatalf("CwndLimited() = %v, %v with a 144800 byte cwnd, want false, true", limited, ok)
+	}
+
+	for _, info := range []*Info{nil, {MinRTT: time.Millisecond}, {DeliveryRate: 1000}} {
+		if _, ok := info.BDP(); ok {
+			t.Errorf("%+v.BDP() ok = true, want false", info)
+		}
+	}
+	if _, ok := (&Info{DeliveryRate: 1000, MinRTT: time.Millisecond, TxWindowSegs: 10}).CwndLimited(); ok {
+		t.Error("CwndLimited() ok = true without an MSS, want false")
+	}
+}
+
+func TestInfoNormalizeAndEqualIgnoring(t *testing.T) {
+	newInfo := func(rtt time.Duration) *Info {
+		return &Info{
+			State:        "ESTABLISHED",
+			TxMSS:        1448,
+			TxOptions:    []Option{{Kind: "SACK"}},
+			RTT:          rtt,
+			LastRxAt:     rtt * 2,
+			DeliveryRate: uint64(rtt),
+			TxBytes:      4096,
+			Sys:          &SysInfo{},
+		}
+	}
+	a, b := newInfo(time.Millisecond), newInfo(3*time.Millisecond)
+
+	if a.EqualIgnoring(b) {
+		t.Fatal("EqualIgnoring() with nothing ignored = true for different RTTs")
+	}
+	if !a.EqualIgnoring(b, VolatileFields...) {
+		t.Fatal("EqualIgnoring(VolatileFields...) = false for Infos that differ only in volatile fields")
+	}
+	b.TxBytes++
+	if a.EqualIgnoring(b, VolatileFields...) {
+		t.Fatal("EqualIgnoring(VolatileFields...) = true for different TxBytes")
+	}
+	if !a.EqualIgnoring(b, append([]string{"txBytes", "noSuchField"}, VolatileFields...)...) {
+		t.Fatal("EqualIgnoring did not skip txBytes")
+	}
+
+	a.Normalize()
+	if a.RTT != 0 || a.LastRxAt != 0 || a.DeliveryRate != 0 || a.Sys != nil {
+		t.Fatalf("Normalize() left volatile fields set: %+v", a)
+	}
+	if a.State != "ESTABLISHED" || a.TxMSS != 1448 || a.TxBytes != 4096 || len(a.TxOptions) != 1 {
+		t.Fatalf("Normalize() cleared stable fields: %+v", a)
+	}
+
+	for _, key := range VolatileFields {
+		if _, ok := infoFieldIndex()[key]; !ok {
+			t.Errorf("VolatileFields lists %q, which is not an Info JSON key", key)
+		}
+	}
+
+	var none *Info
+	if !none.EqualIgnoring(nil) || none.EqualIgnoring(a) || a.EqualIgnoring(nil) {
+		t.Fatal("EqualIgnoring mishandles nil Infos")
+	}
+	none.Normalize()
+}
+
+func TestFormatBitRate(t *testing.T) {
+	for bytesPerSec, want := range map[uint64]string{
+		0:             "0 bit/s",
+		100:           "800 bit/s",
+		125:           "1.0 kbit/s",
+		124_999:       "1.0 Mbit/s",
+		11_775_000:    "94.2 Mbit/s",
+		1_250_000_000: "10.0 Gbit/s",
+		1 << 50:       "9007.2 Tbit/s",
+	} {
+		if got := FormatBitRate(bytesPerSec); got != want {
+			t.Errorf("FormatBitRate(%d) = %q, want %q", bytesPerSec, got, want)
+		}
+	}
+	if got := (&Info{DeliveryRate: 11_775_000}).DeliveryRateBitsPerSec(); got != 94_200_000 {
+		t.Errorf("DeliveryRateBitsPerSec() = %d, want 94200000", got)
+	}
+	if got := (*Info)(nil).DeliveryRateBitsPerSec(); got != 0 {
+		t.Errorf("nil DeliveryRateBitsPerSec() = %d, want 0", got)
+	}
+}
+
+func TestCAStateName(t *testing.T) {
+	if got := TCP_CA_Recovery.String(); got != "Recovery" {
+		t.Fatalf("TCP_CA_Recovery.String() = %q, want Recovery", got)
+	}
+	if got := CAStateName(uint8(TCP_CA_Loss)); got != "Loss" {
+		t.Fatalf("CAStateName(TCP_CA_Loss) = %q, want Loss", got)
+	}
+	if got := CAStateName(9); got != "UNKNOWN" {
+		t.Fatalf("CAStateName(9) = %q, want UNKNOWN", got)
+	}
+}
@@ -218,17 +218,29 @@ func (packed *RawInfoV1) Unpack() *SysInfo {
 
 func (s *SysInfo) ToInfo() *Info {
 	info := &Info{
-		State:        s.StateName,
-		TxMSS:        uint64(s.MSS),
-		RTT:          s.RTTMin,
-		RxWindow:     uint64(s.RxWindow),
-		TxWindowSegs: uint64(s.TxWindow),
-		Retransmits:  uint64(s.SynRetrans),
-		Sys:          s,
+		State:         s.StateName,
+		TxMSS:         uint64(s.MSS),
+		RTT:           s.RTT,
+		MinRTT:        s.RTTMin,
+		RxWindow:      uint64(s.RxWindow),
+		TxWindowBytes: uint64(s.CongestionWindow),
+		Retransmits:   uint64(s.SynRetrans),
+		TxBytes:       s.TxBytes,
+		RxBytes:       s.RxBytes,
+		Sys:           s,
 	}
 	return info
 }
 
+// reportsInfoField reports whether ToInfo fills the Info field with the given ToMap key.
+func (s *SysInfo) reportsInfoField(key string) bool {
+	switch key {
+	case "state", "txMSS", "rtt", "minRTT", "rxWindow", "txCWindowBytes", "retransmits", "txBytes", "rxBytes":
+		return true
+	}
+	return false
+}
+
 // TCP state constants from https://learn.microsoft.com/en-us/windows/win32/api/mstcpip/ne-mstcpip-tcpstate
 const (
 	TCPS_CLOSED       = 0 /* closed */
@@ -270,13 +282,6 @@ func tcpInfoTCPStateString(state uint32) string {
 
 // ================================================================================================================== //
 
-// Errors from syscall package are private, so we define our own to match the errno.
-var (
-	EAGAIN error = syscall.EAGAIN
-	EINVAL error = syscall.EINVAL
-	ENOENT error = syscall.ENOENT
-)
-
 // GetTCPInfo calls getsockopt(2) on Linux to retrieve tcp_info and unpacks that into the golang-friendly TCPInfo.
 //
 // The lpOverlapped argument to WSAIoctl is deliberately nil. Go's net package opens all sockets
@@ -329,7 +334,7 @@ func GetTCPInfo(fds uintptr) (*SysInfo, error) {
 		nil,
 		0,
 	); err != nil {
-		return nil, fmt.Errorf("could not perform the WSAIoctl: %v", err)
+		return nil, fmt.Errorf("could not perform the WSAIoctl: %w", wsaErr(fd, err))
 	}
 	return outbufv0.Unpack(), nil
 }
@@ -338,6 +343,68 @@ func Supported() bool {
 	return true
 }
 
+// retransRate returns the fraction of sent bytes that were retransmitted, for Info.Healthy.
+func (s *SysInfo) retransRate() (float64, bool) {
+	if s.TxBytes == 0 {
+		return 0, false
+	}
+	return float64(s.TxRetransmitBytes) / float64(s.TxBytes), true
+}
+
+// limitedFraction returns the larger of the fractions of send-limited time spent limited by the receive window and
+// by the send buffer, for Info.Healthy. It needs the _TCP_INFO_v1 fields, which older Windows versions do not return.
+func (s *SysInfo) limitedFraction() (float64, bool) {
+	total := s.SndLimTransTimeRwin + s.SndLimTimeCwnd + s.SndLimTimeSnd
+	if total <= 0 {
+		return 0, false
+	}
+	return float64(max(s.SndLimTransTimeRwin, s.SndLimTimeSnd)) / float64(total), true
+}
+
+// optionLists returns nothing on Windows, which does not decode TCP options, for Info.Clone.
+func (s *SysInfo) optionLists() (tx, rx []Option) {
+	return nil, nil
+}
+
+// limitedTime returns the time spent limited by the receive window and by the send buffer, for Info.LimitedTime.
+// Like limitedFraction, it needs the _TCP_INFO_v1 fields.
+func (s *SysInfo) limitedTime() (rwnd, sndbuf time.Duration, ok bool) {
+	if s.SndLimTransTimeRwin+s.SndLimTimeCwnd+s.SndLimTimeSnd <= 0 {
+		return 0, 0, false
+	}
+	return s.SndLimTransTimeRwin, s.SndLimTimeSnd, true
+}
+
+// congestionAlgorithm is not available on Windows, which does not report the algorithm per socket.
+func (s *SysInfo) congestionAlgorithm() string {
+	return ""
+}
+
+// reorderRates is not available on Windows, which does not count reordering or DSACKs.
+func (s *SysInfo) reorderRates() (reorder, dsack float64, ok bool) {
+	return 0, 0, false
+}
+
+// receiverRTT is not available on Windows, which has no receiver-side RTT estimate.
+func (s *SysInfo) receiverRTT() (time.Duration, bool) {
+	return 0, false
+}
+
+// fastOpen is not available on Windows, which does not report Fast Open per socket.
+func (s *SysInfo) fastOpen() FastOpenResult {
+	return FastOpenResult{}
+}
+
+// backoff is not available on Windows, which does not report the RTO backoff.
+func (s *SysInfo) backoff() (uint8, bool) {
+	return 0, false
+}
+
+// deliveredCE is not available on Windows, which does not count CE-marked deliveries.
+func (s *SysInfo) deliveredCE() (delivered, ce uint32) {
+	return 0, 0
+}
+
 func (s *SysInfo) Warnings() []string {
 	var warns []string
 	if s.TxRetransmitBytes > 0 {
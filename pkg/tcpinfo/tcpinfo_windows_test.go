@@ -3,7 +3,9 @@
 package tcpinfo
 
 import (
+	"errors"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -66,7 +68,38 @@ func TestGetTCPInfo_LiveSocket(t *testing.T) {
 	if info.TxMSS != uint64(sysInfo.MSS) {
 		t.Errorf("Info.TxMSS = %d, want %d", info.TxMSS, sysInfo.MSS)
 	}
+	if info.RTT != sysInfo.RTT {
+		t.Errorf("Info.RTT = %v, want %v (RTT)", info.RTT, sysInfo.RTT)
+	}
+	if info.TxWindowBytes != uint64(sysInfo.CongestionWindow) {
+		t.Errorf("Info.TxWindowBytes = %d, want %d (CongestionWindow)", info.TxWindowBytes, sysInfo.CongestionWindow)
+	}
 	if info.Sys != sysInfo {
 		t.Error("Info.Sys does not point to the original SysInfo")
 	}
 }
+
+func TestGetTCPInfoRejectsUDPSockets(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	rawConn, err := conn.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+	var info *SysInfo
+	if err := rawConn.Control(func(fd uintptr) {
+		info, err = GetTCPInfo(fd)
+	}); err != nil {
+		t.Fatalf("Control: %v", err)
+	}
+	if info != nil || !errors.Is(err, ErrNotTCP) || !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("GetTCPInfo(udp) = %v, %v; want ErrNotTCP", info, err)
+	}
+	if !strings.Contains(err.Error(), "ipv4 datagram socket") {
+		t.Fatalf("GetTCPInfo error = %q, want it to name an ipv4 datagram socket", err)
+	}
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package tcpinfo
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// timestampingFlags requests software receive and transmit timestamps, hardware timestamps from NICs configured to
+// generate them, and transmit timestamps without a looped-back copy of the packet, each tagged with a byte key.
+const timestampingFlags = unix.SOF_TIMESTAMPING_SOFTWARE |
+	unix.SOF_TIMESTAMPING_RX_SOFTWARE | unix.SOF_TIMESTAMPING_TX_SOFTWARE |
+	unix.SOF_TIMESTAMPING_RAW_HARDWARE | unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_TX_HARDWARE |
+	unix.SOF_TIMESTAMPING_OPT_TSONLY | unix.SOF_TIMESTAMPING_OPT_ID
+
+// timestampingOOBSize fits the SCM_TIMESTAMPING message and, on the error queue, the sock_extended_err that
+// accompanies it.
+const timestampingOOBSize = 256
+
+// EnableTimestamping sets SO_TIMESTAMPING on the socket so the kernel records when data leaves the host and when
+// it arrives. Receive timestamps are delivered with the data by RecvTimestamped; transmit timestamps are queued on
+// the socket error queue, one per send call, and collected by ReadTxTimestamps. Each transmit timestamp carries the
+// SOF_TIMESTAMPING_OPT_ID key of its send call: the offset of the call's last byte among the bytes sent since
+// EnableTimestamping, modulo 2^32. Hardware timestamps additionally
+// need the NIC to be configured for them (SIOCSHWTSTAMP, e.g. with hwstamp_ctl); otherwise software timestamps
+// are reported.
+func EnableTimestamping(fd uintptr) error {
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPING, timestampingFlags); err != nil {
+		return fmt.Errorf("set SO_TIMESTAMPING: %w", sockoptErr(err))
+	}
+	return nil
+}
+
+// RecvTimestamped reads into p with recvmsg(2) and returns the kernel receive timestamp of the data, which is zero
+// if the kernel attached none. Errors are returned as the raw errno, so a caller driving a non-blocking socket
+// through syscall.RawConn.Read can wait and retry on EAGAIN.
+func RecvTimestamped(fd uintptr, p []byte) (int, time.Time, error) {
+	var oob [timestampingOOBSize]byte
+	n, oobn, _, _, err := recvmsg(fd, p, oob[:], 0)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	ts, _, _ := parseTimestamping(oob[:oobn])
+	return n, ts, nil
+}
+
+// ReadTxTimestamps drains the transmit timestamps queued on the socket error queue without blocking and returns the
+// one with the newest key, along with that key; ok is false if none were queued. The timestamp of a send call is
+// queued when its data leaves for the NIC, which is often after the call returns, so the newest timestamp queued
+// may belong to an earlier call; compare key with the bytes sent to tell.
+func ReadTxTimestamps(fd uintptr) (ts time.Time, key uint32, ok bool, err error) {
+	var oob [timestampingOOBSize]byte
+	for {
+		_, oobn, _, _, err := recvmsg(fd, nil, oob[:], unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+		if err == unix.EAGAIN {
+			return ts, key, ok, nil
+		}
+		if err != nil {
+			return ts, key, ok, fmt.Errorf("read error queue: %w", sockoptErr(err))
+		}
+		t, k, found := parseTimestamping(oob[:oobn])
+		// Keys wrap at 2^32, so compare them by their distance.
+		if found && (!ok || int32(k-key) > 0) {
+			ts, key, ok = t, k, true
+		}
+	}
+}
+
+// recvmsg calls recvmsg(2), retrying when a signal interrupts it.
+func recvmsg(fd uintptr, p, oob []byte, flags int) (n, oobn, recvflags int, from unix.Sockaddr, err error) {
+	for {
+		n, oobn, recvflags, from, err = unix.Recvmsg(int(fd), p, oob, flags)
+		if err != unix.EINTR {
+			return n, oobn, recvflags, from, err
+		}
+	}
+}
+
+// parseTimestamping returns the timestamp carried by an SCM_TIMESTAMPING control message, preferring the raw
+// hardware timestamp over the software one when the NIC provided it, and the OPT_ID key from the sock_extended_err
+// that accompanies transmit timestamps on the error queue. The key is zero for receive timestamps.
+func parseTimestamping(oob []byte) (ts time.Time, key uint32, ok bool) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPING:
+			if t, found := parseScmTimestamping(m.Data); found {
+				ts, ok = t, true
+			}
+		case m.Header.Level == unix.SOL_IP && m.Header.Type == unix.IP_RECVERR,
+			m.Header.Level == unix.SOL_IPV6 && m.Header.Type == unix.IPV6_RECVERR:
+			var ee unix.SockExtendedErr
+			if len(m.Data) >= int(unsafe.Sizeof(ee)) {
+				copy(unsafe.Slice((*byte)(unsafe.Pointer(&ee)), unsafe.Sizeof(ee)), m.Data)
+				if ee.Origin == unix.SO_EE_ORIGIN_TIMESTAMPING {
+					key = ee.Data
+				}
+			}
+		}
+	}
+	return ts, key, ok
+}
+
+// parseScmTimestamping returns the first set timestamp in a struct scm_timestamping, which holds three timespecs:
+// software, deprecated, and raw hardware.
+func parseScmTimestamping(data []byte) (time.Time, bool) {
+	var ts [3]unix.Timespec
+	if len(data) < int(unsafe.Sizeof(ts)) {
+		return time.Time{}, false
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts)), data)
+	for _, t := range []unix.Timespec{ts[2], ts[0]} {
+		if t.Sec != 0 || t.Nsec != 0 {
+			return time.Unix(t.Unix()), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package tcpinfo
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// EnableTimestamping is only supported on Linux.
+func EnableTimestamping(fd uintptr) error {
+	return fmt.Errorf("%w: SO_TIMESTAMPING on %s", ErrUnsupported, runtime.GOOS)
+}
+
+// RecvTimestamped is only supported on Linux.
+func RecvTimestamped(fd uintptr, p []byte) (int, time.Time, error) {
+	return 0, time.Time{}, fmt.Errorf("%w: SO_TIMESTAMPING on %s", ErrUnsupported, runtime.GOOS)
+}
+
+// ReadTxTimestamps is only supported on Linux.
+func ReadTxTimestamps(fd uintptr) (ts time.Time, key uint32, ok bool, err error) {
+	return time.Time{}, 0, false, fmt.Errorf("%w: SO_TIMESTAMPING on %s", ErrUnsupported, runtime.GOOS)
+}
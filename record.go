@@ -0,0 +1,122 @@
+package conniver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// RecordFormatVersion is the version of the on-disk format written by
+// Recorder. It is stored in every event and only changes when a field is
+// removed or changes meaning; new optional fields keep the version.
+const RecordFormatVersion = 1
+
+// RecordedEvent is one report of a connection as written by Recorder, one JSON
+// object per line. OpenedAt together with the addresses identifies the
+// connection, so a recording can hold the events of many connections.
+type RecordedEvent struct {
+	Version    int           `json:"v"`
+	At         int64         `json:"at"`                   // Unix nanoseconds when the state was reported
+	State      int           `json:"state"`                // Opened, Closed, or Sampled
+	OpenedAt   int64         `json:"openedAt"`             // Conn.OpenedAt
+	LocalAddr  string        `json:"localAddr,omitempty"`  // Local address, if known
+	RemoteAddr string        `json:"remoteAddr,omitempty"` // Remote address, if known
+	TxBytes    int64         `json:"txBytes"`
+	RxBytes    int64         `json:"rxBytes"`
+	Info       *tcpinfo.Info `json:"info,omitempty"` // tcpinfo for the state, without Sys
+}
+
+// Recorder is an Observer that writes every state it is notified of as a
+// RecordedEvent line, for regression tests and offline analysis that replay
+// real captures with ReadRecording. The Info recorded with each state is the
+// one that state produced: OpenedInfo, SampledInfo, or ClosedInfo. Only the
+// portable tcpinfo fields are kept; Sys is dropped because its layout is
+// specific to the platform that recorded it. A Recorder can be shared by many
+// connections and is safe for concurrent use.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder returns a Recorder that writes to w. Writes are not buffered by
+// the Recorder, so wrap w in a bufio.Writer for high-volume captures and flush
+// it once the connections are closed.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// OnState records the state. After the first write error the Recorder stops
+// writing; see Err.
+func (r *Recorder) OnState(c *Conn, state int) {
+	var info *tcpinfo.Info
+	switch state {
+	case Opened:
+		info = c.OpenedInfo
+	case Sampled:
+		info = c.SampledInfo
+	case Closed:
+		info = c.ClosedInfo
+	}
+	if info != nil {
+		stripped := *info
+		stripped.Sys = nil
+		info = &stripped
+	}
+	ev := &RecordedEvent{
+		Version:    RecordFormatVersion,
+		At:         time.Now().UnixNano(),
+		State:      state,
+		OpenedAt:   c.OpenedAt,
+		LocalAddr:  addrString(c.localAddr, ""),
+		RemoteAddr: addrString(c.remoteAddr, ""),
+		TxBytes:    c.TxBytes,
+		RxBytes:    c.RxBytes,
+		Info:       info,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(ev)
+	}
+}
+
+// Err returns the first error from writing an event, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReadRecording yields the events written by a Recorder to rd, in order. It
+// stops after the first error, such as malformed JSON or an event whose
+// version is newer than RecordFormatVersion.
+func ReadRecording(rd io.Reader) iter.Seq2[*RecordedEvent, error] {
+	return func(yield func(*RecordedEvent, error) bool) {
+		dec := json.NewDecoder(rd)
+		for {
+			ev := &RecordedEvent{}
+			err := dec.Decode(ev)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err == nil && (ev.Version < 1 || ev.Version > RecordFormatVersion) {
+				err = fmt.Errorf("conniver: unsupported recording format version %d", ev.Version)
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(ev, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package conniver
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestRecorderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	wrapped := WrapConn(newFakeConn(), nil,
+		withInfoSource(func() (*tcpinfo.Info, error) {
+			return &tcpinfo.Info{
+				State:     "ESTABLISHED",
+				RTT:       2 * time.Millisecond,
+				TxOptions: []tcpinfo.Option{{Kind: "SACK"}, {Kind: "WindowScale", Value: 7}},
+			}, nil
+		}),
+		WithEmitOpenCallback(true),
+		WithObservers(rec),
+	)
+	if _, err := wrapped.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("Recorder.Err: %v", err)
+	}
+
+	var events []*RecordedEvent
+	for ev, err := range ReadRecording(&buf) {
+		if err != nil {
+			t.Fatalf("ReadRecording: %v", err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 2 || events[0].State != Opened || events[1].State != Closed {
+		t.Fatalf("recorded %+v, want an Opened and a Closed event", events)
+	}
+	closed := events[1]
+	if closed.Version != RecordFormatVersion || closed.TxBytes != 5 || closed.RemoteAddr != "127.0.0.1:443" ||
+		closed.OpenedAt != events[0].OpenedAt || closed.At < closed.OpenedAt {
+		t.Fatalf("Closed event = %+v", closed)
+	}
+	want := &tcpinfo.Info{
+		State:     "ESTABLISHED",
+		RTT:       2 * time.Millisecond,
+		TxOptions: []tcpinfo.Option{{Kind: "SACK"}, {Kind: "WindowScale", Value: 7}},
+	}
+	if !closed.Info.EqualIgnoring(want) {
+		t.Fatalf("replayed Info = %+v, want %+v", closed.Info, want)
+	}
+}
+
+func TestReadRecordingRejectsNewerVersion(t *testing.T) {
+	var n int
+	var lastErr error
+	for ev, err := range ReadRecording(strings.NewReader(`{"v":1,"state":2}` + "\n" + `{"v":99,"state":1}` + "\n")) {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ev.State != Sampled {
+			t.Fatalf("event = %+v, want the Sampled event", ev)
+		}
+		n++
+	}
+	if n != 1 || lastErr == nil || !strings.Contains(lastErr.Error(), "version 99") {
+		t.Fatalf("read %d events, error %v; want 1 event and a version error", n, lastErr)
+	}
+}
@@ -0,0 +1,361 @@
+package conniver
+
+import (
+	"context"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// RTTSample is a single round-trip time observation recorded by the periodic
+// sampler. At is a unix timestamp in nanoseconds, like the other Conn
+// timestamps, and Age is the time since OpenedAt at that instant.
+type RTTSample struct {
+	At     int64         `json:"at"`
+	Age    time.Duration `json:"age"`
+	RTT    time.Duration `json:"rtt"`
+	RTTVar time.Duration `json:"rttVar"`
+}
+
+// rttRing is a fixed-size ring buffer of the most recent RTT samples.
+type rttRing struct {
+	buf  []RTTSample
+	next int
+	full bool
+}
+
+func newRTTRing(size int) *rttRing {
+	if size <= 0 {
+		return nil
+	}
+	return &rttRing{buf: make([]RTTSample, size)}
+}
+
+func (r *rttRing) add(s RTTSample) {
+	if r == nil {
+		return
+	}
+	r.buf[r.next] = s
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// samples returns a copy of the buffered samples, oldest first.
+func (r *rttRing) samples() []RTTSample {
+	if r == nil {
+		return nil
+	}
+	if !r.full {
+		return append([]RTTSample(nil), r.buf[:r.next]...)
+	}
+	out := make([]RTTSample, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+func (r *rttRing) clone() *rttRing {
+	if r == nil {
+		return nil
+	}
+	return &rttRing{
+		buf:  append([]RTTSample(nil), r.buf...),
+		next: r.next,
+		full: r.full,
+	}
+}
+
+// startSampler launches the background tcpinfo sampler, using the open-time
+// tcpinfo as the first sample. It samples every interval and, when byteInterval
+// is positive, whenever Read or Write cross another byteInterval bytes. It runs
+// until Close is called or the wrapper's context is done. With
+// WithSampleScheduler and a positive interval, the connection is added to the
+// scheduler instead of starting a goroutine. Nothing is started for
+// connections without tcpinfo to read, such as those wrapped with
+// WithoutTCPInfo.
+func (w *Conn) startSampler(interval time.Duration, byteInterval int64, openedInfo *tcpinfo.Info) {
+	// ReportErr is only set this early by a ReportStatsErrFn failing on the
+	// Opened state, on this goroutine.
+	if interval <= 0 && byteInterval <= 0 || w.Conn == nil || w.ReportErr != nil || !w.readsTCPInfo() {
+		return
+	}
+
+	if sched := w.cfg.sampleScheduler; sched != nil && interval > 0 {
+		w.Lock()
+		w.sampling = true
+		w.recordSampleLocked(time.Now(), openedInfo)
+		w.enteredLossLocked(openedInfo)
+		w.byteInterval = byteInterval
+		w.nextSampleBytes = byteInterval
+		w.sampleEntry = sched.add(w, interval, w.Context)
+		w.sampleDone = w.sampleEntry.done
+		w.Unlock()
+		return
+	}
+
+	var ctxDone <-chan struct{}
+	if w.Context != nil {
+		ctxDone = w.Context.Done()
+	}
+
+	w.sampleStop = make(chan struct{})
+	w.sampleDone = make(chan struct{})
+
+	var kick chan struct{}
+	if byteInterval > 0 {
+		kick = make(chan struct{}, 1)
+	}
+
+	w.Lock()
+	w.sampling = true
+	w.recordSampleLocked(time.Now(), openedInfo)
+	w.enteredLossLocked(openedInfo)
+	if kick != nil {
+		w.sampleKick = kick
+		w.byteInterval = byteInterval
+		w.nextSampleBytes = byteInterval
+	}
+	w.Unlock()
+
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctxDone:
+				return
+			case now := <-tick:
+				w.sample(now)
+			case <-kick:
+				w.sample(time.Now())
+			}
+		}
+	}(w.sampleStop, w.sampleDone)
+}
+
+// Samples reads tcpinfo every interval and sends each reading on the returned
+// channel, a callback-free alternative to WithSampleInterval that can be used
+// with range. The channel is unbuffered, so a slow receiver delays the next
+// read instead of queueing stale ones, and reads that return no info are
+// skipped. The channel is closed, and its goroutine exits, once ctx or the
+// wrapper's context is done or Close starts. Close waits for that goroutine, so
+// nothing is sent after Close returns. The channel is returned already closed
+// if the connection is closed, interval is not positive, or there is no tcpinfo
+// to read. Readings are not folded into SampledInfo or the sampled stats, and
+// each call starts its own goroutine.
+func (w *Conn) Samples(ctx context.Context, interval time.Duration) <-chan *tcpinfo.Info {
+	out := make(chan *tcpinfo.Info)
+
+	w.Lock()
+	if interval <= 0 || w.closeStarted || w.Conn == nil || !w.readsTCPInfo() {
+		w.Unlock()
+		close(out)
+		return out
+	}
+	if w.closing == nil {
+		w.closing = make(chan struct{})
+	}
+	closing := w.closing
+	w.samplers.Add(1)
+	w.Unlock()
+
+	var connDone <-chan struct{}
+	if w.Context != nil {
+		connDone = w.Context.Done()
+	}
+	stopped := func() bool {
+		select {
+		case <-ctx.Done():
+		case <-connDone:
+		case <-closing:
+		default:
+			return false
+		}
+		return true
+	}
+
+	go func() {
+		defer w.samplers.Done()
+		defer close(out)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-connDone:
+				return
+			case <-closing:
+				return
+			case <-ticker.C:
+			}
+			// A tick and a teardown can be ready together; teardown wins.
+			if stopped() {
+				return
+			}
+			info, _ := w.readTCPInfo()
+			if info == nil {
+				continue
+			}
+			select {
+			case out <- info:
+			case <-ctx.Done():
+				return
+			case <-connDone:
+				return
+			case <-closing:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// kickByteSamplerLocked wakes the sampler if the bytes transferred have reached
+// the next multiple of the byte interval. It never blocks: if a kick is already
+// pending, the crossing is folded into that sample.
+func (w *Conn) kickByteSamplerLocked() {
+	if w.byteInterval <= 0 {
+		return
+	}
+	total := w.TxBytes + w.RxBytes
+	if total < w.nextSampleBytes {
+		return
+	}
+	w.nextSampleBytes = (total/w.byteInterval + 1) * w.byteInterval
+	if w.sampleEntry != nil {
+		w.sampleEntry.kick()
+		return
+	}
+	select {
+	case w.sampleKick <- struct{}{}:
+	default:
+	}
+}
+
+// stopSamplerLocked signals the sampler to exit, if it has not been already,
+// and returns a channel that is closed once it has, or nil if no sampler was
+// started. The caller must wait on the channel without holding the lock, since
+// an in-progress sample needs it to finish.
+func (w *Conn) stopSamplerLocked() <-chan struct{} {
+	if w.sampleStop != nil {
+		close(w.sampleStop)
+		w.sampleStop = nil
+	}
+	if w.sampleEntry != nil {
+		w.sampleEntry.stop()
+	}
+	return w.sampleDone
+}
+
+// sample reads tcpinfo, folds it into the sampled stats, and fires the report
+// callback in the Sampled state.
+func (w *Conn) sample(now time.Time) {
+	info, err := w.readTCPInfo()
+	if err != nil && w.logger != nil {
+		w.logger.Debug("conniver: tcpinfo sample failed", "remoteAddr", w.RemoteAddrString(), "error", err)
+	}
+
+	w.Lock()
+	if w.closeStarted || info == nil {
+		w.Unlock()
+		return
+	}
+	w.SampledInfo = info
+	w.SampledAge = w.ageLocked(now)
+	w.recordSampleLocked(now, info)
+	lossFn := w.lossFn
+	if !w.enteredLossLocked(info) {
+		lossFn = nil
+	}
+	reportStats := w.reportStats
+	if reportStats == nil && lossFn == nil {
+		w.Unlock()
+		return
+	}
+	snapshot := w.snapshotLocked()
+	w.Unlock()
+
+	if reportStats != nil {
+		reportStats(snapshot, Sampled)
+	}
+	if lossFn != nil {
+		lossFn(snapshot, info.CAState)
+	}
+}
+
+// enteredLossLocked records the loss recovery state from info and reports
+// whether the connection moved into Recovery or Loss since the previous sample.
+// Platforms that do not report the state never enter loss.
+func (w *Conn) enteredLossLocked(info *tcpinfo.Info) bool {
+	if info == nil || !info.Reported("caState") {
+		return false
+	}
+	prev := w.lastCAState
+	w.lastCAState = info.CAState
+	return info.CAState != prev && (info.CAState == tcpinfo.TCP_CA_Recovery || info.CAState == tcpinfo.TCP_CA_Loss)
+}
+
+// recordSampleLocked folds a tcpinfo sample into the RTT history and the
+// lifetime summary stats.
+func (w *Conn) recordSampleLocked(now time.Time, info *tcpinfo.Info) {
+	if info == nil {
+		return
+	}
+	w.rttHistory.add(RTTSample{
+		At:     now.UnixNano(),
+		Age:    w.ageLocked(now),
+		RTT:    info.RTT,
+		RTTVar: info.RTTVar,
+	})
+
+	if info.RTT > w.PeakRTT {
+		w.PeakRTT = info.RTT
+	}
+	if info.RTT > 0 && (w.MinObservedRTT == 0 || info.RTT < w.MinObservedRTT) {
+		w.MinObservedRTT = info.RTT
+	}
+
+	// Retransmits is cumulative, so the rate is the delta between samples.
+	if !w.lastSampleAt.IsZero() && now.After(w.lastSampleAt) && info.Retransmits >= w.lastRetransmits {
+		elapsed := now.Sub(w.lastSampleAt).Seconds()
+		if rate := float64(info.Retransmits-w.lastRetransmits) / elapsed; rate > w.PeakRetransRate {
+			w.PeakRetransRate = rate
+		}
+	}
+	w.lastSampleAt = now
+	w.lastRetransmits = info.Retransmits
+	w.recordLimitedTimeLocked(info)
+	w.recordActivityLocked(now, info)
+	w.recordRTOStormLocked(info)
+}
+
+// ageLocked returns how long the connection had been open at now, or zero if
+// OpenedAt is not set.
+func (w *Conn) ageLocked(now time.Time) time.Duration {
+	if w.OpenedAt == 0 {
+		return 0
+	}
+	return max(now.Sub(time.Unix(0, w.OpenedAt)), 0)
+}
+
+// RTTHistory returns a copy of the most recent RTT samples, oldest first. It
+// is only populated when both WithSampleInterval and WithRTTHistory are set.
+func (w *Conn) RTTHistory() []RTTSample {
+	w.Lock()
+	defer w.Unlock()
+	return w.rttHistory.samples()
+}
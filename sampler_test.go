@@ -0,0 +1,346 @@
+package conniver
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// countingInfoSource returns a source whose RTT grows by one millisecond per call.
+func countingInfoSource() func() (*tcpinfo.Info, error) {
+	var calls atomic.Int64
+	return func() (*tcpinfo.Info, error) {
+		n := calls.Add(1)
+		return &tcpinfo.Info{
+			RTT:    time.Duration(n) * time.Millisecond,
+			RTTVar: time.Duration(n) * time.Microsecond,
+		}, nil
+	}
+}
+
+func TestRTTRingKeepsMostRecentSamplesOldestFirst(t *testing.T) {
+	r := newRTTRing(3)
+	for i := 1; i <= 5; i++ {
+		r.add(RTTSample{At: int64(i)})
+	}
+
+	got := r.samples()
+	if len(got) != 3 {
+		t.Fatalf("len(samples) = %d, want 3", len(got))
+	}
+	for i, want := range []int64{3, 4, 5} {
+		if got[i].At != want {
+			t.Fatalf("samples[%d].At = %d, want %d", i, got[i].At, want)
+		}
+	}
+
+	got[0].At = 100
+	if r.samples()[0].At != 3 {
+		t.Fatal("samples() returned a slice aliasing the ring buffer")
+	}
+	if newRTTRing(0) != nil {
+		t.Fatal("newRTTRing(0) should disable the history")
+	}
+}
+
+func TestConnRTTHistoryFilledBySampler(t *testing.T) {
+	conn := newFakeConn()
+	closedCh := make(chan *Conn, 1)
+
+	wrapped := WrapConn(conn, func(snapshot *Conn, state int) {
+		if state == Closed {
+			closedCh <- snapshot
+		}
+	},
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Millisecond),
+		WithRTTHistory(4),
+	).(*Conn)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(wrapped.RTTHistory()) < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("RTTHistory() has %d samples, want 4", len(wrapped.RTTHistory()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	history := wrapped.RTTHistory()
+	for i := 1; i < len(history); i++ {
+		if history[i].RTT <= history[i-1].RTT || history[i].At < history[i-1].At {
+			t.Fatalf("RTTHistory() is not ordered oldest first: %+v", history)
+		}
+	}
+
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	snapshot := <-closedCh
+	if got := len(snapshot.RTTHistory()); got != 4 {
+		t.Fatalf("snapshot RTTHistory() has %d samples, want 4", got)
+	}
+
+	// The sampler has stopped, so the history no longer changes after Close.
+	after := wrapped.RTTHistory()
+	time.Sleep(10 * time.Millisecond)
+	if got := wrapped.RTTHistory(); got[len(got)-1] != after[len(after)-1] {
+		t.Fatal("sampler kept running after Close")
+	}
+}
+
+func TestConnRTTHistoryEmptyWithoutSampling(t *testing.T) {
+	wrapped := WrapConn(newFakeConn(), nil,
+		withInfoSource(countingInfoSource()),
+		WithRTTHistory(4),
+	).(*Conn)
+	defer wrapped.Close()
+
+	time.Sleep(5 * time.Millisecond)
+	if got := wrapped.RTTHistory(); len(got) != 0 {
+		t.Fatalf("RTTHistory() = %+v, want empty without WithSampleInterval", got)
+	}
+}
+
+func TestConnSummaryStatsFromSamples(t *testing.T) {
+	w := &Conn{}
+	start := time.Unix(1700000000, 0)
+	for i, s := range []struct {
+		rtt     time.Duration
+		retrans uint64
+	}{
+		{20 * time.Millisecond, 0},
+		{0, 2},                      // no RTT estimate yet; ignored for the minimum
+		{5 * time.Millisecond, 12},  // 10 retransmits in one second
+		{40 * time.Millisecond, 13}, // 1 retransmit in one second
+	} {
+		w.recordSampleLocked(start.Add(time.Duration(i)*time.Second), &tcpinfo.Info{
+			RTT:         s.rtt,
+			Retransmits: s.retrans,
+		})
+	}
+
+	if w.PeakRTT != 40*time.Millisecond {
+		t.Errorf("PeakRTT = %v, want 40ms", w.PeakRTT)
+	}
+	if w.MinObservedRTT != 5*time.Millisecond {
+		t.Errorf("MinObservedRTT = %v, want 5ms", w.MinObservedRTT)
+	}
+	if w.PeakRetransRate != 10 {
+		t.Errorf("PeakRetransRate = %v, want 10", w.PeakRetransRate)
+	}
+}
+
+func TestConnSampleRecordsAge(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	w := &Conn{
+		counters:   counters{OpenedAt: start.UnixNano()},
+		infoSource: countingInfoSource(),
+		rttHistory: newRTTRing(2),
+	}
+	w.sample(start.Add(3 * time.Second))
+	w.sample(start.Add(5 * time.Second))
+
+	if w.SampledAge != 5*time.Second {
+		t.Errorf("SampledAge = %v, want 5s", w.SampledAge)
+	}
+	history := w.RTTHistory()
+	if len(history) != 2 || history[0].Age != 3*time.Second || history[1].Age != 5*time.Second {
+		t.Errorf("RTTHistory() = %+v, want ages 3s and 5s", history)
+	}
+	if got := w.ToMap()["sampledAge"]; got != 5*time.Second {
+		t.Errorf("ToMap()[sampledAge] = %v, want 5s", got)
+	}
+}
+
+func TestConnSummaryStatsInClosedReport(t *testing.T) {
+	closedCh := make(chan *Conn, 1)
+	wrapped := WrapConn(newFakeConn(), func(snapshot *Conn, state int) {
+		if state == Closed {
+			closedCh <- snapshot
+		}
+	},
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Millisecond),
+	).(*Conn)
+
+	time.Sleep(10 * time.Millisecond)
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	snapshot := <-closedCh
+
+	// The counting source grows the RTT on every call, so the close-time
+	// sample is the peak and the open-time sample is the minimum.
+	if snapshot.MinObservedRTT != time.Millisecond {
+		t.Errorf("MinObservedRTT = %v, want 1ms", snapshot.MinObservedRTT)
+	}
+	if snapshot.PeakRTT != snapshot.ClosedInfo.RTT {
+		t.Errorf("PeakRTT = %v, want the close-time RTT %v", snapshot.PeakRTT, snapshot.ClosedInfo.RTT)
+	}
+	if _, ok := snapshot.ToMap()["peakRTT"]; !ok {
+		t.Error("ToMap() is missing peakRTT when sampling is enabled")
+	}
+}
+
+func TestConnSampledCallback(t *testing.T) {
+	sampledCh := make(chan *Conn, 16)
+	wrapped := WrapConn(newFakeConn(), func(snapshot *Conn, state int) {
+		if state == Sampled {
+			select {
+			case sampledCh <- snapshot:
+			default:
+			}
+		}
+	},
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Millisecond),
+	).(*Conn)
+	defer wrapped.Close()
+
+	select {
+	case snapshot := <-sampledCh:
+		if snapshot.SampledInfo == nil || snapshot.SampledInfo.RTT == 0 {
+			t.Fatalf("Sampled snapshot has SampledInfo = %+v", snapshot.SampledInfo)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Sampled callback did not fire")
+	}
+}
+
+func TestConnByteIntervalThresholds(t *testing.T) {
+	w := &Conn{byteInterval: 10, nextSampleBytes: 10, sampleKick: make(chan struct{}, 1)}
+
+	kicked := func() bool {
+		select {
+		case <-w.sampleKick:
+			return true
+		default:
+			return false
+		}
+	}
+
+	for _, step := range []struct {
+		tx, rx int64
+		kick   bool
+		next   int64
+	}{
+		{tx: 4, kick: false, next: 10},
+		{rx: 6, kick: true, next: 20},
+		{tx: 9, kick: false, next: 20},
+		{rx: 26, kick: true, next: 50},
+	} {
+		w.TxBytes += step.tx
+		w.RxBytes += step.rx
+		w.kickByteSamplerLocked()
+		if got := kicked(); got != step.kick || w.nextSampleBytes != step.next {
+			t.Fatalf("at %d bytes: kicked = %v, next = %d; want %v, %d",
+				w.TxBytes+w.RxBytes, got, w.nextSampleBytes, step.kick, step.next)
+		}
+	}
+}
+
+func TestConnByteIntervalSampledCallback(t *testing.T) {
+	sampledCh := make(chan *Conn, 16)
+	wrapped := WrapConn(newFakeConn(), func(snapshot *Conn, state int) {
+		if state == Sampled {
+			select {
+			case sampledCh <- snapshot:
+			default:
+			}
+		}
+	},
+		withInfoSource(countingInfoSource()),
+		WithByteInterval(8),
+	).(*Conn)
+	defer wrapped.Close()
+
+	if _, err := wrapped.Write(make([]byte, 5)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	select {
+	case <-sampledCh:
+		t.Fatal("sampled before the byte interval was crossed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if _, err := wrapped.Write(make([]byte, 5)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	select {
+	case snapshot := <-sampledCh:
+		if snapshot.TxBytes != 10 || snapshot.SampledInfo == nil {
+			t.Fatalf("Sampled snapshot TxBytes = %d, SampledInfo = %+v", snapshot.TxBytes, snapshot.SampledInfo)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Sampled callback did not fire after crossing the byte interval")
+	}
+}
+
+func BenchmarkConnReadWriteSample(b *testing.B) {
+	info := &tcpinfo.Info{State: "ESTABLISHED", RTT: time.Millisecond, TxBytes: 4096}
+	conn := newFakeConn()
+	conn.readData = make([]byte, 512)
+	wrapped := WrapConn(conn, func(*Conn, int) {},
+		withInfoSource(func() (*tcpinfo.Info, error) { return info, nil }),
+		WithSampleInterval(time.Hour),
+		WithRTTHistory(16),
+	).(*Conn)
+	defer wrapped.Close()
+
+	buf := make([]byte, 512)
+	b.ReportAllocs()
+	for b.Loop() {
+		_, _ = wrapped.Read(buf)
+		_, _ = wrapped.Write(buf)
+		wrapped.sample(time.Now())
+	}
+}
+
+func TestConnSamplesUntilClose(t *testing.T) {
+	wrapped := WrapConn(newFakeConn(), nil, withInfoSource(countingInfoSource())).(*Conn)
+
+	var got []*tcpinfo.Info
+	for info := range wrapped.Samples(context.Background(), time.Millisecond) {
+		got = append(got, info)
+		if len(got) == 3 {
+			if err := wrapped.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+		}
+	}
+	if len(got) != 3 {
+		t.Fatalf("received %d samples, want the 3 before Close", len(got))
+	}
+	if got[2].RTT <= got[0].RTT {
+		t.Fatalf("sample RTTs = %v, %v, want fresh reads", got[0].RTT, got[2].RTT)
+	}
+
+	if _, ok := <-wrapped.Samples(context.Background(), time.Millisecond); ok {
+		t.Fatal("Samples on a closed connection returned an open channel")
+	}
+}
+
+func TestConnSamplesStopsOnContextCancel(t *testing.T) {
+	wrapped := WrapConn(newFakeConn(), nil, withInfoSource(countingInfoSource())).(*Conn)
+	defer wrapped.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	samples := wrapped.Samples(ctx, time.Millisecond)
+	<-samples
+	cancel()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-samples:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Samples channel was not closed after the context was canceled")
+		}
+	}
+}
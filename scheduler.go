@@ -0,0 +1,230 @@
+package conniver
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// SampleScheduler runs the periodic samplers of many connections from a small
+// pool of goroutines, for processes with too many open connections to give
+// each its own sampler goroutine and ticker. Pass it to WrapConn with
+// WithSampleScheduler; each connection keeps its own WithSampleInterval, so
+// chatty upstreams can be sampled every 100ms and bulk transfers every 5s
+// through the same scheduler.
+//
+// Due samples are kept in a min-heap, so adding, kicking, and removing a
+// connection costs O(log n), and a single goroutine sleeps until the earliest
+// one is due. When samples fall due faster than one goroutine can take them,
+// up to Workers goroutines take them in parallel, and the extra ones exit once
+// they have caught up. No goroutine runs while nothing is scheduled. The
+// Sampled callbacks and observers run on these goroutines, so a slow callback
+// delays the samples of other connections on the scheduler, and they must not
+// call Close on their own connection, which waits for the sample in progress.
+// A connection that misses its time is sampled once, late, rather than
+// catching up, and is never sampled by two goroutines at once. A connection
+// leaves the scheduler as soon as it is closed or its context is done. The zero
+// value is ready to use and a SampleScheduler must not be copied after first
+// use.
+type SampleScheduler struct {
+	// Workers is the most goroutines that take samples at once. Zero or
+	// negative means one. Set it before the first connection is added.
+	Workers int
+
+	mu      sync.Mutex
+	queue   sampleQueue
+	wake    chan struct{}
+	running int
+}
+
+// NewSampleScheduler returns an empty SampleScheduler with one worker.
+func NewSampleScheduler() *SampleScheduler {
+	return &SampleScheduler{}
+}
+
+// scheduledSample is one connection's place on a SampleScheduler.
+type scheduledSample struct {
+	s        *SampleScheduler
+	w        *Conn
+	interval time.Duration
+	ctxDone  <-chan struct{}
+	unwatch  func() bool // Stops watching the connection's context
+	next     time.Time
+	index    int           // Position in the heap, or -1 while sampling or once removed
+	removed  bool          // stop was called; done is closed once no sample is in progress
+	done     chan struct{} // Closed once the connection is off the scheduler
+}
+
+// add schedules w every interval, with the first sample one interval from now.
+// The connection is taken off the scheduler as soon as ctx is done, not at its
+// next due sample, so a long interval does not keep done open after ctx ends.
+func (s *SampleScheduler) add(w *Conn, interval time.Duration, ctx context.Context) *scheduledSample {
+	e := &scheduledSample{
+		s:        s,
+		w:        w,
+		interval: interval,
+		next:     time.Now().Add(interval),
+		done:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heap.Push(&s.queue, e)
+	if ctx != nil {
+		e.ctxDone = ctx.Done()
+		// The callback runs on its own goroutine, so it waits for s.mu.
+		e.unwatch = context.AfterFunc(ctx, e.stop)
+	}
+	s.startLocked()
+	return e
+}
+
+// startLocked starts a scheduler goroutine if none is running, or wakes the
+// sleeping one to recompute its sleep.
+func (s *SampleScheduler) startLocked() {
+	if s.wake == nil {
+		s.wake = make(chan struct{}, 1)
+	}
+	if s.running == 0 {
+		s.running = 1
+		go s.run()
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop takes the connection off the scheduler. If its sample is in progress,
+// done is closed once that sample finishes.
+func (e *scheduledSample) stop() {
+	s := e.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.removed {
+		return
+	}
+	e.removed = true
+	if e.index >= 0 {
+		heap.Remove(&s.queue, e.index)
+		e.releaseLocked()
+	}
+}
+
+// releaseLocked marks the connection as off the scheduler and stops watching
+// its context.
+func (e *scheduledSample) releaseLocked() {
+	if e.unwatch != nil {
+		e.unwatch()
+	}
+	close(e.done)
+}
+
+// kick makes the connection due now, for WithByteInterval.
+func (e *scheduledSample) kick() {
+	s := e.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.index < 0 {
+		// Sampling now or removed; a sample in progress covers the crossing.
+		return
+	}
+	e.next = time.Now()
+	heap.Fix(&s.queue, e.index)
+	s.startLocked()
+}
+
+func (s *SampleScheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.running--
+			s.mu.Unlock()
+			return
+		}
+		e := s.queue[0]
+		now := time.Now()
+		if wait := e.next.Sub(now); wait > 0 {
+			// Caught up: one goroutine is enough to wait for the next sample.
+			// Wake the one already waiting, since the sample this goroutine
+			// just rescheduled may be due before the one it waits for.
+			if s.running > 1 {
+				s.running--
+				select {
+				case s.wake <- struct{}{}:
+				default:
+				}
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				timer.Stop()
+			}
+			continue
+		}
+		heap.Pop(&s.queue)
+		if len(s.queue) > 0 && !s.queue[0].next.After(now) && s.running < max(s.Workers, 1) {
+			s.running++
+			go s.run()
+		}
+		s.mu.Unlock()
+
+		canceled := false
+		select {
+		case <-e.ctxDone:
+			canceled = true
+		default:
+			e.w.sample(time.Now())
+		}
+
+		s.mu.Lock()
+		if canceled || e.removed {
+			e.removed = true
+			e.releaseLocked()
+		} else {
+			now := time.Now()
+			e.next = e.next.Add(e.interval)
+			if e.next.Before(now) {
+				e.next = now.Add(e.interval)
+			}
+			heap.Push(&s.queue, e)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// sampleQueue is a min-heap of scheduled connections ordered by their next
+// sample time.
+type sampleQueue []*scheduledSample
+
+func (q sampleQueue) Len() int           { return len(q) }
+func (q sampleQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q sampleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *sampleQueue) Push(x any) {
+	e := x.(*scheduledSample)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *sampleQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,230 @@
+package conniver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestSampleSchedulerPerConnIntervals(t *testing.T) {
+	sched := NewSampleScheduler()
+	wrap := func(interval time.Duration, samples *atomic.Int64) *Conn {
+		return WrapConn(newFakeConn(), func(_ *Conn, state int) {
+			if state == Sampled {
+				samples.Add(1)
+			}
+		},
+			withInfoSource(countingInfoSource()),
+			WithSampleInterval(interval),
+			WithSampleScheduler(sched),
+		).(*Conn)
+	}
+
+	var fast, slow atomic.Int64
+	fastConn := wrap(2*time.Millisecond, &fast)
+	slowConn := wrap(time.Hour, &slow)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for fast.Load() < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("fast connection sampled %d times, want 5", fast.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := fastConn.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	after := fast.Load()
+
+	// The slow connection is still scheduled an hour out; Close must not wait for it.
+	closed := make(chan error, 1)
+	go func() { closed <- slowConn.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close waited for the next scheduled sample")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if got := fast.Load(); got != after {
+		t.Fatalf("fast connection sampled %d times after Close", got-after)
+	}
+	if slow.Load() != 0 {
+		t.Fatalf("slow connection sampled %d times, want none", slow.Load())
+	}
+	sched.mu.Lock()
+	queued := len(sched.queue)
+	sched.mu.Unlock()
+	if queued != 0 {
+		t.Fatalf("scheduler still holds %d connections after Close", queued)
+	}
+}
+
+func TestSampleSchedulerDropsCanceledConn(t *testing.T) {
+	sched := NewSampleScheduler()
+	ctx, cancel := context.WithCancel(context.Background())
+	w := WrapConnWithContext(ctx, newFakeConn(), nil,
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Hour),
+		WithSampleScheduler(sched),
+	).(*Conn)
+	defer w.Close()
+
+	w.Lock()
+	done := w.sampleDone
+	w.Unlock()
+	cancel()
+
+	// The next sample is an hour out, so only the context watch can end it.
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("canceling the context left the connection on the scheduler")
+	}
+	sched.mu.Lock()
+	queued := len(sched.queue)
+	sched.mu.Unlock()
+	if queued != 0 {
+		t.Fatalf("scheduler still holds %d connections after cancel", queued)
+	}
+}
+
+func TestSampleSchedulerByteInterval(t *testing.T) {
+	var samples atomic.Int64
+	wrapped := WrapConn(newFakeConn(), func(_ *Conn, state int) {
+		if state == Sampled {
+			samples.Add(1)
+		}
+	},
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Hour),
+		WithByteInterval(10),
+		WithSampleScheduler(NewSampleScheduler()),
+	)
+	defer wrapped.Close()
+
+	if _, err := wrapped.Write(make([]byte, 10)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for samples.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("crossing the byte interval did not trigger a scheduled sample")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSampleSchedulerWorkers(t *testing.T) {
+	sched := &SampleScheduler{Workers: 4}
+	counts := make([]atomic.Int64, 50)
+	conns := make([]*Conn, len(counts))
+	for i := range conns {
+		conns[i] = WrapConn(newFakeConn(), func(_ *Conn, state int) {
+			if state == Sampled {
+				counts[i].Add(1)
+			}
+		},
+			withInfoSource(countingInfoSource()),
+			WithSampleInterval(time.Millisecond),
+			WithSampleScheduler(sched),
+		).(*Conn)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for i := range counts {
+		for counts[i].Load() < 3 {
+			if time.Now().After(deadline) {
+				t.Fatalf("connection %d sampled %d times, want 3", i, counts[i].Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, c := range conns {
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	// With nothing scheduled, every worker exits.
+	for {
+		sched.mu.Lock()
+		running := sched.running
+		sched.mu.Unlock()
+		if running == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d scheduler goroutines still running with nothing scheduled", running)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// BenchmarkSamplers compares a goroutine per connection with a shared
+// SampleScheduler, sampling every connection every second. Each op is one
+// sampling interval; goroutines is the number the samplers added, and
+// cpu-ms/op the Go user CPU time spent per interval.
+func BenchmarkSamplers(b *testing.B) {
+	for _, n := range []int{10_000, 50_000} {
+		for _, shared := range []bool{false, true} {
+			name := fmt.Sprintf("conns=%d/per-conn", n)
+			if shared {
+				name = fmt.Sprintf("conns=%d/scheduler", n)
+			}
+			b.Run(name, func(b *testing.B) {
+				benchmarkSamplers(b, n, shared)
+			})
+		}
+	}
+}
+
+func benchmarkSamplers(b *testing.B, n int, shared bool) {
+	const interval = time.Second
+	info := &tcpinfo.Info{RTT: time.Millisecond}
+	opts := []WrapOption{
+		withInfoSource(func() (*tcpinfo.Info, error) { return info, nil }),
+		WithSampleInterval(interval),
+	}
+	if shared {
+		opts = append(opts, WithSampleScheduler(&SampleScheduler{Workers: runtime.GOMAXPROCS(0)}))
+	}
+
+	before := runtime.NumGoroutine()
+	conns := make([]net.Conn, n)
+	for i := range conns {
+		conns[i] = WrapConn(newFakeConn(), nil, opts...)
+	}
+	defer func() {
+		var wg sync.WaitGroup
+		for _, c := range conns {
+			wg.Go(func() { _ = c.Close() })
+		}
+		wg.Wait()
+	}()
+	goroutines := runtime.NumGoroutine() - before
+
+	// The runtime only updates its CPU estimates at garbage collection.
+	cpu := []metrics.Sample{{Name: "/cpu/classes/user:cpu-seconds"}}
+	runtime.GC()
+	metrics.Read(cpu)
+	start := cpu[0].Value.Float64()
+	for b.Loop() {
+		time.Sleep(interval)
+	}
+	runtime.GC()
+	metrics.Read(cpu)
+	b.ReportMetric(float64(goroutines), "goroutines")
+	b.ReportMetric((cpu[0].Value.Float64()-start)*1e3/float64(b.N), "cpu-ms/op")
+}
@@ -0,0 +1,109 @@
+package conniver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// WrapServerConns instruments the connections accepted by srv through its
+// ConnContext and ConnState hooks, for servers whose listener cannot be
+// replaced. It must be called before srv starts serving. Any ConnContext or
+// ConnState callback already set on srv is kept; ConnContext runs before the
+// wrapper's and ConnState after it.
+//
+// Every request context carries the connection's *Conn, so handlers and
+// logging middleware can find it with ConnFromContext(r.Context()) and read
+// its live tcpinfo with Sample, or LatestInfo when sampling is enabled.
+//
+// Because ConnState only observes the connection, the server keeps reading and
+// writing the raw net.Conn: the wrapper's byte counters and First/Last I/O
+// times stay zero, and the kernel's counts in the tcpinfo snapshots are the
+// source for transferred bytes. The lifecycle is:
+//
+//   - ConnContext, which the server calls right before http.StateNew, wraps
+//     the connection as WrapConn does, reading OpenedInfo, firing the Opened
+//     callback if WithEmitOpenCallback is set, and starting the sampler if one
+//     is configured. It stores the wrapper in the connection's base context.
+//   - http.StateNew wraps the connection the same way if ConnContext did not,
+//     such as when srv.ConnContext was replaced after this call.
+//   - http.StateActive and http.StateIdle are ignored.
+//   - http.StateHijacked reads ClosedInfo from the still-open socket and fires
+//     the Closed callback, leaving the connection open for the handler that
+//     took it over.
+//   - http.StateClosed fires the Closed callback without a close-time read,
+//     since the server has already closed the socket. ClosedInfo is instead a
+//     copy of the latest SampledInfo, or of OpenedInfo, with
+//     ClosedInfoFallback set; use WithSampleInterval to keep it recent.
+//
+// Each connection is held in a map from StateNew until its terminal state,
+// StateHijacked or StateClosed, which http.Server delivers exactly once for
+// every connection it reported as new, including on Shutdown and Close.
+// Entries are removed before the Closed callback runs, so the map does not
+// outlive the connections it tracks.
+func WrapServerConns(srv *http.Server, reportStatsFn ReportStatsFn, opts ...WrapOption) {
+	t := &serverConns{
+		conns:    make(map[net.Conn]*Conn),
+		next:     srv.ConnState,
+		nextCtx:  srv.ConnContext,
+		reportFn: reportStatsFn,
+		opts:     opts,
+	}
+	srv.ConnState = t.connState
+	srv.ConnContext = t.connContext
+}
+
+// serverConns tracks the wrappers for the connections of one http.Server.
+type serverConns struct {
+	mu       sync.Mutex
+	conns    map[net.Conn]*Conn
+	next     func(net.Conn, http.ConnState)
+	nextCtx  func(context.Context, net.Conn) context.Context
+	reportFn ReportStatsFn
+	opts     []WrapOption
+}
+
+// connContext wraps c and stores the wrapper in its context. The server calls
+// it and then connState with StateNew from its accept loop, one after the
+// other, so the two never race to wrap the same connection.
+func (t *serverConns) connContext(ctx context.Context, c net.Conn) context.Context {
+	if t.nextCtx != nil {
+		ctx = t.nextCtx(ctx, c)
+	}
+	return ContextWithConn(ctx, t.wrap(c))
+}
+
+// wrap returns the wrapper for c, wrapping it on first use.
+func (t *serverConns) wrap(c net.Conn) *Conn {
+	t.mu.Lock()
+	w := t.conns[c]
+	t.mu.Unlock()
+	if w != nil {
+		return w
+	}
+	w = WrapConn(c, t.reportFn, t.opts...).(*Conn)
+	t.mu.Lock()
+	t.conns[c] = w
+	t.mu.Unlock()
+	return w
+}
+
+func (t *serverConns) connState(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		t.wrap(c)
+	case http.StateHijacked, http.StateClosed:
+		t.mu.Lock()
+		w := t.conns[c]
+		delete(t.conns, c)
+		t.mu.Unlock()
+		if w != nil {
+			_ = w.finish(false, state == http.StateHijacked)
+		}
+	}
+
+	if t.next != nil {
+		t.next(c, state)
+	}
+}
@@ -0,0 +1,148 @@
+package conniver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestWrapServerConnsReportsClosedAndHijacked(t *testing.T) {
+	var mu sync.Mutex
+	var closed []*Conn
+	var states []http.ConnState
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hijack" {
+			_, _ = io.WriteString(rw, "ok")
+			return
+		}
+		conn, buf, err := rw.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		_ = buf.Flush()
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	}
+	WrapServerConns(srv.Config, func(c *Conn, state int) {
+		if state == Closed {
+			mu.Lock()
+			closed = append(closed, c)
+			mu.Unlock()
+		}
+	})
+	srv.Start()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, path := range []string{"/", "/hijack"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Fatalf("GET %s body = %q, want ok", path, body)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(closed)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d Closed reports, want 2", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, c := range closed {
+		if c.OpenedAt == 0 || c.ClosedAt < c.OpenedAt || c.RemoteAddrString() == "" {
+			t.Fatalf("Closed report = %+v, want open and close times and the peer address", c)
+		}
+	}
+	for _, want := range []http.ConnState{http.StateNew, http.StateHijacked, http.StateClosed} {
+		if !slices.Contains(states, want) {
+			t.Fatalf("chained ConnState saw %v, want it to still receive %v", states, want)
+		}
+	}
+}
+
+func TestWrapServerConnsPutsConnInRequestContext(t *testing.T) {
+	type seen struct {
+		conn *Conn
+		info *tcpinfo.Info
+		err  error
+	}
+	seenCh := make(chan seen, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		c := ConnFromContext(r.Context())
+		var s seen
+		s.conn = c
+		if c != nil {
+			s.info, s.err = c.Sample()
+		}
+		seenCh <- s
+		_, _ = io.WriteString(rw, "ok")
+	}))
+	var baseCtxCalled bool
+	srv.Config.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
+		baseCtxCalled = true
+		return ctx
+	}
+	WrapServerConns(srv.Config, nil)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+
+	s := <-seenCh
+	if s.conn == nil {
+		t.Fatal("ConnFromContext(r.Context()) = nil, want the serving Conn")
+	}
+	if !baseCtxCalled {
+		t.Fatal("the server's existing ConnContext was not called")
+	}
+	if tcpinfo.Supported() && s.info == nil {
+		t.Fatalf("Sample() = nil, %v; want live tcpinfo", s.err)
+	}
+}
+
+func TestConnContext(t *testing.T) {
+	if c := ConnFromContext(context.Background()); c != nil {
+		t.Fatalf("ConnFromContext(empty) = %v, want nil", c)
+	}
+	w := WrapConn(newFakeConn(), nil).(*Conn)
+	defer w.Close()
+	if got := ConnFromContext(ConnContext(context.Background(), w)); got != w {
+		t.Fatalf("ConnFromContext(ConnContext(w)) = %p, want %p", got, w)
+	}
+	if got := ConnFromContext(ConnContext(context.Background(), newFakeConn())); got != nil {
+		t.Fatalf("ConnContext stored %v for an unwrapped conn", got)
+	}
+}
@@ -0,0 +1,316 @@
+package conniver
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// latestInfoLocked returns the most recent tcpinfo snapshot: the close-time
+// one if the connection is closed, otherwise the last periodic sample, falling
+// back to the open-time one.
+func (w *Conn) latestInfoLocked() *tcpinfo.Info {
+	switch {
+	case w.ClosedInfo != nil:
+		return w.ClosedInfo
+	case w.SampledInfo != nil:
+		return w.SampledInfo
+	default:
+		return w.OpenedInfo
+	}
+}
+
+// LatestInfo returns a copy of the most recent tcpinfo snapshot: ClosedInfo
+// once the connection is closed, otherwise SampledInfo, falling back to
+// OpenedInfo. It is safe to call while the sampler is running, and returns nil
+// if no tcpinfo has been read.
+func (w *Conn) LatestInfo() *tcpinfo.Info {
+	w.Lock()
+	defer w.Unlock()
+	return w.latestInfoLocked().Clone()
+}
+
+// Snapshot returns a detached copy of the wrapper, like the one passed to the
+// report callback, taken under the lock so its counters and its OpenedInfo,
+// SampledInfo, and ClosedInfo are consistent with each other. It is safe to
+// call while the sampler is running.
+func (w *Conn) Snapshot() *Conn {
+	w.Lock()
+	defer w.Unlock()
+	return w.snapshotLocked()
+}
+
+// Goodput returns the effective payload throughput in bytes per second over the
+// connection lifetime. It prefers the kernel's count of acknowledged bytes,
+// then the kernel's count of sent bytes, then the bytes written through the
+// wrapper. For a connection that is still open the lifetime runs until now. It
+// returns 0 if the lifetime is not positive.
+func (w *Conn) Goodput() float64 {
+	w.Lock()
+	defer w.Unlock()
+	return w.goodputLocked()
+}
+
+func (w *Conn) goodputLocked() float64 {
+	end := w.ClosedAt
+	if end == 0 {
+		end = time.Now().UnixNano()
+	}
+	lifetime := time.Duration(end - w.OpenedAt)
+	if w.OpenedAt == 0 || lifetime <= 0 {
+		return 0
+	}
+
+	bytes := float64(w.TxBytes)
+	if info := w.latestInfoLocked(); info != nil {
+		switch {
+		case info.BytesAcked > 0:
+			bytes = float64(info.BytesAcked)
+		case info.TxBytes > 0:
+			bytes = float64(info.TxBytes)
+		}
+	}
+	return bytes / lifetime.Seconds()
+}
+
+// FirstByteAt returns when Read first returned data on the connection, or the
+// zero time if it has not. It is FirstRxAt as a time.Time: the wrapper records
+// it under its lock from the first Read with n > 0, so it is set once per
+// connection for any protocol, not only HTTP.
+func (w *Conn) FirstByteAt() time.Time {
+	w.Lock()
+	defer w.Unlock()
+	if w.FirstRxAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, w.FirstRxAt)
+}
+
+// TimeToFirstByte returns the time from OpenedAt until Read first returned
+// data, or 0 if no data has been read yet.
+func (w *Conn) TimeToFirstByte() time.Duration {
+	w.Lock()
+	defer w.Unlock()
+	return w.timeToFirstByteLocked()
+}
+
+func (w *Conn) timeToFirstByteLocked() time.Duration {
+	if w.FirstRxAt == 0 || w.OpenedAt == 0 {
+		return 0
+	}
+	return time.Duration(w.FirstRxAt - w.OpenedAt)
+}
+
+// DeliveryRateMbps returns the kernel's most recent delivery rate estimate in
+// megabits per second, or 0 where the platform does not report one.
+func (w *Conn) DeliveryRateMbps() float64 {
+	w.Lock()
+	defer w.Unlock()
+	return w.deliveryRateMbpsLocked()
+}
+
+func (w *Conn) deliveryRateMbpsLocked() float64 {
+	info := w.latestInfoLocked()
+	if info == nil {
+		return 0
+	}
+	return float64(info.DeliveryRate) * 8 / 1e6
+}
+
+// WasAppLimited reports whether the kernel flagged the most recent delivery rate
+// as limited by the application rather than the network. A low delivery rate
+// on an app-limited connection says little about the network path.
+func (w *Conn) WasAppLimited() bool {
+	w.Lock()
+	defer w.Unlock()
+	return w.wasAppLimitedLocked()
+}
+
+func (w *Conn) wasAppLimitedLocked() bool {
+	info := w.latestInfoLocked()
+	return info != nil && info.AppLimited
+}
+
+// ECN returns the ECN summary from the most recent tcpinfo snapshot: whether
+// ECN was negotiated and how many delivered segments the path CE marked. See
+// tcpinfo.ECN for which platforms report each part.
+func (w *Conn) ECN() tcpinfo.ECN {
+	w.Lock()
+	defer w.Unlock()
+	return w.latestInfoLocked().ECN()
+}
+
+// FlowControlState is what limited the sender between the two most recent
+// tcpinfo samples, as returned by Conn.FlowControlState.
+type FlowControlState uint8
+
+const (
+	FlowControlUnknown       FlowControlState = iota // Fewer than two samples, or the platform does not report send limits
+	FlowControlUnlimited                             // Neither the receive window nor the send buffer limited the sender
+	FlowControlRwndLimited                           // The peer's receive window limited the sender
+	FlowControlSndbufLimited                         // The local send buffer limited the sender
+)
+
+var flowControlStateNames = [...]string{
+	FlowControlUnknown:       "unknown",
+	FlowControlUnlimited:     "unlimited",
+	FlowControlRwndLimited:   "rwnd-limited",
+	FlowControlSndbufLimited: "sndbuf-limited",
+}
+
+func (s FlowControlState) String() string {
+	if int(s) < len(flowControlStateNames) {
+		return flowControlStateNames[s]
+	}
+	return "unknown"
+}
+
+// FlowControlState reports whether the sender was limited by the peer's
+// receive window or the local send buffer between the two most recent
+// samples. The kernel only keeps cumulative limited times, so this shows a
+// stall as it happens rather than averaged over the connection's life. When
+// both limits grew, the one that grew more wins. It needs WithSampleInterval
+// or WithByteInterval, and Linux 4.10+ or Windows; otherwise it returns
+// FlowControlUnknown.
+func (w *Conn) FlowControlState() FlowControlState {
+	w.Lock()
+	defer w.Unlock()
+	return w.flowControl
+}
+
+// recordLimitedTimeLocked updates the flow control state from the change in
+// the cumulative limited times since the previous sample.
+func (w *Conn) recordLimitedTimeLocked(info *tcpinfo.Info) {
+	rwnd, sndbuf, ok := info.LimitedTime()
+	if !ok {
+		return
+	}
+	if w.limitedSampled && rwnd >= w.lastRwndLimited && sndbuf >= w.lastSndbufLimited {
+		rwndDelta, sndbufDelta := rwnd-w.lastRwndLimited, sndbuf-w.lastSndbufLimited
+		switch {
+		case rwndDelta == 0 && sndbufDelta == 0:
+			w.flowControl = FlowControlUnlimited
+		case rwndDelta >= sndbufDelta:
+			w.flowControl = FlowControlRwndLimited
+		default:
+			w.flowControl = FlowControlSndbufLimited
+		}
+	}
+	w.lastRwndLimited, w.lastSndbufLimited = rwnd, sndbuf
+	w.limitedSampled = true
+}
+
+// Stalled reports whether the most recent sample found that no bytes had
+// moved in either direction for at least the WithStallTimeout duration while
+// the connection was open, as happens with a half-open connection or a stuck
+// peer. A transfer seen at a later sample clears it. Activity is the byte
+// counts of both the wrapper and the kernel's tcpinfo, so connections whose
+// I/O bypasses the wrapper, such as those from WrapServerConns, are covered
+// too. It is always false without WithStallTimeout and WithSampleInterval or
+// WithByteInterval.
+func (w *Conn) Stalled() bool {
+	w.Lock()
+	defer w.Unlock()
+	return w.stalled
+}
+
+// recordActivityLocked updates the last-activity time from the byte counts
+// and re-evaluates the stalled flag. The first sample, taken at open, starts
+// the detection window.
+func (w *Conn) recordActivityLocked(now time.Time, info *tcpinfo.Info) {
+	if w.cfg.stallTimeout <= 0 {
+		return
+	}
+	total := uint64(w.TxBytes+w.RxBytes) + info.TxBytes + info.RxBytes
+	if w.lastActivityAt.IsZero() || total != w.activityBytes {
+		w.lastActivityAt = now
+		w.activityBytes = total
+	}
+	w.stalled = now.Sub(w.lastActivityAt) >= w.cfg.stallTimeout
+}
+
+// DefaultRTOStormBackoff is the RTO backoff at which InRTOStorm reports a
+// storm unless WithRTOStormBackoff sets another: three timeouts in a row,
+// with the RTO grown to eight times its base value.
+const DefaultRTOStormBackoff = 3
+
+// InRTOStorm reports whether the most recent sample found the kernel's RTO
+// backoff at or above the WithRTOStormBackoff threshold, DefaultRTOStormBackoff
+// by default, meaning the connection has hit that many retransmission timeouts
+// in a row without a successful RTT measurement. It flags a badly degraded
+// connection while it is still open, and clears once an acknowledgement
+// resets the backoff. It needs WithSampleInterval or WithByteInterval, and
+// Linux, the one platform that reports the backoff.
+func (w *Conn) InRTOStorm() bool {
+	w.Lock()
+	defer w.Unlock()
+	return w.rtoStorm
+}
+
+// recordRTOStormLocked re-evaluates the RTO storm flag from a sample's backoff.
+func (w *Conn) recordRTOStormLocked(info *tcpinfo.Info) {
+	threshold := w.cfg.rtoStormBackoff
+	if threshold == 0 {
+		threshold = DefaultRTOStormBackoff
+	}
+	backoff, ok := info.Backoff()
+	if threshold < 0 || !ok {
+		return
+	}
+	w.rtoStorm = int(backoff) >= threshold
+}
+
+// FastOpen reports whether the connection used TCP Fast Open, from its most
+// recent tcpinfo snapshot: not attempted, succeeded, or failed with the
+// kernel's reason. It is tcpinfo.FastOpenUnknown where the platform does not
+// report Fast Open, which is everywhere but Linux and macOS, and before the
+// first tcpinfo read.
+func (w *Conn) FastOpen() tcpinfo.FastOpenResult {
+	w.Lock()
+	defer w.Unlock()
+	return w.latestInfoLocked().FastOpen()
+}
+
+// MarshalJSON encodes the Conn fields along with the derived goodput,
+// deliveryRateMbps, appLimited, timeToFirstByte, stalled, rtoStorm, and
+// fastOpen values.
+func (w *Conn) MarshalJSON() ([]byte, error) {
+	type plainConn Conn
+
+	// The sampler and I/O write the fields while the connection is open, so
+	// marshal a snapshot taken under the same lock as the derived values.
+	w.Lock()
+	snap := w.snapshotLocked()
+	goodput := w.goodputLocked()
+	deliveryRateMbps := w.deliveryRateMbpsLocked()
+	appLimited := w.wasAppLimitedLocked()
+	timeToFirstByte := w.timeToFirstByteLocked()
+	stalled := w.stalled
+	rtoStorm := w.rtoStorm
+	var fastOpen string
+	if fo := w.latestInfoLocked().FastOpen(); fo.State != tcpinfo.FastOpenUnknown {
+		fastOpen = fo.String()
+	}
+	w.Unlock()
+
+	return json.Marshal(struct {
+		*plainConn
+		Goodput          float64       `json:"goodput,omitempty"`
+		DeliveryRateMbps float64       `json:"deliveryRateMbps,omitempty"`
+		AppLimited       bool          `json:"appLimited,omitempty"`
+		TimeToFirstByte  time.Duration `json:"timeToFirstByte,omitempty"`
+		Stalled          bool          `json:"stalled,omitempty"`
+		RTOStorm         bool          `json:"rtoStorm,omitempty"`
+		FastOpen         string        `json:"fastOpen,omitempty"`
+	}{
+		plainConn:        (*plainConn)(snap),
+		Goodput:          goodput,
+		DeliveryRateMbps: deliveryRateMbps,
+		AppLimited:       appLimited,
+		TimeToFirstByte:  timeToFirstByte,
+		Stalled:          stalled,
+		RTOStorm:         rtoStorm,
+		FastOpen:         fastOpen,
+	})
+}
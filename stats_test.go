@@ -0,0 +1,220 @@
+package conniver
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+func TestConnGoodput(t *testing.T) {
+	opened := time.Unix(1700000000, 0)
+	w := &Conn{
+		counters: counters{
+			OpenedAt: opened.UnixNano(),
+			ClosedAt: opened.Add(2 * time.Second).UnixNano(),
+			TxBytes:  1000,
+		},
+		ClosedInfo: &tcpinfo.Info{BytesAcked: 4000, TxBytes: 5000},
+	}
+	if got := w.Goodput(); got != 2000 {
+		t.Fatalf("Goodput() = %v, want 2000 from BytesAcked", got)
+	}
+
+	w.ClosedInfo.BytesAcked = 0
+	if got := w.Goodput(); got != 2500 {
+		t.Fatalf("Goodput() = %v, want 2500 from kernel TxBytes", got)
+	}
+
+	w.ClosedInfo = nil
+	if got := w.Goodput(); got != 500 {
+		t.Fatalf("Goodput() = %v, want 500 from wrapper TxBytes", got)
+	}
+
+	w.ClosedAt = w.OpenedAt
+	if got := w.Goodput(); got != 0 {
+		t.Fatalf("Goodput() = %v, want 0 for a zero-length lifetime", got)
+	}
+}
+
+func TestConnDeliveryRateMbps(t *testing.T) {
+	w := &Conn{
+		OpenedInfo:  &tcpinfo.Info{DeliveryRate: 1_000_000},
+		SampledInfo: &tcpinfo.Info{DeliveryRate: 12_500_000},
+	}
+	if got := w.DeliveryRateMbps(); got != 100 {
+		t.Fatalf("DeliveryRateMbps() = %v, want 100 from the latest sample", got)
+	}
+	if got := (&Conn{}).DeliveryRateMbps(); got != 0 {
+		t.Fatalf("DeliveryRateMbps() without tcpinfo = %v, want 0", got)
+	}
+}
+
+func TestConnECN(t *testing.T) {
+	w := &Conn{
+		OpenedInfo:  &tcpinfo.Info{},
+		SampledInfo: &tcpinfo.Info{TxOptions: []tcpinfo.Option{{Kind: "ECN"}, {Kind: "SACK"}}},
+	}
+	if got := w.ECN(); !got.Negotiated || got.ECTSeen {
+		t.Fatalf("ECN() = %+v, want Negotiated from the latest sample", got)
+	}
+	if got := (&Conn{}).ECN(); got != (tcpinfo.ECN{}) {
+		t.Fatalf("ECN() without tcpinfo = %+v, want the zero value", got)
+	}
+}
+
+func TestConnMarshalJSONIncludesDerivedStats(t *testing.T) {
+	opened := time.Unix(1700000000, 0)
+	w := &Conn{
+		counters: counters{
+			OpenedAt: opened.UnixNano(),
+			ClosedAt: opened.Add(time.Second).UnixNano(),
+			TxBytes:  42,
+		},
+		ClosedInfo: &tcpinfo.Info{DeliveryRate: 125_000},
+	}
+
+	raw, err := json.Marshal(w)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got["goodput"] != 42.0 || got["deliveryRateMbps"] != 1.0 || got["txBytes"] != 42.0 {
+		t.Fatalf("JSON = %s", raw)
+	}
+}
+
+func TestConnFirstByteAt(t *testing.T) {
+	fc := newFakeConn()
+	w := WrapConn(fc, nil, withInfoSource(func() (*tcpinfo.Info, error) { return nil, nil })).(*Conn)
+	defer w.Close()
+
+	buf := make([]byte, 8)
+	if _, err := w.Read(buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !w.FirstByteAt().IsZero() || w.TimeToFirstByte() != 0 {
+		t.Fatalf("FirstByteAt() = %v after an empty read, want the zero time", w.FirstByteAt())
+	}
+
+	fc.readData = []byte("x")
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() { _, _ = w.Read(make([]byte, 8)) })
+	}
+	wg.Wait()
+	first := w.FirstByteAt()
+	if first.IsZero() || first.UnixNano() != w.FirstRxAt {
+		t.Fatalf("FirstByteAt() = %v, want FirstRxAt %d", first, w.FirstRxAt)
+	}
+	if ttfb := w.TimeToFirstByte(); ttfb < 0 || ttfb != time.Duration(w.FirstRxAt-w.OpenedAt) {
+		t.Fatalf("TimeToFirstByte() = %v, want FirstRxAt - OpenedAt", ttfb)
+	}
+
+	_, _ = w.Read(buf)
+	if got := w.FirstByteAt(); !got.Equal(first) {
+		t.Fatalf("FirstByteAt() = %v after another read, want it unchanged at %v", got, first)
+	}
+	if _, ok := w.ToMap()["timeToFirstByte"]; !ok {
+		t.Fatal("ToMap() is missing timeToFirstByte")
+	}
+}
+
+func TestConnStalled(t *testing.T) {
+	w := &Conn{sampling: true, cfg: wrapOptions{stallTimeout: time.Second}}
+	start := time.Unix(1700000000, 0)
+	info := &tcpinfo.Info{TxBytes: 100, RxBytes: 50}
+
+	for _, step := range []struct {
+		after   time.Duration
+		change  func()
+		stalled bool
+	}{
+		{0, nil, false},
+		{500 * time.Millisecond, nil, false},
+		{time.Second, nil, true},
+		{1500 * time.Millisecond, func() { info.RxBytes++ }, false},
+		{2499 * time.Millisecond, nil, false},
+		{2500 * time.Millisecond, nil, true},
+		{3 * time.Second, func() { w.TxBytes++ }, false},
+	} {
+		if step.change != nil {
+			step.change()
+		}
+		w.recordSampleLocked(start.Add(step.after), info)
+		if got := w.Stalled(); got != step.stalled {
+			t.Fatalf("Stalled() at +%v = %v, want %v", step.after, got, step.stalled)
+		}
+	}
+
+	w.recordSampleLocked(start.Add(5*time.Second), info)
+	if _, ok := w.snapshotLocked().ToMap()["stalled"]; !ok {
+		t.Fatal("snapshot ToMap() is missing stalled")
+	}
+	if (&Conn{}).Stalled() {
+		t.Fatal("Stalled() without WithStallTimeout = true, want false")
+	}
+}
+
+func TestConnLatestInfoWhileSampling(t *testing.T) {
+	wrapped := WrapConn(newFakeConn(), nil,
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Millisecond),
+	).(*Conn)
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		var last time.Duration
+		for range 200 {
+			info := wrapped.LatestInfo()
+			if info == nil || info.RTT < last {
+				t.Errorf("LatestInfo() = %+v after an RTT of %v, want a newer sample", info, last)
+				return
+			}
+			last = info.RTT
+			if s := wrapped.Snapshot(); s.OpenedInfo == nil || s.SampledInfo != nil && s.SampledInfo.RTT < s.OpenedInfo.RTT {
+				t.Errorf("Snapshot() opened = %+v, sampled = %+v", s.OpenedInfo, s.SampledInfo)
+				return
+			}
+			time.Sleep(50 * time.Microsecond)
+		}
+	})
+	wg.Wait()
+
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	latest := wrapped.LatestInfo()
+	if latest == nil || latest.RTT != wrapped.Snapshot().ClosedInfo.RTT {
+		t.Fatalf("LatestInfo() after Close = %+v, want ClosedInfo", latest)
+	}
+}
+
+func TestConnMarshalJSONWhileSampling(t *testing.T) {
+	wrapped := WrapConn(newFakeConn(), nil,
+		withInfoSource(countingInfoSource()),
+		WithSampleInterval(time.Millisecond),
+	).(*Conn)
+	defer wrapped.Close()
+
+	// Run with -race: the sampler writes SampledInfo and the summary stats
+	// while MarshalJSON reads them.
+	for range 100 {
+		b, err := json.Marshal(wrapped)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var got struct {
+			OpenedInfo *tcpinfo.Info `json:"openedInfo"`
+		}
+		if err := json.Unmarshal(b, &got); err != nil || got.OpenedInfo == nil {
+			t.Fatalf("Marshal = %s, %v; want openedInfo", b, err)
+		}
+		time.Sleep(50 * time.Microsecond)
+	}
+}
@@ -0,0 +1,91 @@
+package conniver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+)
+
+// enableTimestamping is the sockOpt installed by WithTimestamping. On success it
+// remembers the TCP connection so Read and Write can collect timestamps.
+func (w *Conn) enableTimestamping(tc *net.TCPConn) error {
+	if err := controlFD(tc, tcpinfo.EnableTimestamping); err != nil {
+		return err
+	}
+	w.tsConn = tc
+	return nil
+}
+
+// readTimestamped reads from the timestamping TCP connection with recvmsg so
+// the kernel receive timestamp of the data is not discarded, as it is by a
+// plain read. It honors read deadlines like net.TCPConn.Read.
+func readTimestamped(tc *net.TCPConn, p []byte) (int, time.Time, error) {
+	if len(p) == 0 {
+		n, err := tc.Read(p)
+		return n, time.Time{}, err
+	}
+	rawConn, err := tc.SyscallConn()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var n int
+	var ts time.Time
+	var recvErr error
+	if err := rawConn.Read(func(fd uintptr) bool {
+		n, ts, recvErr = tcpinfo.RecvTimestamped(fd, p)
+		return !errors.Is(recvErr, syscall.EAGAIN)
+	}); err != nil {
+		return 0, time.Time{}, err
+	}
+	if recvErr != nil {
+		return 0, time.Time{}, &net.OpError{Op: "read", Net: "tcp", Source: tc.LocalAddr(), Addr: tc.RemoteAddr(), Err: os.NewSyscallError("recvmsg", recvErr)}
+	}
+	if n == 0 {
+		return 0, ts, io.EOF
+	}
+	return n, ts, nil
+}
+
+// txTimestamp is a kernel transmit timestamp and the OPT_ID key of the write
+// it belongs to.
+type txTimestamp struct {
+	at  time.Time
+	key uint32
+}
+
+// drainTxTimestamps collects the transmit timestamps the kernel has queued
+// since the last call and returns the one for the newest write, or a zero
+// txTimestamp if there are none.
+func drainTxTimestamps(tc *net.TCPConn) txTimestamp {
+	var latest txTimestamp
+	_ = controlFD(tc, func(fd uintptr) error {
+		at, key, ok, err := tcpinfo.ReadTxTimestamps(fd)
+		if ok {
+			latest = txTimestamp{at: at, key: key}
+		}
+		return err
+	})
+	return latest
+}
+
+// recordTxTimestampLocked stores ts as LastTxTimestamp unless it is unset or
+// belongs to an older write than the one already stored. Its key is the
+// offset of the write's last byte modulo 2^32, so it is unwrapped relative to
+// LastTxTimestampEnd.
+func (w *Conn) recordTxTimestampLocked(ts txTimestamp) {
+	if ts.at.IsZero() {
+		return
+	}
+	end := w.LastTxTimestampEnd + int64(int32(ts.key+1-uint32(w.LastTxTimestampEnd)))
+	if w.LastTxTimestamp != 0 && end <= w.LastTxTimestampEnd {
+		return
+	}
+	w.LastTxTimestamp = ts.at.UnixNano()
+	w.LastTxTimestampEnd = end
+}
@@ -0,0 +1,56 @@
+package conniver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// tlsStater is implemented by *tls.Conn and other TLS layers that report
+// their handshake state.
+type tlsStater interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// trackTLSHandshake starts TLS handshake timing when conn carries a TLS layer
+// whose handshake has not run yet. The wrap time is taken as the TCP connect
+// time, and the handshake is timed by the first Read or Write through the
+// wrapper, since the TLS layer runs its handshake before that I/O completes.
+// For a server-speaks-first protocol the first Read also includes the wait for
+// the peer's first record. A TLS layer that finished its handshake before it
+// was wrapped cannot be timed and is left alone.
+func (w *Conn) trackTLSHandshake(conn net.Conn) {
+	ts, ok := unwrapConn[tlsStater](conn)
+	if !ok || ts.ConnectionState().HandshakeComplete {
+		return
+	}
+	w.TCPConnectedAt = w.OpenedAt
+	w.tlsPending = true
+}
+
+func (w *Conn) finishTLSHandshakeLocked() {
+	w.TLSHandshakeAt = time.Now().UnixNano()
+	w.tlsPending = false
+}
+
+// HandshakeTLS runs a TLS client handshake over the wrapped connection and
+// returns the resulting *tls.Conn, which the caller then uses in place of w.
+// It records TCPConnectedAt as the wrap time and, on success, TLSHandshakeAt
+// as the moment the handshake completed, so the report can split time to first
+// byte into the TCP and TLS handshakes. It suits http.Transport's
+// DialTLSContext, where the transport would otherwise add TLS on top of the
+// wrapper without it knowing. Bytes counted by the wrapper include the TLS
+// record overhead. If the handshake fails, the caller should close w.
+func (w *Conn) HandshakeTLS(ctx context.Context, config *tls.Config) (*tls.Conn, error) {
+	tlsConn := tls.Client(w, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	w.Lock()
+	w.TCPConnectedAt = w.OpenedAt
+	w.TLSHandshakeAt = time.Now().UnixNano()
+	w.Unlock()
+	return tlsConn, nil
+}
@@ -2,70 +2,105 @@ package conniver
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/runZeroInc/conniver/pkg/tcpinfo"
 )
 
 const (
-	Opened = 0
-	Closed = 1
+	Opened  = 0
+	Closed  = 1
+	Sampled = 2 // Fired on each periodic sample; requires WithSampleInterval or WithByteInterval
 )
 
 var StateMap = map[int]string{
-	Opened: "open",
-	Closed: "close",
+	Opened:  "open",
+	Closed:  "close",
+	Sampled: "sample",
 }
 
+// ReportStatsFn is the report callback passed to WrapConn. It also satisfies
+// Observer.
 type ReportStatsFn func(tic *Conn, state int)
 
-// WrapOption configures optional behavior on a wrapped Conn. Options are
-// applied in order, so later options override earlier ones.
-type WrapOption func(*wrapOptions)
-
-type wrapOptions struct {
-	emitOpenCallback bool
-}
-
-// WithEmitOpenCallback enables firing the report callback in the Opened state
-// immediately after WrapConn collects open-time tcpinfo. The default is to
-// only fire the callback in the Closed state and expose the open-time stats
-// via OpenedInfo on the close snapshot; enable this option only if you need a
-// separate notification at connect time.
-func WithEmitOpenCallback(enabled bool) WrapOption {
-	return func(o *wrapOptions) { o.emitOpenCallback = enabled }
-}
-
+// Conn wraps a net.Conn and records its transfer stats and tcpinfo snapshots.
+// The exported fields, including the byte counters and timestamps it shares
+// with Counter, are written under the embedded mutex while the connection is
+// in use, by I/O, the sampler, and Close, so read them from a live wrapper
+// through Snapshot or LatestInfo; the snapshots passed to the report callback
+// and observers are detached copies that can be read freely.
 type Conn struct {
 	net.Conn `json:"-"`
 	Context  context.Context `json:"-"`
 
-	reportStats     func(*Conn, int) `json:"-"`
-	OpenedAt        int64            `json:"openedAt,omitempty"`
-	ClosedAt        int64            `json:"closedAt,omitempty"`
-	FirstRxAt       int64            `json:"firstRxAt,omitempty"`
-	FirstTxAt       int64            `json:"firstTxAt,omitempty"`
-	LastRxAt        int64            `json:"lastRxAt,omitempty"`
-	LastTxAt        int64            `json:"lastTxAt,omitempty"`
-	TxBytes         int64            `json:"txBytes"`
-	RxBytes         int64            `json:"rxBytes"`
-	RxErr           error            `json:"rxErr,omitempty"`
-	TxErr           error            `json:"txErr,omitempty"`
-	InfoErr         error            `json:"infoErr,omitempty"`
-	Reconnects      int              `json:"reconnects,omitempty"`
-	OpenedInfo      *tcpinfo.Info    `json:"openedInfo,omitempty"`
-	ClosedInfo      *tcpinfo.Info    `json:"closedInfo,omitempty"`
-	supportsTCPInfo bool
-	closeStarted    bool
-	closeDone       chan struct{}
-	closeErr        error
-	inFlight        int
-	localAddr       net.Addr
-	remoteAddr      net.Addr
-	ioDrained       *sync.Cond
+	counters
+	reportStats        func(*Conn, int) `json:"-"`
+	InfoErr            error            `json:"infoErr,omitempty"`
+	SockOptErr         error            `json:"sockOptErr,omitempty"`
+	ReportErr          error            `json:"reportErr,omitempty"` // First error returned by a ReportStatsErrFn
+	Reconnects         int              `json:"reconnects,omitempty"`
+	FD                 uintptr          `json:"fd,omitempty"`                 // Socket descriptor (handle on Windows) at wrap time; the number may be reused after Close
+	Inode              uint64           `json:"inode,omitempty"`              // Socket inode as listed in /proc/net/tcp [Linux only]
+	LastTxTimestamp    int64            `json:"lastTxTimestamp,omitempty"`    // Kernel timestamp of the latest transmitted write in unix nanoseconds; requires WithTimestamping
+	LastTxTimestampEnd int64            `json:"lastTxTimestampEnd,omitempty"` // Socket bytes sent through the end of the write LastTxTimestamp belongs to; on a plain TCP conn, TxBytes once the latest write is stamped
+	LastRxTimestamp    int64            `json:"lastRxTimestamp,omitempty"`    // Kernel timestamp of the latest received data in unix nanoseconds; requires WithTimestamping
+	TCPConnectedAt     int64            `json:"tcpConnectedAt,omitempty"`     // TCP connect completion in unix nanoseconds; set when a TLS handshake is tracked
+	TLSHandshakeAt     int64            `json:"tlsHandshakeAt,omitempty"`     // TLS handshake completion in unix nanoseconds; see HandshakeTLS
+	DialDuration       time.Duration    `json:"dialDuration,omitempty"`       // Time spent dialing, including name resolution; set by DialAndWrap
+	LogicalRemoteAddr  string           `json:"logicalRemoteAddr,omitempty"`  // Target reached through a proxy; set by WithLogicalRemote
+	OpenedInfo         *tcpinfo.Info    `json:"openedInfo,omitempty"`
+	ClosedInfo         *tcpinfo.Info    `json:"closedInfo,omitempty"`
+	ClosedInfoFallback bool             `json:"closedInfoFallback,omitempty"` // ClosedInfo is a copy of the latest earlier snapshot because no close-time read succeeded
+	SampledInfo        *tcpinfo.Info    `json:"sampledInfo,omitempty"`        // Most recent periodic sample; requires WithSampleInterval or WithByteInterval
+	SampledAge         time.Duration    `json:"sampledAge,omitempty"`         // Time since OpenedAt when SampledInfo was read
+	PeakRTT            time.Duration    `json:"peakRTT,omitempty"`            // Highest sampled RTT; requires WithSampleInterval or WithByteInterval
+	MinObservedRTT     time.Duration    `json:"minObservedRTT,omitempty"`     // Lowest non-zero sampled RTT; requires WithSampleInterval or WithByteInterval
+	PeakRetransRate    float64          `json:"peakRetransRate,omitempty"`    // Highest retransmits per second between samples; requires WithSampleInterval or WithByteInterval
+	supportsTCPInfo    bool
+	infoDenied         bool // A tcpinfo read failed with tcpinfo.ErrPermission
+	closeStarted       bool
+	closeDone          chan struct{}
+	closeErr           error
+	closing            chan struct{}  // Closed when Close starts; created on demand by Samples
+	samplers           sync.WaitGroup // Goroutines started by Samples, waited for by Close
+	inFlight           int
+	infoSource         func() (*tcpinfo.Info, error)
+	logger             *slog.Logger
+	sampleStop         chan struct{}
+	sampleDone         chan struct{}
+	sampleKick         chan struct{}
+	sampleEntry        *scheduledSample // Place on the WithSampleScheduler scheduler, if any
+	byteInterval       int64
+	nextSampleBytes    int64
+	rttHistory         *rttRing
+	sampling           bool
+	lastSampleAt       time.Time
+	lastRetransmits    uint64
+	lossFn             LossFn
+	tsConn             *net.TCPConn // Set when WithTimestamping enabled SO_TIMESTAMPING
+	tlsPending         bool
+	lastCAState        tcpinfo.CAState
+	flowControl        FlowControlState
+	limitedSampled     bool
+	lastRwndLimited    time.Duration
+	lastSndbufLimited  time.Duration
+	stalled            bool
+	rtoStorm           bool
+	lastActivityAt     time.Time
+	activityBytes      uint64
+	localAddr          net.Addr
+	remoteAddr         net.Addr
+	ioDrained          *sync.Cond
+	reportStatsFn      ReportStatsFn
+	cfg                wrapOptions // Options from construction, reapplied by Reset
 	sync.Mutex
 }
 
@@ -75,6 +110,11 @@ type Conn struct {
 // stored on the wrapper (OpenedInfo) so it is available to the Close-time
 // callback.
 //
+// WrapConn works on every platform. Only the tcpinfo snapshots depend on
+// tcpinfo.Supported: where it is false, or the connection is not TCP, the
+// byte counters, timestamps, and reports work as usual with OpenedInfo and
+// ClosedInfo left nil.
+//
 // As of v0.0.10 the Open-state callback is not fired by default. Callers that
 // want a notification at connect time can opt back in by passing
 // WithEmitOpenCallback(true); otherwise consumers should read OpenedInfo off
@@ -84,34 +124,77 @@ func WrapConn(ncon net.Conn, reportStatsFn ReportStatsFn, opts ...WrapOption) ne
 	return WrapConnWithContext(context.Background(), ncon, reportStatsFn, opts...)
 }
 
+// WrapExistingConn wraps a connection that has already been in use, such as
+// one handed out by a connection pool, taking openedAt rather than the wrap
+// time as OpenedAt. Lifetime stats such as Goodput and the report's
+// ClosedAt-OpenedAt duration are relative to openedAt, while the byte counters
+// and First/Last I/O times only cover traffic through the wrapper, and
+// OpenedInfo is the tcpinfo read at wrap time rather than at connect. A zero
+// openedAt behaves like WrapConn.
+func WrapExistingConn(ncon net.Conn, openedAt time.Time, reportStatsFn ReportStatsFn, opts ...WrapOption) net.Conn {
+	if !openedAt.IsZero() {
+		opts = append(opts[:len(opts):len(opts)], withOpenedAt(openedAt))
+	}
+	return WrapConn(ncon, reportStatsFn, opts...)
+}
+
 // WrapConnWithContext is the context-aware variant of WrapConn. See WrapConn
 // for the callback contract and the available WrapOption values.
 func WrapConnWithContext(ctx context.Context, ncon net.Conn, reportStatsFn ReportStatsFn, opts ...WrapOption) net.Conn {
-	cfg := wrapOptions{}
-	for _, o := range opts {
-		if o != nil {
-			o(&cfg)
-		}
-	}
+	cfg := newWrapOptions(opts)
 
+	openedAt := cfg.openedAt
+	if openedAt.IsZero() {
+		openedAt = time.Now()
+	}
 	w := &Conn{
-		Conn:            ncon,
-		reportStats:     reportStatsFn,
-		OpenedAt:        time.Now().UnixNano(),
 		supportsTCPInfo: tcpinfo.Supported(),
 		Context:         ctx,
+		infoSource:      cfg.infoSource,
+		logger:          cfg.logger,
+		lossFn:          cfg.lossFn,
+		reportStatsFn:   reportStatsFn,
+		cfg:             cfg,
+	}
+	if cfg.withoutTCPInfo {
+		w.supportsTCPInfo, w.infoSource = false, nil
 	}
+	w.ioDrained = sync.NewCond(&w.Mutex)
+	w.bind(ncon, openedAt, cfg.dialDuration)
+	return w
+}
+
+// bind attaches ncon to the wrapper and does the open-time work: socket
+// identity, socket options, OpenedInfo, the Opened callback, and the sampler.
+// The wrapper must not be in use by other goroutines yet.
+func (w *Conn) bind(ncon net.Conn, openedAt time.Time, dialDuration time.Duration) {
+	cfg := w.cfg
+	w.Conn = ncon
+	w.OpenedAt = openedAt.UnixNano()
+	w.DialDuration = dialDuration
+	w.LogicalRemoteAddr = cfg.logicalRemote
+	w.rttHistory = newRTTRing(cfg.rttHistorySize)
 	if ncon != nil {
 		w.localAddr = ncon.LocalAddr()
 		w.remoteAddr = ncon.RemoteAddr()
+		if !cfg.mappedAddrs {
+			w.localAddr, w.remoteAddr = unmapAddr(w.localAddr), unmapAddr(w.remoteAddr)
+		}
 	}
-	w.ioDrained = sync.NewCond(&w.Mutex)
+	w.trackTLSHandshake(ncon)
+	w.FD, w.Inode = socketIdentity(ncon)
+	w.reportStats = fanOut(w.reportStatsFn, w.errReporters(cfg.reportErrFns, cfg.observers))
+	sockOpts := cfg.sockOpts
+	if cfg.timestamping {
+		sockOpts = append(sockOpts[:len(sockOpts):len(sockOpts)], w.enableTimestamping)
+	}
+	w.applySockOpts(sockOpts)
 
 	// Collect open-time tcpinfo and store it on the wrapper. The Close-time
 	// callback always receives a snapshot that includes OpenedInfo; the
 	// Open-state callback is only fired when explicitly requested via
 	// WithEmitOpenCallback.
-	openedInfo, openedInfoErr := w.collectTCPInfo()
+	openedInfo, openedInfoErr := w.readTCPInfo()
 	if cfg.emitOpenCallback {
 		w.reportState(Opened, openedInfo, openedInfoErr)
 	} else {
@@ -119,7 +202,191 @@ func WrapConnWithContext(ctx context.Context, ncon net.Conn, reportStatsFn Repor
 		w.applyTCPInfoLocked(Opened, openedInfo, openedInfoErr)
 		w.Unlock()
 	}
-	return w
+	w.startSampler(cfg.sampleInterval, cfg.byteInterval, openedInfo)
+}
+
+// Reset rebinds a closed wrapper to newConn so it can be reused, for example
+// from a sync.Pool, instead of allocating a new Conn for every connection. It
+// keeps the report callback, context, and options the wrapper was created
+// with, zeroes every lifetime field (counters, timestamps, errors, tcpinfo
+// snapshots, peaks, RTT history, and Reconnects), and then does the open-time
+// work again, with OpenedAt set to now. DialDuration is left zero.
+//
+// Reset returns an error, and leaves the wrapper untouched, unless Close has
+// returned and the sampler has exited. Snapshots delivered to callbacks are
+// copies, so they stay valid across Reset, but Reset must not race with any
+// other use of w, and a wrapper whose context is done stops sampling again
+// right away.
+func (w *Conn) Reset(newConn net.Conn) error {
+	w.Lock()
+	if !w.closedLocked() {
+		w.Unlock()
+		return errors.New("conniver: Reset requires a closed connection")
+	}
+	if done := w.sampleDone; done != nil {
+		select {
+		case <-done:
+		default:
+			w.Unlock()
+			return errors.New("conniver: Reset requires a stopped sampler")
+		}
+	}
+
+	w.ClosedAt = 0
+	w.FirstRxAt, w.FirstTxAt, w.LastRxAt, w.LastTxAt = 0, 0, 0, 0
+	w.TxBytes, w.RxBytes = 0, 0
+	w.RxErr, w.TxErr, w.InfoErr, w.SockOptErr, w.ReportErr = nil, nil, nil, nil, nil
+	w.Reconnects = 0
+	w.FD, w.Inode = 0, 0
+	w.LastTxTimestamp, w.LastTxTimestampEnd, w.LastRxTimestamp = 0, 0, 0
+	w.TCPConnectedAt, w.TLSHandshakeAt = 0, 0
+	w.OpenedInfo, w.ClosedInfo, w.SampledInfo = nil, nil, nil
+	w.SampledAge = 0
+	w.ClosedInfoFallback = false
+	w.PeakRTT, w.MinObservedRTT, w.PeakRetransRate = 0, 0, 0
+	w.closeStarted, w.closeDone, w.closeErr = false, nil, nil
+	w.infoDenied = false
+	w.closing = nil
+	w.sampleStop, w.sampleDone, w.sampleKick, w.sampleEntry = nil, nil, nil, nil
+	w.byteInterval, w.nextSampleBytes = 0, 0
+	w.sampling = false
+	w.lastSampleAt = time.Time{}
+	w.lastRetransmits = 0
+	w.lastCAState = 0
+	w.flowControl, w.limitedSampled = FlowControlUnknown, false
+	w.lastRwndLimited, w.lastSndbufLimited = 0, 0
+	w.stalled, w.lastActivityAt, w.activityBytes = false, time.Time{}, 0
+	w.rtoStorm = false
+	w.tsConn = nil
+	w.tlsPending = false
+	w.localAddr, w.remoteAddr = nil, nil
+	w.Unlock()
+
+	w.bind(newConn, time.Now(), 0)
+	return nil
+}
+
+// closedLocked reports whether Close has run to completion.
+func (w *Conn) closedLocked() bool {
+	if w.closeDone == nil {
+		return false
+	}
+	select {
+	case <-w.closeDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// applySockOpts applies the socket options requested at wrap time. Failures do
+// not prevent wrapping; they are joined and recorded in SockOptErr.
+func (w *Conn) applySockOpts(opts []sockOpt) {
+	if len(opts) == 0 {
+		return
+	}
+
+	w.SockOptErr = runSockOpts(w.Conn, opts)
+	if w.SockOptErr != nil && w.logger != nil {
+		w.logger.Warn("conniver: could not apply socket options", "remoteAddr", addrString(w.remoteAddr, "unknown"), "error", w.SockOptErr)
+	}
+}
+
+func runSockOpts(conn net.Conn, opts []sockOpt) error {
+	tcpConn, ok := unwrapConn[*net.TCPConn](conn)
+	if !ok {
+		return fmt.Errorf("%w: socket options require a TCP connection, got %T", tcpinfo.ErrUnsupported, conn)
+	}
+
+	var errs []error
+	for _, opt := range opts {
+		if err := opt(tcpConn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// socketIdentity returns the descriptor of the socket beneath conn, without
+// duplicating it, and on Linux its inode. Both are zero when conn has no
+// socket, such as a net.Pipe.
+func socketIdentity(conn net.Conn) (fd uintptr, inode uint64) {
+	sc, ok := unwrapConn[syscall.Conn](conn)
+	if !ok {
+		return 0, 0
+	}
+	rawConn, err := sc.SyscallConn()
+	if err != nil {
+		return 0, 0
+	}
+	_ = rawConn.Control(func(sysfd uintptr) {
+		fd = sysfd
+		inode, _ = tcpinfo.SocketInode(sysfd)
+	})
+	return fd, inode
+}
+
+// maxUnwrapDepth bounds how many NetConn layers unwrapConn peels off, in case a
+// wrapper returns itself.
+const maxUnwrapDepth = 8
+
+// unwrapConn returns the outermost layer of conn that is a T, unwrapping layers
+// that expose the connection beneath them through a NetConn method, such as
+// *tls.Conn.
+func unwrapConn[T any](conn net.Conn) (T, bool) {
+	for range maxUnwrapDepth {
+		if c, ok := conn.(T); ok {
+			return c, true
+		}
+		nc, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = nc.NetConn()
+	}
+	var zero T
+	return zero, false
+}
+
+// permissionLogged makes the warning about tcpinfo being denied print once
+// per process, since a sandbox that denies it does so for every connection.
+var permissionLogged atomic.Bool
+
+// readTCPInfo returns the current tcpinfo for the connection from the
+// configured source. Once a read fails with tcpinfo.ErrPermission, as under a
+// seccomp filter, the wrapper stops reading and only counts bytes; InfoErr
+// keeps that first error.
+func (w *Conn) readTCPInfo() (*tcpinfo.Info, error) {
+	w.Lock()
+	denied := w.infoDenied
+	w.Unlock()
+	if denied {
+		return nil, nil
+	}
+
+	var info *tcpinfo.Info
+	var err error
+	if w.infoSource != nil {
+		info, err = w.infoSource()
+	} else {
+		info, err = w.collectTCPInfo()
+	}
+	if errors.Is(err, tcpinfo.ErrPermission) {
+		w.Lock()
+		w.infoDenied = true
+		w.Unlock()
+		if w.logger != nil && permissionLogged.CompareAndSwap(false, true) {
+			w.logger.Warn("conniver: tcpinfo access denied; counting bytes only", "remoteAddr", w.RemoteAddrString(), "error", err)
+		}
+	}
+	return info, err
+}
+
+// readsTCPInfo reports whether readTCPInfo can return anything: the platform
+// has tcpinfo and WithoutTCPInfo is not set, or a test source stands in for it.
+// Both are fixed when the connection is bound.
+func (w *Conn) readsTCPInfo() bool {
+	return w.supportsTCPInfo || w.infoSource != nil
 }
 
 func (w *Conn) collectTCPInfo() (*tcpinfo.Info, error) {
@@ -131,7 +398,7 @@ func (w *Conn) collectTCPInfo() (*tcpinfo.Info, error) {
 	conn := w.Conn
 	w.Unlock()
 
-	tcpConn, ok := conn.(*net.TCPConn)
+	tcpConn, ok := unwrapConn[*net.TCPConn](conn)
 	if !ok {
 		return nil, nil
 	}
@@ -141,18 +408,7 @@ func (w *Conn) collectTCPInfo() (*tcpinfo.Info, error) {
 		return nil, err
 	}
 
-	var sysInfo *tcpinfo.SysInfo
-	var infoErr error
-	err = rawConn.Control(func(fd uintptr) {
-		sysInfo, infoErr = tcpinfo.GetTCPInfo(fd)
-	})
-	if err != nil {
-		return nil, err
-	}
-	if sysInfo == nil {
-		return nil, infoErr
-	}
-	return sysInfo.ToInfo(), infoErr
+	return tcpinfo.GetTCPInfoConn(rawConn)
 }
 
 func (w *Conn) applyTCPInfoLocked(state int, info *tcpinfo.Info, infoErr error) {
@@ -168,6 +424,22 @@ func (w *Conn) applyTCPInfoLocked(state int, info *tcpinfo.Info, infoErr error)
 	}
 }
 
+// fallBackClosedInfoLocked sets ClosedInfo to a copy of the most recent earlier
+// snapshot, the last periodic sample or else OpenedInfo, when the close-time
+// read failed or was skipped, as happens when the socket is already being torn
+// down. InfoErr keeps the error from the failed read.
+func (w *Conn) fallBackClosedInfoLocked() {
+	latest := w.SampledInfo
+	if latest == nil {
+		latest = w.OpenedInfo
+	}
+	if latest == nil {
+		return
+	}
+	w.ClosedInfo = latest.Clone()
+	w.ClosedInfoFallback = true
+}
+
 // reportState applies fresh tcpinfo and fires the report callback for the
 // given lifecycle state. It is used by the opt-in Open-state callback path
 // (see WithEmitOpenCallback) and is structured so additional lifecycle states
@@ -212,26 +484,39 @@ func (w *Conn) remoteAddrLocked() net.Addr {
 
 func (w *Conn) snapshotLocked() *Conn {
 	return &Conn{
-		Context:         w.Context,
-		OpenedAt:        w.OpenedAt,
-		ClosedAt:        w.ClosedAt,
-		FirstRxAt:       w.FirstRxAt,
-		FirstTxAt:       w.FirstTxAt,
-		LastRxAt:        w.LastRxAt,
-		LastTxAt:        w.LastTxAt,
-		TxBytes:         w.TxBytes,
-		RxBytes:         w.RxBytes,
-		RxErr:           w.RxErr,
-		TxErr:           w.TxErr,
-		InfoErr:         w.InfoErr,
-		Reconnects:      w.Reconnects,
-		OpenedInfo:      w.OpenedInfo.Clone(),
-		ClosedInfo:      w.ClosedInfo.Clone(),
-		supportsTCPInfo: w.supportsTCPInfo,
-		closeStarted:    w.closeStarted,
-		closeErr:        w.closeErr,
-		localAddr:       w.localAddrLocked(),
-		remoteAddr:      w.remoteAddrLocked(),
+		Context:            w.Context,
+		counters:           w.counters,
+		InfoErr:            w.InfoErr,
+		SockOptErr:         w.SockOptErr,
+		ReportErr:          w.ReportErr,
+		Reconnects:         w.Reconnects,
+		FD:                 w.FD,
+		Inode:              w.Inode,
+		LastTxTimestamp:    w.LastTxTimestamp,
+		LastTxTimestampEnd: w.LastTxTimestampEnd,
+		LastRxTimestamp:    w.LastRxTimestamp,
+		TCPConnectedAt:     w.TCPConnectedAt,
+		TLSHandshakeAt:     w.TLSHandshakeAt,
+		DialDuration:       w.DialDuration,
+		LogicalRemoteAddr:  w.LogicalRemoteAddr,
+		OpenedInfo:         w.OpenedInfo.Clone(),
+		ClosedInfo:         w.ClosedInfo.Clone(),
+		ClosedInfoFallback: w.ClosedInfoFallback,
+		SampledInfo:        w.SampledInfo.Clone(),
+		SampledAge:         w.SampledAge,
+		PeakRTT:            w.PeakRTT,
+		MinObservedRTT:     w.MinObservedRTT,
+		PeakRetransRate:    w.PeakRetransRate,
+		supportsTCPInfo:    w.supportsTCPInfo,
+		closeStarted:       w.closeStarted,
+		closeErr:           w.closeErr,
+		rttHistory:         w.rttHistory.clone(),
+		sampling:           w.sampling,
+		flowControl:        w.flowControl,
+		stalled:            w.stalled,
+		rtoStorm:           w.rtoStorm,
+		localAddr:          w.localAddrLocked(),
+		remoteAddr:         w.remoteAddrLocked(),
 	}
 }
 
@@ -288,7 +573,19 @@ func (w *Conn) SetReconnects(reconnects int) {
 
 // Close closes the underlying connection once, waits for in-flight wrapper I/O
 // to finish updating stats, and invokes the callback with a detached snapshot.
-func (w *Conn) Close() (err error) {
+// It is safe to call more than once and from several goroutines: later and
+// concurrent calls wait for the first to finish and return its error, and the
+// sampler teardown and Closed report happen only on the first. Close waits for
+// a sample in progress, so a Sampled report must not call it on its own
+// connection.
+func (w *Conn) Close() error {
+	return w.finish(true, true)
+}
+
+// finish runs Close. closeConn is false when the underlying connection belongs
+// to someone else, such as a hijacking HTTP handler, or is already closed, and
+// readInfo is false when the socket is already gone.
+func (w *Conn) finish(closeConn, readInfo bool) (err error) {
 	w.Lock()
 	if w.closeDone != nil {
 		done := w.closeDone
@@ -309,18 +606,35 @@ func (w *Conn) Close() (err error) {
 
 	w.closeStarted = true
 	w.ClosedAt = time.Now().UnixNano()
+	if w.closing != nil {
+		close(w.closing)
+	}
 	done := make(chan struct{})
 	w.closeDone = done
 	conn := w.Conn
+	samplerDone := w.stopSamplerLocked()
 	w.Unlock()
 
 	defer close(done)
 
-	closedInfo, closedInfoErr := w.collectTCPInfo()
-	if conn != nil {
-		err = conn.Close()
-	} else {
+	if samplerDone != nil {
+		<-samplerDone
+	}
+	w.samplers.Wait()
+	var closedInfo *tcpinfo.Info
+	var closedInfoErr error
+	var txStamp txTimestamp
+	if readInfo {
+		closedInfo, closedInfoErr = w.readTCPInfo()
+		if w.tsConn != nil {
+			txStamp = drainTxTimestamps(w.tsConn)
+		}
+	}
+	switch {
+	case conn == nil:
 		err = net.ErrClosed
+	case closeConn:
+		err = conn.Close()
 	}
 
 	w.Lock()
@@ -330,6 +644,13 @@ func (w *Conn) Close() (err error) {
 		w.ioDrained.Wait()
 	}
 	w.applyTCPInfoLocked(Closed, closedInfo, closedInfoErr)
+	if closedInfo == nil {
+		w.fallBackClosedInfoLocked()
+	}
+	w.recordTxTimestampLocked(txStamp)
+	if w.sampling {
+		w.recordSampleLocked(time.Now(), closedInfo)
+	}
 	reportStats := w.reportStats
 	snapshot := w.snapshotLocked()
 	w.Unlock()
@@ -348,21 +669,22 @@ func (w *Conn) Read(b []byte) (int, error) {
 		return 0, err
 	}
 
-	n, err := conn.Read(b)
+	var n int
+	var rxTimestamp time.Time
+	if w.tsConn != nil && conn == net.Conn(w.tsConn) {
+		n, rxTimestamp, err = readTimestamped(w.tsConn, b)
+	} else {
+		n, err = conn.Read(b)
+	}
 	w.Lock()
-	if err == nil && n > 0 {
-		ts := time.Now().UnixNano()
-		if w.FirstRxAt == 0 {
-			w.FirstRxAt = ts
-			w.LastRxAt = ts
-		} else {
-			w.LastRxAt = ts
-		}
+	if !rxTimestamp.IsZero() {
+		w.LastRxTimestamp = rxTimestamp.UnixNano()
 	}
-	w.RxBytes += int64(n)
-	if err, ok := err.(net.Error); ok && !err.Timeout() {
-		w.RxErr = err
+	w.recordRxLocked(n, err)
+	if w.tlsPending && n > 0 {
+		w.finishTLSHandshakeLocked()
 	}
+	w.kickByteSamplerLocked()
 	w.Unlock()
 	w.finishIO()
 	return n, err
@@ -376,20 +698,17 @@ func (w *Conn) Write(b []byte) (int, error) {
 	}
 
 	n, err := conn.Write(b)
-	w.Lock()
-	if err == nil && n > 0 {
-		ts := time.Now().UnixNano()
-		if w.FirstTxAt == 0 {
-			w.FirstTxAt = ts
-			w.LastTxAt = ts
-		} else {
-			w.LastTxAt = ts
-		}
+	var txStamp txTimestamp
+	if w.tsConn != nil {
+		txStamp = drainTxTimestamps(w.tsConn)
 	}
-	w.TxBytes += int64(n)
-	if err, ok := err.(net.Error); ok && !err.Timeout() {
-		w.TxErr = err
+	w.Lock()
+	w.recordTxTimestampLocked(txStamp)
+	w.recordTxLocked(n, err)
+	if w.tlsPending && n > 0 {
+		w.finishTLSHandshakeLocked()
 	}
+	w.kickByteSamplerLocked()
 	w.Unlock()
 	w.finishIO()
 	return n, err
@@ -419,18 +738,25 @@ func (w *Conn) RemoteAddrString() string {
 	return addrString(w.remoteAddrLocked(), "unknown")
 }
 
+// SetDeadline sets the read and write deadlines on the wrapped connection. A
+// Read or Write that times out returns the underlying timeout error and is not
+// recorded in RxErr or TxErr. After Close it returns net.ErrClosed.
 func (w *Conn) SetDeadline(t time.Time) error {
 	return w.withLiveConn(func(conn net.Conn) error {
 		return conn.SetDeadline(t)
 	})
 }
 
+// SetReadDeadline sets the read deadline on the wrapped connection; see
+// SetDeadline.
 func (w *Conn) SetReadDeadline(t time.Time) error {
 	return w.withLiveConn(func(conn net.Conn) error {
 		return conn.SetReadDeadline(t)
 	})
 }
 
+// SetWriteDeadline sets the write deadline on the wrapped connection; see
+// SetDeadline.
 func (w *Conn) SetWriteDeadline(t time.Time) error {
 	return w.withLiveConn(func(conn net.Conn) error {
 		return conn.SetWriteDeadline(t)
@@ -443,6 +769,20 @@ func (w *Conn) Warnings() []string {
 	return w.warnings()
 }
 
+// unmapAddr returns addr with an IPv4-mapped IPv6 address replaced by the
+// plain IPv4 address. Other addresses are returned as they are.
+func unmapAddr(addr net.Addr) net.Addr {
+	a, ok := addr.(*net.TCPAddr)
+	if !ok || len(a.IP) != net.IPv6len {
+		return addr
+	}
+	ip4 := a.IP.To4()
+	if ip4 == nil {
+		return addr
+	}
+	return &net.TCPAddr{IP: ip4, Port: a.Port, Zone: a.Zone}
+}
+
 func addrString(addr net.Addr, fallback string) string {
 	if addr == nil {
 		return fallback
@@ -462,8 +802,16 @@ func (w *Conn) warnings() []string {
 		if info.Retransmits > 0 {
 			warns = append(warns, "retransmits="+strconv.FormatInt(int64(info.Retransmits), 10))
 		}
-		if info.Sys != nil {
-			warns = append(warns, info.Sys.Warnings()...)
+		if info.Sys == nil {
+			continue
+		}
+		for _, warn := range info.Sys.Warnings() {
+			// Nothing has been sent at open time, so the connection is always
+			// app-limited then; only the ending sample is meaningful.
+			if info == w.OpenedInfo && warn == tcpinfo.WarnAppLimited {
+				continue
+			}
+			warns = append(warns, warn)
 		}
 	}
 	return warns
@@ -488,6 +836,52 @@ func (w *Conn) ToMap() map[string]any {
 		"remoteAddr": addrString(remoteAddr, ""),
 		"warnings":   w.warnings(),
 	}
+	fset["goodput"] = w.goodputLocked()
+	fset["deliveryRateMbps"] = w.deliveryRateMbpsLocked()
+	fset["appLimited"] = w.wasAppLimitedLocked()
+	if w.sampling {
+		fset["peakRTT"] = w.PeakRTT
+		fset["minObservedRTT"] = w.MinObservedRTT
+		fset["peakRetransRate"] = w.PeakRetransRate
+		if w.flowControl != FlowControlUnknown {
+			fset["flowControl"] = w.flowControl.String()
+		}
+		if w.stalled {
+			fset["stalled"] = true
+		}
+		if w.rtoStorm {
+			fset["rtoStorm"] = true
+		}
+	}
+	if fo := w.latestInfoLocked().FastOpen(); fo.State != tcpinfo.FastOpenUnknown {
+		fset["fastOpen"] = fo.String()
+	}
+	if w.FD != 0 {
+		fset["fd"] = w.FD
+	}
+	if w.Inode != 0 {
+		fset["inode"] = w.Inode
+	}
+	if w.LastTxTimestamp != 0 {
+		fset["lastTxTimestamp"] = w.LastTxTimestamp
+		fset["lastTxTimestampEnd"] = w.LastTxTimestampEnd
+	}
+	if w.LastRxTimestamp != 0 {
+		fset["lastRxTimestamp"] = w.LastRxTimestamp
+	}
+	if w.TLSHandshakeAt != 0 {
+		fset["tcpConnectedAt"] = w.TCPConnectedAt
+		fset["tlsHandshakeAt"] = w.TLSHandshakeAt
+	}
+	if w.DialDuration != 0 {
+		fset["dialDuration"] = w.DialDuration
+	}
+	if w.LogicalRemoteAddr != "" {
+		fset["logicalRemoteAddr"] = w.LogicalRemoteAddr
+	}
+	if ttfb := w.timeToFirstByteLocked(); ttfb != 0 {
+		fset["timeToFirstByte"] = ttfb
+	}
 	if w.RxErr != nil {
 		fset["rxErr"] = w.RxErr.Error()
 	}
@@ -497,11 +891,27 @@ func (w *Conn) ToMap() map[string]any {
 	if w.InfoErr != nil {
 		fset["infoErr"] = w.InfoErr.Error()
 	}
+	if w.SockOptErr != nil {
+		fset["sockOptErr"] = w.SockOptErr.Error()
+	}
+	if w.ReportErr != nil {
+		fset["reportErr"] = w.ReportErr.Error()
+	}
 	if w.OpenedInfo != nil {
 		fset["openedInfo"] = w.OpenedInfo.ToMap()
 	}
 	if w.ClosedInfo != nil {
 		fset["closedInfo"] = w.ClosedInfo.ToMap()
+		if w.ClosedInfoFallback {
+			fset["closedInfoFallback"] = true
+		}
+	}
+	if w.SampledInfo != nil {
+		fset["sampledInfo"] = w.SampledInfo.ToMap()
+		fset["sampledAge"] = w.SampledAge
+	}
+	if history := w.rttHistory.samples(); len(history) > 0 {
+		fset["rttHistory"] = history
 	}
 	return fset
 }
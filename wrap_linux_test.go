@@ -0,0 +1,641 @@
+//go:build linux
+
+package conniver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
+	"golang.org/x/sys/unix"
+)
+
+// dialLoopback returns the client side of an established loopback TCP connection.
+func dialLoopback(t testing.TB) net.Conn {
+	t.Helper()
+	return dialListenAddr(t, "127.0.0.1:0")
+}
+
+// dialListenAddr returns the client side of an established TCP connection to a
+// listener on addr. The test is skipped if addr cannot be listened on, so IPv6
+// tests degrade gracefully on hosts without IPv6.
+func dialListenAddr(t testing.TB, addr string) net.Conn {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("Listen %s: %v", addr, err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+
+	// Dial the requested host rather than ln.Addr, which may not carry the zone
+	// of a link-local address.
+	host, _, _ := net.SplitHostPort(addr)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if peer, ok := <-accepted; ok {
+		t.Cleanup(func() { _ = peer.Close() })
+	}
+	return conn
+}
+
+func TestWrapConnIPv6Loopback(t *testing.T) {
+	wrapped := WrapConn(dialListenAddr(t, "[::1]:0"), nil).(*Conn)
+
+	if wrapped.OpenedInfo == nil || wrapped.OpenedInfo.State != "ESTABLISHED" || wrapped.OpenedInfo.TxMSS == 0 {
+		t.Fatalf("OpenedInfo = %+v (InfoErr %v), want populated tcpinfo for an IPv6 socket", wrapped.OpenedInfo, wrapped.InfoErr)
+	}
+	for _, addr := range []net.Addr{wrapped.LocalAddr(), wrapped.RemoteAddr()} {
+		if ta, ok := addr.(*net.TCPAddr); !ok || !ta.IP.Equal(net.IPv6loopback) {
+			t.Fatalf("address = %v, want a TCPAddr on ::1", addr)
+		}
+	}
+	if got := wrapped.RemoteAddrString(); !strings.HasPrefix(got, "[::1]:") {
+		t.Fatalf("RemoteAddrString = %q, want bracketed IPv6 host", got)
+	}
+
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if wrapped.ClosedInfo == nil || wrapped.ClosedInfo.State != "ESTABLISHED" {
+		t.Fatalf("ClosedInfo = %+v (InfoErr %v)", wrapped.ClosedInfo, wrapped.InfoErr)
+	}
+}
+
+func TestWrapConnIPv6LinkLocalZone(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("Interfaces: %v", err)
+	}
+	var listenAddr, zone string
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipn, ok := a.(*net.IPNet); ok && ipn.IP.To4() == nil && ipn.IP.IsLinkLocalUnicast() {
+				zone = iface.Name
+				listenAddr = net.JoinHostPort(ipn.IP.String()+"%"+zone, "0")
+				break
+			}
+		}
+		if listenAddr != "" {
+			break
+		}
+	}
+	if listenAddr == "" {
+		t.Skip("no interface with an IPv6 link-local address")
+	}
+
+	wrapped := WrapConn(dialListenAddr(t, listenAddr), nil).(*Conn)
+	defer wrapped.Close()
+
+	if wrapped.OpenedInfo == nil || wrapped.OpenedInfo.State != "ESTABLISHED" {
+		t.Fatalf("OpenedInfo = %+v (InfoErr %v)", wrapped.OpenedInfo, wrapped.InfoErr)
+	}
+	if ta, ok := wrapped.RemoteAddr().(*net.TCPAddr); !ok || ta.Zone != zone {
+		t.Fatalf("RemoteAddr = %#v, want zone %q", wrapped.RemoteAddr(), zone)
+	}
+	if got := wrapped.RemoteAddrString(); !strings.Contains(got, "%"+zone+"]:") {
+		t.Fatalf("RemoteAddrString = %q, want the zone kept", got)
+	}
+	if got := wrapped.ToMap()["remoteAddr"]; got != wrapped.RemoteAddrString() {
+		t.Fatalf("ToMap remoteAddr = %v, want %q", got, wrapped.RemoteAddrString())
+	}
+}
+
+func TestWrapConnRecordsSocketIdentity(t *testing.T) {
+	conn := dialLoopback(t)
+	var fd uintptr
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+	if err := rawConn.Control(func(sysfd uintptr) { fd = sysfd }); err != nil {
+		t.Fatalf("Control: %v", err)
+	}
+
+	wrapped := WrapConn(conn, nil).(*Conn)
+	defer wrapped.Close()
+
+	if wrapped.FD != fd {
+		t.Fatalf("FD = %d, want %d", wrapped.FD, fd)
+	}
+	link, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		t.Skipf("Readlink: %v", err)
+	}
+	if want := fmt.Sprintf("socket:[%d]", wrapped.Inode); link != want {
+		t.Fatalf("/proc/self/fd/%d = %q, want %q", fd, link, want)
+	}
+	if m := wrapped.ToMap(); m["fd"] != fd || m["inode"] != wrapped.Inode {
+		t.Fatalf("ToMap fd = %v, inode = %v", m["fd"], m["inode"])
+	}
+}
+
+func TestWrapConnUnixSocket(t *testing.T) {
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Skipf("Listen unix: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			_, _ = io.Copy(io.Discard, c)
+			_ = c.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	wrapped := WrapConn(conn, nil, WithNoDelay(true)).(*Conn)
+	if !errors.Is(wrapped.SockOptErr, tcpinfo.ErrUnsupported) {
+		t.Fatalf("SockOptErr = %v, want it to wrap tcpinfo.ErrUnsupported", wrapped.SockOptErr)
+	}
+	if _, err := wrapped.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if wrapped.TxBytes != 5 || wrapped.InfoErr != nil || wrapped.OpenedInfo != nil {
+		t.Fatalf("TxBytes = %d, InfoErr = %v, OpenedInfo = %v; want byte counters only",
+			wrapped.TxBytes, wrapped.InfoErr, wrapped.OpenedInfo)
+	}
+}
+
+func TestWrapConnAppliesSocketOptions(t *testing.T) {
+	conn := dialLoopback(t)
+
+	wrapped := WrapConn(conn, nil,
+		WithNoDelay(false),
+		WithKeepAlive(30*time.Second, 5*time.Second, 4),
+		WithNotSentLowat(32<<10),
+	).(*Conn)
+	if wrapped.SockOptErr != nil {
+		t.Fatalf("SockOptErr = %v", wrapped.SockOptErr)
+	}
+
+	want := []struct {
+		name  string
+		level int
+		opt   int
+		value int
+	}{
+		{"TCP_NODELAY", unix.IPPROTO_TCP, unix.TCP_NODELAY, 0},
+		{"SO_KEEPALIVE", unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1},
+		{"TCP_KEEPIDLE", unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, 30},
+		{"TCP_KEEPINTVL", unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, 5},
+		{"TCP_KEEPCNT", unix.IPPROTO_TCP, unix.TCP_KEEPCNT, 4},
+		{"TCP_NOTSENT_LOWAT", unix.IPPROTO_TCP, unix.TCP_NOTSENT_LOWAT, 32 << 10},
+	}
+
+	err := controlFD(conn.(*net.TCPConn), func(fd uintptr) error {
+		for _, w := range want {
+			got, err := unix.GetsockoptInt(int(fd), w.level, w.opt)
+			if err != nil {
+				return err
+			}
+			if got != w.value {
+				t.Errorf("%s = %d, want %d", w.name, got, w.value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("getsockopt: %v", err)
+	}
+}
+
+func TestConnAppLimitedWarningOnlyFromClosedInfo(t *testing.T) {
+	appLimited := (&tcpinfo.SysInfo{
+		DeliveryRateAppLimited: tcpinfo.NullableBool{Valid: true, Value: true},
+	}).ToInfo()
+	w := &Conn{OpenedInfo: appLimited, ClosedInfo: appLimited.Clone()}
+
+	if !w.WasAppLimited() {
+		t.Fatal("WasAppLimited() = false, want true")
+	}
+	count := 0
+	for _, warn := range w.Warnings() {
+		if warn == tcpinfo.WarnAppLimited {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("Warnings() = %v, want exactly one %q from the closing sample", w.Warnings(), tcpinfo.WarnAppLimited)
+	}
+
+	w.ClosedInfo = nil
+	for _, warn := range w.Warnings() {
+		if warn == tcpinfo.WarnAppLimited {
+			t.Fatalf("Warnings() = %v, want no app-limited warning from the open-time sample", w.Warnings())
+		}
+	}
+}
+
+func TestConnLossCallbackOnCAStateTransitions(t *testing.T) {
+	states := []tcpinfo.CAState{
+		tcpinfo.TCP_CA_Open, // opened
+		tcpinfo.TCP_CA_Disorder,
+		tcpinfo.TCP_CA_Recovery,
+		tcpinfo.TCP_CA_Recovery,
+		tcpinfo.TCP_CA_Loss,
+		tcpinfo.TCP_CA_Open,
+		tcpinfo.TCP_CA_Loss,
+	}
+	var mu sync.Mutex
+	next := 0
+	source := func() (*tcpinfo.Info, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		state := states[min(next, len(states)-1)]
+		next++
+		return (&tcpinfo.SysInfo{CAState: state}).ToInfo(), nil
+	}
+
+	entered := make(chan tcpinfo.CAState, 16)
+	wrapped := WrapConn(newFakeConn(), nil,
+		withInfoSource(source),
+		WithSampleInterval(time.Millisecond),
+		WithLossCallback(func(_ *Conn, caState tcpinfo.CAState) { entered <- caState }),
+	)
+	defer wrapped.Close()
+
+	var got []string
+	for range 3 {
+		select {
+		case state := <-entered:
+			got = append(got, state.String())
+		case <-time.After(2 * time.Second):
+			t.Fatalf("loss callbacks = %v, want three", got)
+		}
+	}
+	if want := []string{"Recovery", "Loss", "Loss"}; !slices.Equal(got, want) {
+		t.Fatalf("loss callbacks = %v, want %v", got, want)
+	}
+	select {
+	case state := <-entered:
+		t.Fatalf("unexpected loss callback for %s while staying in Loss", state)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// dialTLSLoopback returns the client side of a loopback TCP connection whose
+// server side runs a TLS handshake with a throwaway self-signed certificate.
+// The client handshake is left to the caller; clientTLSConfig trusts any
+// server.
+func dialTLSLoopback(t *testing.T) net.Conn {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	serverCfg := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		server := tls.Server(c, serverCfg)
+		_ = server.Handshake()
+		accepted <- server
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	// Cleanups run last-in first-out, so the client closes before waiting on
+	// a server that may still be in its handshake.
+	t.Cleanup(func() {
+		if peer, ok := <-accepted; ok {
+			_ = peer.Close()
+		}
+	})
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+var clientTLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+func TestWrapConnUnwrapsTLS(t *testing.T) {
+	conn := tls.Client(dialTLSLoopback(t), clientTLSConfig)
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("Handshake: %v", err)
+	}
+	wrapped := WrapConn(conn, nil, WithNoDelay(true)).(*Conn)
+	defer wrapped.Close()
+
+	if wrapped.SockOptErr != nil {
+		t.Fatalf("SockOptErr = %v, want socket options applied through the TLS layer", wrapped.SockOptErr)
+	}
+	if wrapped.OpenedInfo == nil || wrapped.OpenedInfo.State != "ESTABLISHED" {
+		t.Fatalf("OpenedInfo = %+v (InfoErr %v), want tcpinfo read through the TLS layer", wrapped.OpenedInfo, wrapped.InfoErr)
+	}
+}
+
+func TestConnTLSHandshakeTimingForWrappedTLSConn(t *testing.T) {
+	wrapped := WrapConn(tls.Client(dialTLSLoopback(t), clientTLSConfig), nil).(*Conn)
+	defer wrapped.Close()
+
+	if wrapped.TCPConnectedAt != wrapped.OpenedAt || wrapped.TLSHandshakeAt != 0 {
+		t.Fatalf("before I/O: TCPConnectedAt = %d, TLSHandshakeAt = %d, OpenedAt = %d",
+			wrapped.TCPConnectedAt, wrapped.TLSHandshakeAt, wrapped.OpenedAt)
+	}
+	if _, err := wrapped.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	wrapped.Lock()
+	defer wrapped.Unlock()
+	if wrapped.TLSHandshakeAt < wrapped.TCPConnectedAt {
+		t.Fatalf("TLSHandshakeAt = %d, want at or after TCPConnectedAt %d", wrapped.TLSHandshakeAt, wrapped.TCPConnectedAt)
+	}
+}
+
+func TestConnHandshakeTLS(t *testing.T) {
+	wrapped := WrapConn(dialTLSLoopback(t), nil).(*Conn)
+	defer wrapped.Close()
+
+	if wrapped.TCPConnectedAt != 0 {
+		t.Fatalf("TCPConnectedAt = %d before any TLS handshake, want 0", wrapped.TCPConnectedAt)
+	}
+	tlsConn, err := wrapped.HandshakeTLS(context.Background(), clientTLSConfig)
+	if err != nil {
+		t.Fatalf("HandshakeTLS: %v", err)
+	}
+	if !tlsConn.ConnectionState().HandshakeComplete {
+		t.Fatal("HandshakeTLS returned a conn without a completed handshake")
+	}
+
+	m := wrapped.ToMap()
+	if m["tcpConnectedAt"] != wrapped.OpenedAt || m["tlsHandshakeAt"].(int64) < wrapped.OpenedAt || wrapped.RxBytes == 0 {
+		t.Fatalf("ToMap timing = %v/%v, OpenedAt = %d, RxBytes = %d",
+			m["tcpConnectedAt"], m["tlsHandshakeAt"], wrapped.OpenedAt, wrapped.RxBytes)
+	}
+}
+
+func TestWrapConnTimestamping(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = io.Copy(c, c)
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	before := time.Now().UnixNano()
+	wrapped := WrapConn(conn, nil, WithTimestamping(true)).(*Conn)
+	if wrapped.SockOptErr != nil {
+		t.Skipf("SO_TIMESTAMPING unavailable: %v", wrapped.SockOptErr)
+	}
+	// Segments received right after timestamping is first enabled on a host may
+	// not be stamped yet, so echo until one is.
+	buf := make([]byte, 4)
+	for i := 0; i < 10 && wrapped.LastRxTimestamp == 0; i++ {
+		if _, err := wrapped.Write([]byte("ping")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if _, err := io.ReadFull(wrapped, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("ReadFull = %q, %v", buf, err)
+		}
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	after := time.Now().UnixNano()
+
+	if ts := wrapped.LastTxTimestamp; ts < before || ts > after {
+		t.Errorf("LastTxTimestamp = %d, want a kernel timestamp within [%d, %d]", ts, before, after)
+	}
+	// Each echo arrived before the next write, so the last write was stamped
+	// by the time Close drained the error queue.
+	if wrapped.LastTxTimestampEnd != wrapped.TxBytes {
+		t.Errorf("LastTxTimestampEnd = %d, want TxBytes %d", wrapped.LastTxTimestampEnd, wrapped.TxBytes)
+	}
+	if wrapped.LastRxTimestamp == 0 {
+		// Some userspace network stacks, such as gVisor, accept the option but
+		// do not always stamp received data.
+		t.Skip("no receive timestamps were delivered")
+	}
+	if ts := wrapped.LastRxTimestamp; ts < before || ts > after {
+		t.Errorf("LastRxTimestamp = %d, want a kernel timestamp within [%d, %d]", ts, before, after)
+	}
+}
+
+func TestConnTimestampingReadHonorsDeadline(t *testing.T) {
+	wrapped := WrapConn(dialLoopback(t), nil, WithTimestamping(true)).(*Conn)
+	defer wrapped.Close()
+	if wrapped.SockOptErr != nil {
+		t.Skipf("SO_TIMESTAMPING unavailable: %v", wrapped.SockOptErr)
+	}
+
+	if err := wrapped.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+	_, err := wrapped.Read(make([]byte, 8))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("Read error = %v, want a timeout", err)
+	}
+	if wrapped.RxErr != nil {
+		t.Fatalf("RxErr = %v, want timeouts not recorded", wrapped.RxErr)
+	}
+}
+
+func TestDialAndWrapRecordsDialDuration(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			defer c.Close()
+			_, _ = io.Copy(io.Discard, c)
+		}
+	}()
+
+	var opened *Conn
+	wrapped, err := DialAndWrap(context.Background(), "tcp", ln.Addr().String(), func(c *Conn, state int) {
+		if state == Opened {
+			opened = c
+		}
+	}, WithDialer(&net.Dialer{Timeout: time.Second}), WithEmitOpenCallback(true))
+	if err != nil {
+		t.Fatalf("DialAndWrap: %v", err)
+	}
+	defer wrapped.Close()
+
+	if opened == nil || opened.DialDuration <= 0 {
+		t.Fatalf("Opened snapshot = %+v, want a positive DialDuration", opened)
+	}
+	if got := wrapped.ToMap()["dialDuration"]; got != wrapped.DialDuration {
+		t.Fatalf("ToMap dialDuration = %v, want %v", got, wrapped.DialDuration)
+	}
+
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	if _, err := DialAndWrap(context.Background(), "tcp", addr, nil); err == nil {
+		t.Fatal("DialAndWrap to a closed listener succeeded")
+	}
+}
+
+func TestConnFlowControlState(t *testing.T) {
+	limited := func(rwnd, sndbuf uint64) *tcpinfo.Info {
+		return (&tcpinfo.SysInfo{
+			RxWindowLimited: tcpinfo.NullableUint64{Valid: true, Value: rwnd},
+			TxBufferLimited: tcpinfo.NullableUint64{Valid: true, Value: sndbuf},
+		}).ToInfo()
+	}
+
+	w := &Conn{}
+	start := time.Unix(1700000000, 0)
+	for i, s := range []struct {
+		info *tcpinfo.Info
+		want FlowControlState
+	}{
+		{limited(100, 50), FlowControlUnknown}, // first sample, nothing to diff against
+		{limited(100, 50), FlowControlUnlimited},
+		{limited(900, 60), FlowControlRwndLimited},
+		{limited(900, 400), FlowControlSndbufLimited},
+		{&tcpinfo.Info{}, FlowControlSndbufLimited}, // unreported limits keep the last state
+		{limited(900, 400), FlowControlUnlimited},
+	} {
+		w.recordSampleLocked(start.Add(time.Duration(i)*time.Second), s.info)
+		if got := w.FlowControlState(); got != s.want {
+			t.Fatalf("sample %d: FlowControlState() = %v, want %v", i, got, s.want)
+		}
+	}
+
+	w.sampling = true
+	if got := w.snapshotLocked().ToMap()["flowControl"]; got != "unlimited" {
+		t.Fatalf("ToMap()[\"flowControl\"] = %v, want unlimited", got)
+	}
+}
+
+func TestConnInRTOStorm(t *testing.T) {
+	backoff := func(n uint8) *tcpinfo.Info { return (&tcpinfo.SysInfo{Backoff: n}).ToInfo() }
+
+	w := &Conn{sampling: true}
+	start := time.Unix(1700000000, 0)
+	for i, s := range []struct {
+		info *tcpinfo.Info
+		want bool
+	}{
+		{backoff(0), false},
+		{backoff(2), false},
+		{backoff(DefaultRTOStormBackoff), true},
+		{&tcpinfo.Info{}, true}, // an unreported backoff keeps the last state
+		{backoff(0), false},
+	} {
+		w.recordSampleLocked(start.Add(time.Duration(i)*time.Second), s.info)
+		if got := w.InRTOStorm(); got != s.want {
+			t.Fatalf("sample %d: InRTOStorm() = %v, want %v", i, got, s.want)
+		}
+	}
+
+	w.cfg.rtoStormBackoff = 1
+	w.recordSampleLocked(start.Add(10*time.Second), backoff(1))
+	if !w.InRTOStorm() || w.snapshotLocked().ToMap()["rtoStorm"] != true {
+		t.Fatal("InRTOStorm() with WithRTOStormBackoff(1) and a backoff of 1 = false, want true")
+	}
+	disabled := &Conn{cfg: wrapOptions{rtoStormBackoff: -1}}
+	disabled.recordSampleLocked(start, backoff(10))
+	if disabled.InRTOStorm() {
+		t.Fatal("InRTOStorm() with a negative WithRTOStormBackoff = true, want false")
+	}
+}
+
+func TestConnFastOpen(t *testing.T) {
+	w := &Conn{}
+	if got := w.FastOpen(); got.State != tcpinfo.FastOpenUnknown {
+		t.Fatalf("FastOpen() before any tcpinfo = %v, want unknown", got)
+	}
+	if _, ok := w.ToMap()["fastOpen"]; ok {
+		t.Fatal("ToMap() has fastOpen before any tcpinfo")
+	}
+
+	w.OpenedInfo = (&tcpinfo.SysInfo{FastOpenClientFail: tcpinfo.NullableUint8{Valid: true, Value: 1}}).ToInfo()
+	want := tcpinfo.FastOpenResult{State: tcpinfo.FastOpenFailed, Reason: tcpinfo.FastOpenFailNoCookie}
+	if got := w.FastOpen(); got != want {
+		t.Fatalf("FastOpen() = %v, want %v", got, want)
+	}
+	if got := w.ToMap()["fastOpen"]; got != "failed:no_cookie" {
+		t.Fatalf("ToMap()[fastOpen] = %v, want failed:no_cookie", got)
+	}
+	data, err := json.Marshal(w)
+	if err != nil || !strings.Contains(string(data), `"fastOpen":"failed:no_cookie"`) {
+		t.Fatalf("MarshalJSON() = %s, %v; want fastOpen", data, err)
+	}
+}
+
+func BenchmarkConnSampleLoopback(b *testing.B) {
+	wrapped := WrapConn(dialLoopback(b), func(*Conn, int) {}, WithSampleInterval(time.Hour)).(*Conn)
+	defer wrapped.Close()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		wrapped.sample(time.Now())
+	}
+}
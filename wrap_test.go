@@ -2,10 +2,16 @@ package conniver
 
 import (
 	"errors"
+	"io"
 	"net"
+	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/runZeroInc/conniver/pkg/tcpinfo"
 )
 
 type testAddr string
@@ -38,6 +44,8 @@ type fakeConn struct {
 
 	readData []byte
 	readErr  error
+	writeN   int // Bytes reported by Write when writeErr is set
+	writeErr error
 
 	closeStartedOnce sync.Once
 	closedOnce       sync.Once
@@ -67,6 +75,9 @@ func (c *fakeConn) Read(b []byte) (int, error) {
 }
 
 func (c *fakeConn) Write(b []byte) (int, error) {
+	if c.writeErr != nil {
+		return min(c.writeN, len(b)), c.writeErr
+	}
 	return len(b), nil
 }
 
@@ -157,6 +168,133 @@ func TestConnSetDeadlinesPassThrough(t *testing.T) {
 	}
 }
 
+func TestConnDeadlinesFireOnWrappedConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	wrapped := WrapConn(client, nil).(*Conn)
+
+	if err := wrapped.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+	if _, err := wrapped.Read(make([]byte, 8)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+
+	// Nothing reads from server, so the write blocks until its deadline.
+	if err := wrapped.SetDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("SetDeadline: %v", err)
+	}
+	if _, err := wrapped.Write([]byte("hello")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if wrapped.RxErr != nil || wrapped.TxErr != nil {
+		t.Fatalf("RxErr = %v, TxErr = %v; want timeouts not recorded", wrapped.RxErr, wrapped.TxErr)
+	}
+
+	// Clearing the deadline lets I/O proceed again.
+	if err := wrapped.SetWriteDeadline(time.Time{}); err != nil {
+		t.Fatalf("SetWriteDeadline: %v", err)
+	}
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+	if _, err := wrapped.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write after clearing the deadline: %v", err)
+	}
+
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := wrapped.SetDeadline(time.Now()); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("SetDeadline after Close = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func TestWrapExistingConnUsesSuppliedOpenedAt(t *testing.T) {
+	openedAt := time.Now().Add(-time.Hour)
+	var closed *Conn
+	wrapped := WrapExistingConn(newFakeConn(), openedAt, func(c *Conn, state int) {
+		if state == Closed {
+			closed = c
+		}
+	}, withInfoSource(countingInfoSource())).(*Conn)
+
+	if wrapped.OpenedAt != openedAt.UnixNano() {
+		t.Fatalf("OpenedAt = %d, want %d", wrapped.OpenedAt, openedAt.UnixNano())
+	}
+	if wrapped.OpenedInfo == nil || wrapped.OpenedInfo.RTT != time.Millisecond {
+		t.Fatalf("OpenedInfo = %+v, want the tcpinfo read at wrap time", wrapped.OpenedInfo)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if closed == nil || time.Duration(closed.ClosedAt-closed.OpenedAt) < time.Hour {
+		t.Fatalf("close snapshot = %+v, want a lifetime measured from openedAt", closed)
+	}
+
+	before := time.Now().UnixNano()
+	if w := WrapExistingConn(newFakeConn(), time.Time{}, nil).(*Conn); w.OpenedAt < before {
+		t.Fatalf("OpenedAt with a zero openedAt = %d, want the wrap time (>= %d)", w.OpenedAt, before)
+	}
+}
+
+func TestConnResetReusesClosedWrapper(t *testing.T) {
+	var states []int
+	wrapped := WrapConn(newFakeConn(), func(c *Conn, state int) {
+		states = append(states, state)
+	},
+		WithEmitOpenCallback(true),
+		WithSampleInterval(time.Hour),
+		withInfoSource(countingInfoSource()),
+	).(*Conn)
+
+	if err := wrapped.Reset(newFakeConn()); err == nil {
+		t.Fatal("Reset on an open connection succeeded, want an error")
+	}
+
+	if _, err := wrapped.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	wrapped.SetReconnects(2)
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	closedAt := wrapped.ClosedAt
+
+	next := newFakeConn()
+	next.readData = []byte("abc")
+	if err := wrapped.Reset(next); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if wrapped.Conn != net.Conn(next) {
+		t.Fatalf("Conn = %v, want the new connection", wrapped.Conn)
+	}
+	if wrapped.TxBytes != 0 || wrapped.FirstTxAt != 0 || wrapped.ClosedAt != 0 || wrapped.ClosedInfo != nil || wrapped.Reconnects != 0 {
+		t.Fatalf("lifetime state survived Reset: %+v", wrapped)
+	}
+	if wrapped.OpenedAt < closedAt {
+		t.Fatalf("OpenedAt = %d, want a fresh open time after %d", wrapped.OpenedAt, closedAt)
+	}
+	if wrapped.OpenedInfo == nil || wrapped.sampleDone == nil {
+		t.Fatalf("OpenedInfo = %v, sampleDone = %v, want open-time tcpinfo and a running sampler", wrapped.OpenedInfo, wrapped.sampleDone)
+	}
+
+	if n, err := wrapped.Read(make([]byte, 8)); err != nil || n != 3 {
+		t.Fatalf("Read = %d, %v, want 3, nil", n, err)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if next.CloseCalls() != 1 {
+		t.Fatalf("new connection closed %d times, want 1", next.CloseCalls())
+	}
+	if wrapped.RxBytes != 3 || wrapped.TxBytes != 0 {
+		t.Fatalf("RxBytes, TxBytes = %d, %d after Reset, want 3, 0", wrapped.RxBytes, wrapped.TxBytes)
+	}
+	want := []int{Opened, Closed, Opened, Closed}
+	if !slices.Equal(states, want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+}
+
 func TestConnAddrStringMethods(t *testing.T) {
 	wrapped := WrapConn(newFakeConn(), nil).(*Conn)
 	if got, want := wrapped.LocalAddrString(), "127.0.0.1:12345"; got != want {
@@ -208,13 +346,18 @@ func TestConnOpenCallbackFiresWhenEnabled(t *testing.T) {
 		if state == Opened {
 			openSnapshotCh <- snapshot
 		}
-	}, WithEmitOpenCallback(true))
+	}, WithEmitOpenCallback(true), withInfoSource(countingInfoSource()))
 
 	select {
 	case snap := <-openSnapshotCh:
 		if snap == nil {
 			t.Fatal("Open-state callback delivered a nil snapshot")
 		}
+		// Open-time tcpinfo is applied before the callback fires, so handshake
+		// diagnostics are available without waiting for Close.
+		if snap.OpenedInfo == nil || snap.OpenedInfo.RTT == 0 || snap.InfoErr != nil {
+			t.Fatalf("Open snapshot OpenedInfo = %+v, InfoErr = %v", snap.OpenedInfo, snap.InfoErr)
+		}
 	case <-time.After(time.Second):
 		t.Fatal("Open-state callback did not fire even with WithEmitOpenCallback(true)")
 	}
@@ -350,3 +493,268 @@ func TestConnCloseWaitsForInflightReadBeforeSnapshot(t *testing.T) {
 		t.Fatalf("Read() after Close() error = %v, want %v", err, net.ErrClosed)
 	}
 }
+
+func TestConnCountsPartialIOWithErrors(t *testing.T) {
+	errReset := &net.OpError{Op: "write", Net: "tcp", Err: errors.New("connection reset by peer")}
+	conn := newFakeConn()
+	conn.readData = []byte("partial")
+	conn.readErr = io.EOF
+	conn.writeN = 3
+	conn.writeErr = errReset
+	wrapped := WrapConn(conn, nil).(*Conn)
+
+	n, err := wrapped.Read(make([]byte, 16))
+	if n != 7 || err != io.EOF {
+		t.Fatalf("Read() = %d, %v; want 7, EOF", n, err)
+	}
+	n, err = wrapped.Write([]byte("hello"))
+	if n != 3 || !errors.Is(err, errReset) {
+		t.Fatalf("Write() = %d, %v; want 3, %v", n, err, errReset)
+	}
+
+	if wrapped.RxBytes != 7 || wrapped.TxBytes != 3 {
+		t.Fatalf("RxBytes = %d, TxBytes = %d; want 7 and 3", wrapped.RxBytes, wrapped.TxBytes)
+	}
+	if wrapped.FirstRxAt == 0 || wrapped.LastRxAt == 0 || wrapped.FirstTxAt == 0 || wrapped.LastTxAt == 0 {
+		t.Fatalf("FirstRxAt = %d, LastRxAt = %d, FirstTxAt = %d, LastTxAt = %d; want all set by partial I/O",
+			wrapped.FirstRxAt, wrapped.LastRxAt, wrapped.FirstTxAt, wrapped.LastTxAt)
+	}
+	if !errors.Is(wrapped.TxErr, errReset) {
+		t.Fatalf("TxErr = %v, want %v", wrapped.TxErr, errReset)
+	}
+}
+
+func TestConnSockOptsRecordErrorForNonTCPConn(t *testing.T) {
+	conn := newFakeConn()
+
+	wrapped := WrapConn(conn, nil, WithMaxPacingRate(1<<20)).(*Conn)
+	if !errors.Is(wrapped.SockOptErr, tcpinfo.ErrUnsupported) {
+		t.Fatalf("SockOptErr = %v, want it to wrap tcpinfo.ErrUnsupported", wrapped.SockOptErr)
+	}
+	if wrapped.ToMap()["sockOptErr"] == nil {
+		t.Fatal("ToMap() is missing sockOptErr")
+	}
+}
+
+func TestWrapConnPipeCountsBytesOnly(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	wrapped := WrapConn(client, nil, WithSampleInterval(time.Millisecond)).(*Conn)
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+	if _, err := wrapped.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if wrapped.TxBytes != 5 {
+		t.Fatalf("TxBytes = %d, want 5", wrapped.TxBytes)
+	}
+	if wrapped.InfoErr != nil || wrapped.OpenedInfo != nil || wrapped.ClosedInfo != nil {
+		t.Fatalf("InfoErr = %v, OpenedInfo = %v, ClosedInfo = %v; want no tcpinfo for a pipe",
+			wrapped.InfoErr, wrapped.OpenedInfo, wrapped.ClosedInfo)
+	}
+	if wrapped.FD != 0 || wrapped.Inode != 0 {
+		t.Fatalf("FD = %d, Inode = %d; want zero for a pipe", wrapped.FD, wrapped.Inode)
+	}
+}
+
+func TestConnSockOptsJoinErrors(t *testing.T) {
+	failA := errors.New("option a failed")
+	failB := errors.New("option b failed")
+
+	w := &Conn{Conn: &net.TCPConn{}}
+	w.applySockOpts([]sockOpt{
+		func(*net.TCPConn) error { return failA },
+		func(*net.TCPConn) error { return nil },
+		func(*net.TCPConn) error { return failB },
+	})
+	if !errors.Is(w.SockOptErr, failA) || !errors.Is(w.SockOptErr, failB) {
+		t.Fatalf("SockOptErr = %v, want both option errors joined", w.SockOptErr)
+	}
+}
+
+type netConnWrapper struct {
+	net.Conn
+}
+
+func (c netConnWrapper) NetConn() net.Conn {
+	return c.Conn
+}
+
+func TestUnwrapConnFollowsNetConnLayers(t *testing.T) {
+	tcp := &net.TCPConn{}
+	if got, ok := unwrapConn[*net.TCPConn](netConnWrapper{netConnWrapper{tcp}}); !ok || got != tcp {
+		t.Fatalf("unwrapConn(nested wrappers) = %v, %v; want the inner *net.TCPConn", got, ok)
+	}
+	if _, ok := unwrapConn[*net.TCPConn](netConnWrapper{newFakeConn()}); ok {
+		t.Fatal("unwrapConn found a TCP connection under a non-TCP conn")
+	}
+}
+
+func TestCloseFallsBackToLatestInfo(t *testing.T) {
+	errGone := errors.New("socket gone")
+	var fail atomic.Bool
+	source := countingInfoSource()
+	var closed *Conn
+	wrapped := WrapConn(newFakeConn(), func(c *Conn, state int) {
+		if state == Closed {
+			closed = c
+		}
+	}, withInfoSource(func() (*tcpinfo.Info, error) {
+		if fail.Load() {
+			return nil, errGone
+		}
+		return source()
+	})).(*Conn)
+
+	fail.Store(true)
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if closed == nil || closed.ClosedInfo == nil || closed.ClosedInfo.RTT != wrapped.OpenedInfo.RTT {
+		t.Fatalf("ClosedInfo = %+v, want a copy of OpenedInfo %+v", closed.ClosedInfo, wrapped.OpenedInfo)
+	}
+	if !closed.ClosedInfoFallback || !errors.Is(closed.InfoErr, errGone) {
+		t.Fatalf("ClosedInfoFallback = %v, InfoErr = %v; want true and the failed read's error", closed.ClosedInfoFallback, closed.InfoErr)
+	}
+	if closed.ToMap()["closedInfoFallback"] != true {
+		t.Fatal("ToMap() is missing closedInfoFallback")
+	}
+
+	fail.Store(false)
+	if err := wrapped.Reset(newFakeConn()); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if closed.ClosedInfoFallback || closed.ClosedInfo == nil || closed.ClosedInfo.RTT == closed.OpenedInfo.RTT {
+		t.Fatalf("ClosedInfo = %+v, ClosedInfoFallback = %v; want a fresh close-time read", closed.ClosedInfo, closed.ClosedInfoFallback)
+	}
+}
+
+// closeErrConn is a fakeConn whose Close fails.
+type closeErrConn struct {
+	*fakeConn
+	err error
+}
+
+func (c closeErrConn) Close() error {
+	_ = c.fakeConn.Close()
+	return c.err
+}
+
+func TestConnConcurrentCloseReportsOnce(t *testing.T) {
+	errClose := errors.New("close failed")
+	conn := closeErrConn{fakeConn: newFakeConn(), err: errClose}
+
+	var reports atomic.Int64
+	wrapped := WrapConn(conn, func(_ *Conn, state int) {
+		if state == Closed {
+			reports.Add(1)
+		}
+	}, WithSampleInterval(time.Millisecond), withInfoSource(countingInfoSource())).(*Conn)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Go(func() { errs <- wrapped.Close() })
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, errClose) {
+			t.Fatalf("Close() = %v, want %v from either caller", err, errClose)
+		}
+	}
+
+	if err := wrapped.Close(); !errors.Is(err, errClose) {
+		t.Fatalf("third Close() = %v, want the cached %v", err, errClose)
+	}
+	if got := reports.Load(); got != 1 {
+		t.Fatalf("Closed reports = %d, want 1", got)
+	}
+	if got := conn.CloseCalls(); got != 1 {
+		t.Fatalf("underlying Close() calls = %d, want 1", got)
+	}
+}
+
+// TestWrapConnLoopbackAnyPlatform runs on every platform, including those
+// without tcpinfo support: the byte counters, timestamps, and reports must not
+// depend on the tcpinfo snapshots.
+func TestWrapConnLoopbackAnyPlatform(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = io.Copy(c, c)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	var states []int
+	var closed *Conn
+	wrapped := WrapConn(conn, func(c *Conn, state int) {
+		states = append(states, state)
+		if state == Closed {
+			closed = c
+		}
+	}, WithEmitOpenCallback(true))
+
+	if _, err := wrapped.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(wrapped, buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err := wrapped.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if !slices.Equal(states, []int{Opened, Closed}) {
+		t.Fatalf("states = %v, want Opened then Closed", states)
+	}
+	if closed.TxBytes != 4 || closed.RxBytes != 4 || closed.FirstTxAt == 0 || closed.FirstRxAt == 0 || closed.ClosedAt == 0 {
+		t.Fatalf("Closed report = %+v, want 4 bytes each way with timestamps", closed)
+	}
+	if tcpinfo.Supported() {
+		if closed.OpenedInfo == nil && closed.InfoErr == nil {
+			t.Fatal("OpenedInfo and InfoErr are both nil on a platform with tcpinfo")
+		}
+	} else if closed.OpenedInfo != nil || closed.ClosedInfo != nil || closed.InfoErr != nil {
+		t.Fatalf("OpenedInfo = %v, ClosedInfo = %v, InfoErr = %v; want none without tcpinfo", closed.OpenedInfo, closed.ClosedInfo, closed.InfoErr)
+	}
+}
+
+func TestConnRecordTxTimestampKeepsNewestWrite(t *testing.T) {
+	w := &Conn{}
+	at := func(sec int64) time.Time { return time.Unix(sec, 0) }
+
+	w.recordTxTimestampLocked(txTimestamp{at: at(2), key: 199})
+	// A late timestamp for an earlier write must not replace the newer one.
+	w.recordTxTimestampLocked(txTimestamp{at: at(3), key: 99})
+	w.recordTxTimestampLocked(txTimestamp{})
+	if w.LastTxTimestamp != at(2).UnixNano() || w.LastTxTimestampEnd != 200 {
+		t.Fatalf("LastTxTimestamp = %d, end %d; want the write ending at 200", w.LastTxTimestamp, w.LastTxTimestampEnd)
+	}
+
+	// Keys are 32 bits, so the offset keeps counting past a wrap.
+	w.LastTxTimestampEnd = 1<<32 - 100
+	w.recordTxTimestampLocked(txTimestamp{at: at(4), key: 49})
+	if w.LastTxTimestamp != at(4).UnixNano() || w.LastTxTimestampEnd != 1<<32+50 {
+		t.Fatalf("LastTxTimestamp = %d, end %d; want the write ending at 2^32+50", w.LastTxTimestamp, w.LastTxTimestampEnd)
+	}
+}